@@ -7,8 +7,10 @@ import (
 
 	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
 	"github.com/conductorone/baton-opsgenie/pkg/connector"
+	"github.com/conductorone/baton-sdk/pkg/cli"
 	"github.com/conductorone/baton-sdk/pkg/config"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/connectorrunner"
 	"github.com/conductorone/baton-sdk/pkg/types"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	"go.uber.org/zap"
@@ -20,11 +22,12 @@ var connectorName = "baton-opsgenie"
 func main() {
 	ctx := context.Background()
 
-	_, cmd, err := config.DefineConfiguration(
+	_, cmd, err := config.DefineConfigurationV2(
 		ctx,
 		connectorName,
 		getConnector,
 		cfg.Config,
+		connectorrunner.WithSessionStoreEnabled(),
 	)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
@@ -40,16 +43,25 @@ func main() {
 	}
 }
 
-func getConnector(ctx context.Context, c *cfg.Opsgenie) (types.ConnectorServer, error) {
+func getConnector(ctx context.Context, c *cfg.Opsgenie, runTimeOpts cli.RunTimeOpts) (types.ConnectorServer, error) {
 	l := ctxzap.Extract(ctx)
 
-	cb, err := connector.New(ctx, c.ApiKey, c.BaseUrl)
+	cb, err := connector.New(ctx, c)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
 	}
 
-	conn, err := connectorbuilder.NewConnector(ctx, cb)
+	var opts []connectorbuilder.Opt
+	if c.TicketTeam != "" {
+		opts = append(opts, connectorbuilder.WithTicketingEnabled())
+	}
+	if runTimeOpts.SessionStore != nil {
+		cb.SetSessionStore(ctx, runTimeOpts.SessionStore)
+		opts = append(opts, connectorbuilder.WithSessionStore(runTimeOpts.SessionStore))
+	}
+
+	conn, err := connectorbuilder.NewConnector(ctx, cb, opts...)
 	if err != nil {
 		l.Error("error creating connector", zap.Error(err))
 		return nil, err
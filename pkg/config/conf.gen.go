@@ -6,6 +6,27 @@ import "reflect"
 type Opsgenie struct {
 	ApiKey string `mapstructure:"api-key"`
 	BaseUrl string `mapstructure:"base-url"`
+	Backend string `mapstructure:"backend"`
+	JsmCloudId string `mapstructure:"jsm-cloud-id"`
+	JsmEmail string `mapstructure:"jsm-email"`
+	ExportDir string `mapstructure:"export-dir"`
+	Accounts []string `mapstructure:"accounts"`
+	TeamIncludeRegex string `mapstructure:"team-include-regex"`
+	TeamExcludeRegex string `mapstructure:"team-exclude-regex"`
+	ScheduleIncludeRegex string `mapstructure:"schedule-include-regex"`
+	ScheduleExcludeRegex string `mapstructure:"schedule-exclude-regex"`
+	SkipUserTags []string `mapstructure:"skip-user-tags"`
+	SkipStakeholders bool `mapstructure:"skip-stakeholders"`
+	DryRunProvisioning bool `mapstructure:"dry-run-provisioning"`
+	ReadOnly bool `mapstructure:"read-only"`
+	TicketTeam string `mapstructure:"ticket-team"`
+	TicketPriority string `mapstructure:"ticket-priority"`
+	TicketTags []string `mapstructure:"ticket-tags"`
+	UsageEvidence bool `mapstructure:"usage-evidence"`
+	UsageEvidenceLookbackDays int `mapstructure:"usage-evidence-lookback-days"`
+	LastActivity bool `mapstructure:"last-activity"`
+	LastActivityLookbackDays int `mapstructure:"last-activity-lookback-days"`
+	EmployeeIdDetailKey string `mapstructure:"employee-id-detail-key"`
 }
 
 func (c *Opsgenie) findFieldByTag(tagValue string) (any, bool) {
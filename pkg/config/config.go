@@ -7,9 +7,8 @@ import (
 var (
 	ApiKeyField = field.StringField(
 		"api-key",
-		field.WithDescription("Opsgenie API Key"),
+		field.WithDescription("Opsgenie API Key, or the Atlassian API token with the jsm-ops backend"),
 		field.WithIsSecret(true),
-		field.WithRequired(true),
 	)
 
 	BaseURLField = field.StringField(
@@ -19,15 +18,155 @@ var (
 		field.WithExportTarget(field.ExportTargetCLIOnly),
 	)
 
+	BackendField = field.SelectField(
+		"backend",
+		[]string{"opsgenie", "jsm-ops"},
+		field.WithDescription("API to sync users, teams, roles and schedules from: the classic Opsgenie API or the Jira Service Management Operations API"),
+		field.WithDefaultValue("opsgenie"),
+	)
+
+	JSMCloudIDField = field.StringField(
+		"jsm-cloud-id",
+		field.WithDescription("Cloud ID of the Atlassian site, required by the jsm-ops backend"),
+	)
+
+	JSMEmailField = field.StringField(
+		"jsm-email",
+		field.WithDescription("Email of the Atlassian account the API token belongs to, required by the jsm-ops backend"),
+	)
+
+	ExportDirField = field.StringField(
+		"export-dir",
+		field.WithDescription("Directory of an Opsgenie configuration export to sync users, teams, roles and schedules from, instead of the API"),
+	)
+
+	AccountsField = field.StringSliceField(
+		"accounts",
+		field.WithDescription("Opsgenie accounts to sync together, as name:region:api-key entries where region is us or eu. Replaces api-key"),
+		field.WithIsSecret(true),
+	)
+
+	TeamIncludeRegexField = field.StringField(
+		"team-include-regex",
+		field.WithDescription("Only sync teams whose name matches this regular expression"),
+	)
+
+	TeamExcludeRegexField = field.StringField(
+		"team-exclude-regex",
+		field.WithDescription("Skip teams whose name matches this regular expression"),
+	)
+
+	ScheduleIncludeRegexField = field.StringField(
+		"schedule-include-regex",
+		field.WithDescription("Only sync schedules whose name matches this regular expression"),
+	)
+
+	ScheduleExcludeRegexField = field.StringField(
+		"schedule-exclude-regex",
+		field.WithDescription("Skip schedules whose name matches this regular expression"),
+	)
+
+	SkipUserTagsField = field.StringSliceField(
+		"skip-user-tags",
+		field.WithDescription("Skip users with any of these tags"),
+	)
+
+	SkipStakeholdersField = field.BoolField(
+		"skip-stakeholders",
+		field.WithDescription("Skip users with the Stakeholder role"),
+	)
+
+	DryRunProvisioningField = field.BoolField(
+		"dry-run-provisioning",
+		field.WithDescription("Log and return the Opsgenie API requests that provisioning would send, without sending them"),
+	)
+
+	ReadOnlyField = field.BoolField(
+		"read-only",
+		field.WithDescription("Refuse every Opsgenie API request that would change data, including provisioning, actions and ticketing"),
+	)
+
+	TicketTeamField = field.StringField(
+		"ticket-team",
+		field.WithDescription("Opsgenie team (name or ID) that tickets are routed to as alerts. Setting it enables ticketing"),
+	)
+
+	TicketPriorityField = field.SelectField(
+		"ticket-priority",
+		[]string{"P1", "P2", "P3", "P4", "P5"},
+		field.WithDescription("Default priority of alerts created for tickets"),
+		field.WithDefaultValue("P3"),
+	)
+
+	TicketTagsField = field.StringSliceField(
+		"ticket-tags",
+		field.WithDescription("Tags added to every alert created for a ticket"),
+	)
+
+	UsageEvidenceField = field.BoolField(
+		"usage-evidence",
+		field.WithDescription("Scan recent alerts and add when each user last acknowledged or closed an alert to their profile"),
+	)
+
+	UsageEvidenceLookbackDaysField = field.IntField(
+		"usage-evidence-lookback-days",
+		field.WithDescription("How many days of alerts to scan for usage evidence"),
+		field.WithDefaultValue(30),
+	)
+
+	LastActivityField = field.BoolField(
+		"last-activity",
+		field.WithDescription("Derive each user's last activity from the account audit logs and alert activity"),
+	)
+
+	LastActivityLookbackDaysField = field.IntField(
+		"last-activity-lookback-days",
+		field.WithDescription("How many days back to search for user activity"),
+		field.WithDefaultValue(90),
+	)
+
+	EmployeeIDDetailKeyField = field.StringField(
+		"employee-id-detail-key",
+		field.WithDescription("Opsgenie user detail key whose value is used as the user's employee ID"),
+	)
+
 	ConfigurationFields = []field.SchemaField{
 		ApiKeyField,
 		BaseURLField,
+		BackendField,
+		JSMCloudIDField,
+		JSMEmailField,
+		ExportDirField,
+		AccountsField,
+		TeamIncludeRegexField,
+		TeamExcludeRegexField,
+		ScheduleIncludeRegexField,
+		ScheduleExcludeRegexField,
+		SkipUserTagsField,
+		SkipStakeholdersField,
+		DryRunProvisioningField,
+		ReadOnlyField,
+		TicketTeamField,
+		TicketPriorityField,
+		TicketTagsField,
+		UsageEvidenceField,
+		UsageEvidenceLookbackDaysField,
+		LastActivityField,
+		LastActivityLookbackDaysField,
+		EmployeeIDDetailKeyField,
+	}
+
+	ConfigurationConstraints = []field.SchemaFieldRelationship{
+		field.FieldsAtLeastOneUsed(ApiKeyField, ExportDirField, AccountsField),
+		field.FieldsMutuallyExclusive(ApiKeyField, AccountsField),
+		field.FieldsMutuallyExclusive(ExportDirField, AccountsField),
 	}
 
 	ConfigurationSchema = field.Configuration{
-		Fields: ConfigurationFields,
+		Fields:      ConfigurationFields,
+		Constraints: ConfigurationConstraints,
 	}
 )
 
 //go:generate go run ./gen
-var Config = field.NewConfiguration(ConfigurationFields)
+var Config = field.NewConfiguration(ConfigurationFields, field.WithConstraints(ConfigurationConstraints...))
@@ -0,0 +1,464 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	custom_role "github.com/opsgenie/opsgenie-go-sdk-v2/custom_user_role"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	addUserToTeamAction          = "add_user_to_team"
+	setUserRoleAction            = "set_user_role"
+	blockUserAction              = "block_user"
+	createScheduleOverrideAction = "create_schedule_override"
+
+	teamRoleUser  = "user"
+	teamRoleAdmin = "admin"
+)
+
+func resourceIDArgument(name, displayName, description string, resourceType *v2.ResourceType) *config.Field {
+	return &config.Field{
+		Name:        name,
+		DisplayName: displayName,
+		Description: description,
+		IsRequired:  true,
+		Field: &config.Field_ResourceIdField{ResourceIdField: &config.ResourceIdField{
+			Rules: &config.ResourceIDRules{AllowedResourceTypeIds: []string{resourceType.Id}},
+		}},
+	}
+}
+
+func stringArgument(name, displayName, description string, required bool) *config.Field {
+	return &config.Field{
+		Name:        name,
+		DisplayName: displayName,
+		Description: description,
+		IsRequired:  required,
+		Field:       &config.Field_StringField{StringField: &config.StringField{}},
+	}
+}
+
+func stringReturnType(name string) *config.Field {
+	return &config.Field{Name: name, Field: &config.Field_StringField{StringField: &config.StringField{}}}
+}
+
+func boolReturnType(name string) *config.Field {
+	return &config.Field{Name: name, Field: &config.Field_BoolField{BoolField: &config.BoolField{}}}
+}
+
+var (
+	addUserToTeamActionSchema = &v2.BatonActionSchema{
+		Name:        addUserToTeamAction,
+		DisplayName: "Add User to Team",
+		Description: "Add an Opsgenie user to a team",
+		Arguments: []*config.Field{
+			resourceIDArgument("user", "User", "The user to add", resourceTypeUser),
+			resourceIDArgument("team", "Team", "The team to add the user to", resourceTypeTeam),
+			stringArgument("team_role", "Team role", "The team role to assign, either user or admin (defaults to user)", false),
+		},
+		ReturnTypes: []*config.Field{
+			boolReturnType("success"),
+			stringReturnType("user_id"),
+			stringReturnType("team_id"),
+			stringReturnType("team_role"),
+			stringReturnType("request_id"),
+		},
+	}
+
+	setUserRoleActionSchema = &v2.BatonActionSchema{
+		Name:        setUserRoleAction,
+		DisplayName: "Set User Role",
+		Description: "Change the Opsgenie role of a user",
+		Arguments: []*config.Field{
+			resourceIDArgument("user", "User", "The user to update", resourceTypeUser),
+			resourceIDArgument("role", "Role", "The role to assign", resourceTypeRole),
+		},
+		ReturnTypes: []*config.Field{
+			boolReturnType("success"),
+			stringReturnType("user_id"),
+			stringReturnType("previous_role"),
+			stringReturnType("role"),
+			stringReturnType("request_id"),
+		},
+	}
+
+	blockUserActionSchema = &v2.BatonActionSchema{
+		Name:        blockUserAction,
+		DisplayName: "Block User",
+		Description: "Block an Opsgenie user so they can no longer log in or be notified",
+		Arguments: []*config.Field{
+			resourceIDArgument("user", "User", "The user to block", resourceTypeUser),
+		},
+		ReturnTypes: []*config.Field{
+			boolReturnType("success"),
+			stringReturnType("user_id"),
+			boolReturnType("blocked"),
+			stringReturnType("request_id"),
+		},
+		ActionType: []v2.ActionType{v2.ActionType_ACTION_TYPE_ACCOUNT_DISABLE},
+	}
+
+	createScheduleOverrideActionSchema = &v2.BatonActionSchema{
+		Name:        createScheduleOverrideAction,
+		DisplayName: "Create Schedule Override",
+		Description: "Put a user on call for a schedule for a bounded period of time",
+		Arguments: []*config.Field{
+			resourceIDArgument("schedule", "Schedule", "The schedule to override", resourceTypeSchedule),
+			resourceIDArgument("user", "User", "The user to put on call", resourceTypeUser),
+			stringArgument("start_date", "Start date", "Start of the override in RFC3339 format", true),
+			stringArgument("end_date", "End date", "End of the override in RFC3339 format", true),
+			stringArgument("alias", "Alias", "Optional alias for the override", false),
+		},
+		ReturnTypes: []*config.Field{
+			boolReturnType("success"),
+			stringReturnType("schedule_id"),
+			stringReturnType("user_id"),
+			stringReturnType("alias"),
+			stringReturnType("start_date"),
+			stringReturnType("end_date"),
+			stringReturnType("request_id"),
+		},
+	}
+)
+
+// requireResourceIDArg extracts a resource ID argument and checks that it has the expected resource type.
+func requireResourceIDArg(args *structpb.Struct, key string, resourceType *v2.ResourceType) (*v2.ResourceId, error) {
+	resourceID, err := actions.RequireResourceIDArg(args, key)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if resourceID.ResourceType != resourceType.Id {
+		return nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: argument %s must be a %s, got %s", key, resourceType.Id, resourceID.ResourceType)
+	}
+
+	if resourceID.Resource == "" {
+		return nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: argument %s is missing a resource id", key)
+	}
+
+	return resourceID, nil
+}
+
+// requireTimeArg extracts an RFC3339 timestamp argument.
+func requireTimeArg(args *structpb.Struct, key string) (time.Time, error) {
+	value, err := actions.RequireStringArg(args, key)
+	if err != nil {
+		return time.Time{}, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, status.Errorf(codes.InvalidArgument, "opsgenie-connector: argument %s must be an RFC3339 timestamp: %s", key, err.Error())
+	}
+
+	return t, nil
+}
+
+func actionResult(fields map[string]*structpb.Value) *structpb.Struct {
+	fields["success"] = structpb.NewBoolValue(true)
+	return &structpb.Struct{Fields: fields}
+}
+
+func (c *Opsgenie) GlobalActions(ctx context.Context, registry actions.ActionRegistry) error {
+	if len(c.accounts) > 0 {
+		return c.accountGlobalActions(ctx, registry)
+	}
+
+	if err := registry.Register(ctx, addUserToTeamActionSchema, c.addUserToTeam); err != nil {
+		return err
+	}
+
+	if err := registry.Register(ctx, setUserRoleActionSchema, c.setUserRole); err != nil {
+		return err
+	}
+
+	if err := registry.Register(ctx, blockUserActionSchema, c.blockUser); err != nil {
+		return err
+	}
+
+	return registry.Register(ctx, createScheduleOverrideActionSchema, c.createScheduleOverride)
+}
+
+func (c *Opsgenie) addUserToTeam(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	userID, err := requireResourceIDArg(args, "user", resourceTypeUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	teamID, err := requireResourceIDArg(args, "team", resourceTypeTeam)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	teamRole, ok := actions.GetStringArg(args, "team_role")
+	if !ok || teamRole == "" {
+		teamRole = teamRoleUser
+	}
+	if teamRole != teamRoleUser && teamRole != teamRoleAdmin {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: team_role must be %s or %s, got %s", teamRoleUser, teamRoleAdmin, teamRole)
+	}
+
+	teamClient, err := oteam.NewClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := teamClient.AddMember(ctx, &oteam.AddTeamMemberRequest{
+		TeamIdentifierType:  oteam.Id,
+		TeamIdentifierValue: teamID.Resource,
+		User:                oteam.User{ID: userID.Resource},
+		Role:                teamRole,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to add user %s to team %s: %w", userID.Resource, teamID.Resource, translateAPIError(c.failures, err))
+	}
+
+	ctxzap.Extract(ctx).Info(
+		"opsgenie-connector: added user to team",
+		zap.String("user_id", userID.Resource),
+		zap.String("team_id", teamID.Resource),
+		zap.String("team_role", teamRole),
+		zap.String("request_id", res.RequestId),
+	)
+
+	return actionResult(map[string]*structpb.Value{
+		"user_id":    structpb.NewStringValue(userID.Resource),
+		"team_id":    structpb.NewStringValue(teamID.Resource),
+		"team_role":  structpb.NewStringValue(teamRole),
+		"request_id": structpb.NewStringValue(res.RequestId),
+	}), nil, nil
+}
+
+// roleName resolves a role resource ID to the role name the Opsgenie user API expects.
+func (c *Opsgenie) roleName(ctx context.Context, roleID string) (string, error) {
+	for name, id := range defaultRoles {
+		if id == roleID {
+			return name, nil
+		}
+	}
+
+	crClient, err := custom_role.NewClient(c.config)
+	if err != nil {
+		return "", err
+	}
+
+	role, err := crClient.Get(ctx, &custom_role.GetRequest{
+		Identifier:     roleID,
+		IdentifierType: custom_role.Id,
+	})
+	if err != nil {
+		return "", fmt.Errorf("opsgenie-connector: failed to get role %s: %w", roleID, translateAPIError(c.failures, err))
+	}
+
+	return role.Name, nil
+}
+
+func (c *Opsgenie) setUserRole(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	userID, err := requireResourceIDArg(args, "user", resourceTypeUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleID, err := requireResourceIDArg(args, "role", resourceTypeRole)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	roleName, err := c.roleName(ctx, roleID.Resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userClient, err := user.NewClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current, err := userClient.Get(ctx, &user.GetRequest{Identifier: userID.Resource})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get user %s: %w", userID.Resource, translateAPIError(c.failures, err))
+	}
+
+	var previousRole string
+	if current.Role != nil {
+		previousRole = current.Role.RoleName
+	}
+
+	res, err := userClient.Update(ctx, &user.UpdateRequest{
+		Identifier: userID.Resource,
+		Role:       &user.UserRoleRequest{RoleName: roleName},
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to set role of user %s: %w", userID.Resource, translateAPIError(c.failures, err))
+	}
+
+	ctxzap.Extract(ctx).Info(
+		"opsgenie-connector: changed user role",
+		zap.String("user_id", userID.Resource),
+		zap.String("previous_role", previousRole),
+		zap.String("role", roleName),
+		zap.String("request_id", res.RequestId),
+	)
+
+	return actionResult(map[string]*structpb.Value{
+		"user_id":       structpb.NewStringValue(userID.Resource),
+		"previous_role": structpb.NewStringValue(previousRole),
+		"role":          structpb.NewStringValue(roleName),
+		"request_id":    structpb.NewStringValue(res.RequestId),
+	}), nil, nil
+}
+
+// blockUserRequest updates the blocked flag of a user. The Opsgenie SDK's user.UpdateRequest does not expose it.
+type blockUserRequest struct {
+	ogclient.BaseRequest
+	Identifier string `json:"-"`
+	Blocked    bool   `json:"blocked"`
+}
+
+func (r *blockUserRequest) Validate() error {
+	if r.Identifier == "" {
+		return fmt.Errorf("identifier can not be empty")
+	}
+	return nil
+}
+
+func (r *blockUserRequest) ResourcePath() string {
+	return "/v2/users/" + r.Identifier
+}
+
+func (r *blockUserRequest) Method() string {
+	return http.MethodPatch
+}
+
+type blockUserResult struct {
+	ogclient.ResultMetadata
+	Result string `json:"result"`
+}
+
+func (c *Opsgenie) blockUser(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	userID, err := requireResourceIDArg(args, "user", resourceTypeUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := ogclient.NewOpsGenieClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res := &blockUserResult{}
+	err = client.Exec(ctx, &blockUserRequest{Identifier: userID.Resource, Blocked: true}, res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to block user %s: %w", userID.Resource, translateAPIError(c.failures, err))
+	}
+
+	// The blocked flag is not part of the documented update payload, so read the user back to confirm it took effect.
+	userClient, err := user.NewClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := userClient.Get(ctx, &user.GetRequest{Identifier: userID.Resource})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get user %s: %w", userID.Resource, translateAPIError(c.failures, err))
+	}
+
+	if !u.Blocked {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "opsgenie-connector: user %s is still not blocked after update (request id %s)", userID.Resource, res.RequestId)
+	}
+
+	ctxzap.Extract(ctx).Info(
+		"opsgenie-connector: blocked user",
+		zap.String("user_id", userID.Resource),
+		zap.String("request_id", res.RequestId),
+	)
+
+	return actionResult(map[string]*structpb.Value{
+		"user_id":    structpb.NewStringValue(userID.Resource),
+		"blocked":    structpb.NewBoolValue(u.Blocked),
+		"request_id": structpb.NewStringValue(res.RequestId),
+	}), nil, nil
+}
+
+func (c *Opsgenie) createScheduleOverride(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	scheduleID, err := requireResourceIDArg(args, "schedule", resourceTypeSchedule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userID, err := requireResourceIDArg(args, "user", resourceTypeUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startDate, err := requireTimeArg(args, "start_date")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	endDate, err := requireTimeArg(args, "end_date")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !endDate.After(startDate) {
+		return nil, nil, status.Error(codes.InvalidArgument, "opsgenie-connector: end_date must be after start_date")
+	}
+
+	alias, _ := actions.GetStringArg(args, "alias")
+
+	client, err := ogSchedule.NewClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := client.CreateScheduleOverride(ctx, &ogSchedule.CreateScheduleOverrideRequest{
+		Alias: alias,
+		User: ogSchedule.Responder{
+			Type: ogSchedule.UserResponderType,
+			Id:   userID.Resource,
+		},
+		StartDate:              startDate,
+		EndDate:                endDate,
+		ScheduleIdentifierType: ogSchedule.Id,
+		ScheduleIdentifier:     scheduleID.Resource,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to create override for schedule %s: %w", scheduleID.Resource, translateAPIError(c.failures, err))
+	}
+
+	ctxzap.Extract(ctx).Info(
+		"opsgenie-connector: created schedule override",
+		zap.String("schedule_id", scheduleID.Resource),
+		zap.String("user_id", userID.Resource),
+		zap.String("alias", res.Alias),
+		zap.Time("start_date", startDate),
+		zap.Time("end_date", endDate),
+		zap.String("request_id", res.RequestId),
+	)
+
+	return actionResult(map[string]*structpb.Value{
+		"schedule_id": structpb.NewStringValue(scheduleID.Resource),
+		"user_id":     structpb.NewStringValue(userID.Resource),
+		"alias":       structpb.NewStringValue(res.Alias),
+		"start_date":  structpb.NewStringValue(startDate.UTC().Format(time.RFC3339)),
+		"end_date":    structpb.NewStringValue(endDate.UTC().Format(time.RFC3339)),
+		"request_id":  structpb.NewStringValue(res.RequestId),
+	}), nil, nil
+}
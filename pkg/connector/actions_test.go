@@ -0,0 +1,361 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	ogClient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newActionTestConnector returns an Opsgenie connector that talks to the given httptest server.
+func newActionTestConnector(srv *httptest.Server) *Opsgenie {
+	// The OpsGenie SDK uses HTTP (not HTTPS) when the apiUrl doesn't contain "api".
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	return &Opsgenie{
+		config: &ogClient.Config{
+			ApiKey:         "test-key",
+			OpsGenieAPIURL: ogClient.ApiUrl(host),
+			RetryCount:     1,
+		},
+	}
+}
+
+// newTestOpsgenieBackend returns a backend reading from the classic API with the given config.
+func newTestOpsgenieBackend(t testing.TB, config *ogClient.Config) *opsgenieBackend {
+	t.Helper()
+
+	b, err := newOpsgenieBackend(config, nil)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+
+	return b
+}
+
+// writeRequests returns the method and path of the requests that changed the fake.
+func writeRequests(srv *opsgenietest.Server) []string {
+	var rv []string
+	for _, r := range srv.Requests() {
+		if !strings.HasPrefix(r, http.MethodGet+" ") {
+			rv = append(rv, r)
+		}
+	}
+
+	return rv
+}
+
+// writeOpsgenieJSON writes an Opsgenie style response with a request ID.
+func writeOpsgenieJSON(t testing.TB, w http.ResponseWriter, statusCode int, body map[string]interface{}) {
+	t.Helper()
+
+	body["took"] = 0.01
+	body["requestId"] = "test-request-id"
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Request-Id", "test-request-id")
+	w.WriteHeader(statusCode)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		t.Errorf("failed to encode response: %v", err)
+	}
+}
+
+func decodeBody(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		t.Fatalf("failed to read request body: %v", err)
+	}
+
+	rv := map[string]interface{}{}
+	if err := json.Unmarshal(body, &rv); err != nil {
+		t.Fatalf("failed to decode request body %q: %v", body, err)
+	}
+
+	return rv
+}
+
+func resourceIDValue(resourceType, id string) *structpb.Value {
+	return structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+		"resource_type_id": structpb.NewStringValue(resourceType),
+		"resource_id":      structpb.NewStringValue(id),
+	}})
+}
+
+func TestGlobalActions_RegistersSchemas(t *testing.T) {
+	ctx := context.Background()
+	manager := actions.NewActionManager(ctx)
+
+	c := &Opsgenie{config: &ogClient.Config{ApiKey: "test-key"}}
+	if err := c.GlobalActions(ctx, manager); err != nil {
+		t.Fatalf("failed to register global actions: %v", err)
+	}
+
+	schemas, _, err := manager.ListActionSchemas(ctx, "")
+	if err != nil {
+		t.Fatalf("failed to list action schemas: %v", err)
+	}
+
+	want := map[string]bool{
+		addUserToTeamAction:          false,
+		setUserRoleAction:            false,
+		blockUserAction:              false,
+		createScheduleOverrideAction: false,
+	}
+	for _, s := range schemas {
+		want[s.GetName()] = true
+	}
+	for name, found := range want {
+		if !found {
+			t.Errorf("expected action %s to be registered", name)
+		}
+	}
+}
+
+func TestAddUserToTeamAction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/teams/team-1/members" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		body := decodeBody(t, r)
+		if got := body["user"].(map[string]interface{})["id"]; got != "user-1" {
+			t.Errorf("expected user id user-1, got %v", got)
+		}
+		if got := body["role"]; got != teamRoleAdmin {
+			t.Errorf("expected role admin, got %v", got)
+		}
+
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"result": "Added", "data": map[string]interface{}{"id": "team-1"}})
+	}))
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+	rv, _, err := c.addUserToTeam(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		"user":      resourceIDValue(resourceTypeUser.Id, "user-1"),
+		"team":      resourceIDValue(resourceTypeTeam.Id, "team-1"),
+		"team_role": structpb.NewStringValue(teamRoleAdmin),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !rv.Fields["success"].GetBoolValue() {
+		t.Error("expected success")
+	}
+	if got := rv.Fields["request_id"].GetStringValue(); got != "test-request-id" {
+		t.Errorf("expected request id to be returned, got %q", got)
+	}
+}
+
+func TestAddUserToTeamAction_InvalidArguments(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+
+	tests := map[string]*structpb.Struct{
+		"missing team": {Fields: map[string]*structpb.Value{
+			"user": resourceIDValue(resourceTypeUser.Id, "user-1"),
+		}},
+		"wrong resource type": {Fields: map[string]*structpb.Value{
+			"user": resourceIDValue(resourceTypeTeam.Id, "team-2"),
+			"team": resourceIDValue(resourceTypeTeam.Id, "team-1"),
+		}},
+		"unknown team role": {Fields: map[string]*structpb.Value{
+			"user":      resourceIDValue(resourceTypeUser.Id, "user-1"),
+			"team":      resourceIDValue(resourceTypeTeam.Id, "team-1"),
+			"team_role": structpb.NewStringValue("owner"),
+		}},
+	}
+
+	for name, args := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := c.addUserToTeam(context.Background(), args)
+			if got := status.Code(err); got != codes.InvalidArgument {
+				t.Errorf("expected codes.InvalidArgument, got %v (err: %v)", got, err)
+			}
+		})
+	}
+}
+
+func TestSetUserRoleAction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/users/user-1":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"id":   "user-1",
+				"role": map[string]interface{}{"name": "User"},
+			}})
+		case r.Method == http.MethodPatch && r.URL.Path == "/v2/users/user-1":
+			body := decodeBody(t, r)
+			if got := body["role"].(map[string]interface{})["name"]; got != "Admin" {
+				t.Errorf("expected role Admin, got %v", got)
+			}
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"result": "Updated"})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+	rv, _, err := c.setUserRole(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		"user": resourceIDValue(resourceTypeUser.Id, "user-1"),
+		"role": resourceIDValue(resourceTypeRole.Id, defaultRoles["Admin"]),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := rv.Fields["previous_role"].GetStringValue(); got != "User" {
+		t.Errorf("expected previous role User, got %q", got)
+	}
+	if got := rv.Fields["role"].GetStringValue(); got != "Admin" {
+		t.Errorf("expected role Admin, got %q", got)
+	}
+}
+
+func TestBlockUserAction(t *testing.T) {
+	for name, blocked := range map[string]bool{"blocked": true, "not applied": false} {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case r.Method == http.MethodPatch && r.URL.Path == "/v2/users/user-1":
+					body := decodeBody(t, r)
+					if got := body["blocked"]; got != true {
+						t.Errorf("expected blocked to be true, got %v", got)
+					}
+					writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"result": "Updated"})
+				case r.Method == http.MethodGet && r.URL.Path == "/v2/users/user-1":
+					writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+						"id":      "user-1",
+						"blocked": blocked,
+					}})
+				default:
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			c := newActionTestConnector(srv)
+			rv, _, err := c.blockUser(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+				"user": resourceIDValue(resourceTypeUser.Id, "user-1"),
+			}})
+
+			if !blocked {
+				if got := status.Code(err); got != codes.FailedPrecondition {
+					t.Errorf("expected codes.FailedPrecondition, got %v (err: %v)", got, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !rv.Fields["blocked"].GetBoolValue() {
+				t.Error("expected blocked to be returned as true")
+			}
+			if got := rv.Fields["request_id"].GetStringValue(); got != "test-request-id" {
+				t.Errorf("expected request id to be returned, got %q", got)
+			}
+		})
+	}
+}
+
+func TestBlockUserAction_WrongResourceType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	_, _, err := newActionTestConnector(srv).blockUser(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		"user": resourceIDValue(resourceTypeTeam.Id, "team-1"),
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a non-user resource, got %v", err)
+	}
+}
+
+func TestCreateScheduleOverrideAction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/schedules/schedule-1/overrides" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if got := r.URL.Query().Get("scheduleIdentifierType"); got != "id" {
+			t.Errorf("expected schedule identifier type id, got %q", got)
+		}
+
+		body := decodeBody(t, r)
+		if got := body["user"].(map[string]interface{})["id"]; got != "user-1" {
+			t.Errorf("expected user id user-1, got %v", got)
+		}
+		if got := body["startDate"]; got != "2026-01-01T00:00:00Z" {
+			t.Errorf("unexpected start date %v", got)
+		}
+
+		writeOpsgenieJSON(t, w, http.StatusCreated, map[string]interface{}{"data": map[string]interface{}{"alias": "override-1"}})
+	}))
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+	rv, _, err := c.createScheduleOverride(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		"schedule":   resourceIDValue(resourceTypeSchedule.Id, "schedule-1"),
+		"user":       resourceIDValue(resourceTypeUser.Id, "user-1"),
+		"start_date": structpb.NewStringValue("2026-01-01T00:00:00Z"),
+		"end_date":   structpb.NewStringValue("2026-01-02T00:00:00Z"),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := rv.Fields["alias"].GetStringValue(); got != "override-1" {
+		t.Errorf("expected alias override-1, got %q", got)
+	}
+}
+
+func TestCreateScheduleOverrideAction_InvalidDates(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+
+	for name, dates := range map[string][2]string{
+		"end before start": {"2026-01-02T00:00:00Z", "2026-01-01T00:00:00Z"},
+		"not rfc3339":      {"tomorrow", "2026-01-01T00:00:00Z"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := c.createScheduleOverride(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+				"schedule":   resourceIDValue(resourceTypeSchedule.Id, "schedule-1"),
+				"user":       resourceIDValue(resourceTypeUser.Id, "user-1"),
+				"start_date": structpb.NewStringValue(dates[0]),
+				"end_date":   structpb.NewStringValue(dates[1]),
+			}})
+			if got := status.Code(err); got != codes.InvalidArgument {
+				t.Errorf("expected codes.InvalidArgument, got %v (err: %v)", got, err)
+			}
+		})
+	}
+}
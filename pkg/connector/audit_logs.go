@@ -0,0 +1,133 @@
+package connector
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	ogLogs "github.com/opsgenie/opsgenie-go-sdk-v2/logs"
+	"go.uber.org/zap"
+)
+
+const (
+	// auditLogMarkerLayout is the format of the marker Opsgenie uses to page through log files.
+	auditLogMarkerLayout = "2006-01-02-15-04-05"
+	auditLogFilesPerPage = 1000
+	maxAuditLogLineSize  = 1024 * 1024
+
+	defaultLastActivityLookback = 90 * 24 * time.Hour
+)
+
+// auditLogEntry is a line of an Opsgenie log file. Log files hold one JSON object per line, with the
+// user who acted, or System, the time and a description of what happened.
+type auditLogEntry struct {
+	Owner string    `json:"owner"`
+	Date  time.Time `json:"date"`
+	Log   string    `json:"log"`
+}
+
+// lastActivityLookback returns how far back to search for user activity.
+func lastActivityLookback(days int) time.Duration {
+	if days <= 0 {
+		return defaultLastActivityLookback
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// parseAuditLogLine extracts the acting user and the time of an audit log entry. Lines that aren't
+// entries are skipped, and so are entries without an owner or a time. Entries owned by System never
+// match a user, since activity is looked up by username.
+func parseAuditLogLine(line []byte) (string, time.Time, bool) {
+	var entry auditLogEntry
+	if err := json.Unmarshal(line, &entry); err != nil {
+		return "", time.Time{}, false
+	}
+
+	if entry.Owner == "" || entry.Date.IsZero() {
+		return "", time.Time{}, false
+	}
+
+	return entry.Owner, entry.Date, true
+}
+
+// scanAuditLogs reads the account log files written since the audit log lookback and records the
+// latest entry of every user as their last activity.
+func (u *usageEvidence) scanAuditLogs(ctx context.Context) error {
+	l := ctxzap.Extract(ctx)
+
+	client, err := ogLogs.NewClient(u.config)
+	if err != nil {
+		return err
+	}
+
+	httpClient := u.config.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	marker := u.activityCutoff.UTC().Format(auditLogMarkerLayout)
+	files := 0
+	for marker != "" {
+		list, err := client.ListLogFiles(ctx, &ogLogs.ListLogFilesRequest{
+			Marker: marker,
+			Limit:  auditLogFilesPerPage,
+		})
+		if err != nil {
+			return fmt.Errorf("opsgenie-connector: failed to list log files: %w", translateAPIError(u.failures, err))
+		}
+
+		for _, f := range list.Logs {
+			if err := u.scanAuditLogFile(ctx, client, httpClient, f.FileName); err != nil {
+				return err
+			}
+		}
+
+		files += len(list.Logs)
+		if len(list.Logs) == 0 || list.Marker == marker {
+			break
+		}
+		marker = list.Marker
+	}
+
+	l.Debug("opsgenie-connector: scanned audit logs", zap.Int("log_files", files), zap.Duration("lookback", u.auditLogLookback))
+
+	return nil
+}
+
+func (u *usageEvidence) scanAuditLogFile(ctx context.Context, client *ogLogs.Client, httpClient *http.Client, fileName string) error {
+	link, err := client.GenerateLogFileDownloadLink(ctx, &ogLogs.GenerateLogFileDownloadLinkRequest{FileName: fileName})
+	if err != nil {
+		return fmt.Errorf("opsgenie-connector: failed to get download link of log file %s: %w", fileName, translateAPIError(u.failures, err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSpace(link.LogFileDownloadLink), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("opsgenie-connector: failed to download log file %s: %w", fileName, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("opsgenie-connector: failed to download log file %s: unexpected status %s", fileName, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxAuditLogLineSize)
+	for scanner.Scan() {
+		if username, at, ok := parseAuditLogLine(scanner.Bytes()); ok {
+			u.recordActivity(username, at)
+		}
+	}
+
+	return scanner.Err()
+}
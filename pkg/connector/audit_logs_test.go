@@ -0,0 +1,39 @@
+package connector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseAuditLogLine(t *testing.T) {
+	for name, tc := range map[string]struct {
+		line     string
+		username string
+		at       time.Time
+		ok       bool
+	}{
+		"user entry": {
+			line:     `{"owner":"alice@example.com","date":"2024-06-01T00:10:00.123Z","log":"User alice@example.com logged in."}`,
+			username: "alice@example.com",
+			at:       time.Date(2024, 6, 1, 0, 10, 0, 123000000, time.UTC),
+			ok:       true,
+		},
+		"system entry": {
+			line:     `{"owner":"System","date":"2024-06-01T00:15:00.000Z","log":"Heartbeat [db] expired."}`,
+			username: "System",
+			at:       time.Date(2024, 6, 1, 0, 15, 0, 0, time.UTC),
+			ok:       true,
+		},
+		"no owner":       {line: `{"date":"2024-06-01T00:10:00.000Z","log":"Log file rotated."}`},
+		"no date":        {line: `{"owner":"alice@example.com","log":"User alice@example.com logged in."}`},
+		"malformed date": {line: `{"owner":"alice@example.com","date":"yesterday","log":"User alice@example.com logged in."}`},
+		"not json":       {line: `not json`},
+	} {
+		t.Run(name, func(t *testing.T) {
+			username, at, ok := parseAuditLogLine([]byte(tc.line))
+			if ok != tc.ok || username != tc.username || !at.Equal(tc.at) {
+				t.Errorf("expected (%q, %v, %v), got (%q, %v, %v)", tc.username, tc.at, tc.ok, username, at, ok)
+			}
+		})
+	}
+}
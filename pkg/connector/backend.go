@@ -0,0 +1,44 @@
+package connector
+
+import (
+	"context"
+
+	custom_role "github.com/opsgenie/opsgenie-go-sdk-v2/custom_user_role"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+// Backends the user, team, role and schedule syncers can read from.
+const (
+	backendOpsgenie = "opsgenie"
+	backendJSMOps   = "jsm-ops"
+)
+
+// backend is the API the user, team, role and schedule syncers read from. Every backend returns the
+// Opsgenie SDK types, so the resources are built the same way whichever API they come from, and keep
+// the IDs of the objects they were built from.
+//
+// Errors for HTTP error responses are *ogclient.ApiError, so callers can check the status code.
+type backend interface {
+	// ListUsers returns a page of users starting at offset, and the link to the next page, or an
+	// empty string on the last page.
+	ListUsers(ctx context.Context, offset int) ([]user.User, string, error)
+	GetUser(ctx context.Context, userID string) (*user.User, error)
+
+	ListTeams(ctx context.Context) ([]oteam.ListedTeams, error)
+	// GetTeam returns a team with its members.
+	GetTeam(ctx context.Context, teamID string) (*oteam.GetTeamResult, error)
+
+	// ListCustomRoles returns the custom user roles. The default roles exist in every account and
+	// aren't listed.
+	ListCustomRoles(ctx context.Context) ([]custom_role.CustomUserRole, error)
+
+	// ListSchedules returns all schedules with their rotations.
+	ListSchedules(ctx context.Context) ([]ogSchedule.Schedule, error)
+	GetSchedule(ctx context.Context, scheduleID string) (*ogSchedule.Schedule, error)
+	// ListOnCalls returns who is currently on call for a schedule, without flattening teams and
+	// escalations to their users.
+	ListOnCalls(ctx context.Context, scheduleID, scheduleName string) ([]og.Participant, error)
+}
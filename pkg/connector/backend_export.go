@@ -0,0 +1,236 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	custom_role "github.com/opsgenie/opsgenie-go-sdk-v2/custom_user_role"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+// Subdirectories of an Opsgenie configuration export. Each holds one JSON file per object, in the
+// format the API returns it, optionally wrapped in the "data" envelope of API responses.
+const (
+	exportUsersDir     = "users"
+	exportTeamsDir     = "teams"
+	exportRolesDir     = "custom_user_roles"
+	exportSchedulesDir = "schedules"
+	// exportOnCallsDir holds the on-call response of a schedule, in a file named after the schedule
+	// ID. Exports don't usually include it, schedules without one have nobody on call.
+	exportOnCallsDir = "on-calls"
+)
+
+// exportBackend reads an Opsgenie configuration export from a directory, for offline syncs. The
+// export is loaded once, on first use.
+type exportBackend struct {
+	dir string
+
+	once      sync.Once
+	loadErr   error
+	users     []user.User
+	teams     []oteam.GetTeamResult
+	roles     []custom_role.CustomUserRole
+	schedules []ogSchedule.Schedule
+}
+
+func newExportBackend(dir string) *exportBackend {
+	return &exportBackend{dir: dir}
+}
+
+// readExportObject decodes an exported object, unwrapping the "data" envelope if there is one.
+func readExportObject(path string, out interface{}) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(content, &envelope); err == nil && len(envelope.Data) > 0 {
+		content = envelope.Data
+	}
+
+	if err := json.Unmarshal(content, out); err != nil {
+		return fmt.Errorf("opsgenie-connector: failed to parse export file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// readExportDir decodes every JSON file of an export subdirectory, in file name order. A missing
+// subdirectory means the export has no such objects.
+func readExportDir[T any](dir, name string) ([]T, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, name, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	rv := make([]T, 0, len(paths))
+	for _, path := range paths {
+		var v T
+		if err := readExportObject(path, &v); err != nil {
+			return nil, err
+		}
+		rv = append(rv, v)
+	}
+
+	return rv, nil
+}
+
+func (b *exportBackend) load() error {
+	b.once.Do(func() {
+		info, err := os.Stat(b.dir)
+		if err != nil {
+			b.loadErr = fmt.Errorf("opsgenie-connector: failed to open export directory: %w", err)
+			return
+		}
+		if !info.IsDir() {
+			b.loadErr = fmt.Errorf("opsgenie-connector: export path %s is not a directory", b.dir)
+			return
+		}
+
+		if b.users, b.loadErr = readExportDir[user.User](b.dir, exportUsersDir); b.loadErr != nil {
+			return
+		}
+		if b.teams, b.loadErr = readExportDir[oteam.GetTeamResult](b.dir, exportTeamsDir); b.loadErr != nil {
+			return
+		}
+		if b.roles, b.loadErr = readExportDir[custom_role.CustomUserRole](b.dir, exportRolesDir); b.loadErr != nil {
+			return
+		}
+		b.schedules, b.loadErr = readExportDir[ogSchedule.Schedule](b.dir, exportSchedulesDir)
+	})
+
+	return b.loadErr
+}
+
+// exportNotFound returns the error the API would return for a missing object.
+func exportNotFound(kind, id string) error {
+	return translateAPIError(nil, &ogclient.ApiError{
+		StatusCode: http.StatusNotFound,
+		Message:    fmt.Sprintf("no %s with ID %s in the export", kind, id),
+	})
+}
+
+func (b *exportBackend) ListUsers(_ context.Context, offset int) ([]user.User, string, error) {
+	if err := b.load(); err != nil {
+		return nil, "", err
+	}
+
+	if offset >= len(b.users) {
+		return nil, "", nil
+	}
+
+	end := offset + ResourcesPageSize
+	if end >= len(b.users) {
+		return b.users[offset:], "", nil
+	}
+
+	return b.users[offset:end], "?offset=" + strconv.Itoa(end), nil
+}
+
+func (b *exportBackend) GetUser(_ context.Context, userID string) (*user.User, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	for i := range b.users {
+		if b.users[i].Id == userID {
+			return &b.users[i], nil
+		}
+	}
+
+	return nil, exportNotFound("user", userID)
+}
+
+func (b *exportBackend) ListTeams(_ context.Context) ([]oteam.ListedTeams, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	rv := make([]oteam.ListedTeams, 0, len(b.teams))
+	for _, t := range b.teams {
+		rv = append(rv, oteam.ListedTeams{TeamMeta: t.TeamMeta, Description: t.Description})
+	}
+
+	return rv, nil
+}
+
+func (b *exportBackend) GetTeam(_ context.Context, teamID string) (*oteam.GetTeamResult, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	for i := range b.teams {
+		if b.teams[i].Id == teamID {
+			return &b.teams[i], nil
+		}
+	}
+
+	return nil, exportNotFound("team", teamID)
+}
+
+func (b *exportBackend) ListCustomRoles(_ context.Context) ([]custom_role.CustomUserRole, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	return b.roles, nil
+}
+
+func (b *exportBackend) ListSchedules(_ context.Context) ([]ogSchedule.Schedule, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	return b.schedules, nil
+}
+
+func (b *exportBackend) GetSchedule(_ context.Context, scheduleID string) (*ogSchedule.Schedule, error) {
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+
+	for i := range b.schedules {
+		if b.schedules[i].Id == scheduleID {
+			return &b.schedules[i], nil
+		}
+	}
+
+	return nil, exportNotFound("schedule", scheduleID)
+}
+
+func (b *exportBackend) ListOnCalls(_ context.Context, scheduleID, _ string) ([]og.Participant, error) {
+	// The file name comes from the export, keep it from escaping the on-calls directory.
+	if strings.ContainsAny(scheduleID, `/\`) {
+		return nil, nil
+	}
+
+	var oncalls struct {
+		OnCallParticipants []og.Participant `json:"onCallParticipants"`
+	}
+	err := readExportObject(filepath.Join(b.dir, exportOnCallsDir, scheduleID+".json"), &oncalls)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return oncalls.OnCallParticipants, nil
+}
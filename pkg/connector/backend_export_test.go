@@ -0,0 +1,71 @@
+package connector
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// writeExport writes an export of the tenant served by newTenantServer. The team is wrapped in
+// the "data" envelope of API responses, like some export tools leave it.
+func writeExport(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for path, content := range map[string]string{
+		"users/jane.json": `{"id": "user-1", "username": "jane@example.com", "fullName": "Jane Doe", "role": {"name": "Admin"}}`,
+		"teams/sre.json":  `{"data": {"id": "team-1", "name": "sre", "members": [{"user": {"id": "user-1"}}]}}`,
+		"schedules/primary.json": `{"id": "schedule-1", "name": "primary", "ownerTeam": {"id": "team-1"}, "rotations": [
+			{"participants": [{"type": "user", "id": "user-1"}, {"type": "team", "id": "team-1"}]}
+		]}`,
+		"on-calls/schedule-1.json": `{"onCallParticipants": [{"type": "user", "id": "user-1"}]}`,
+	} {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create export directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("failed to write export file: %v", err)
+		}
+	}
+
+	return dir
+}
+
+func TestExportBackend_MatchesLiveSync(t *testing.T) {
+	live := syncIDs(t, newTestOpsgenieBackend(t, newTenantServer(t).Config()))
+	offline := syncIDs(t, newExportBackend(writeExport(t)))
+
+	if len(live) == 0 || strings.Join(live, "\n") != strings.Join(offline, "\n") {
+		t.Errorf("offline sync differs from live sync:\nlive:\n%s\noffline:\n%s",
+			strings.Join(live, "\n"), strings.Join(offline, "\n"))
+	}
+}
+
+func TestExportBackend_Errors(t *testing.T) {
+	ctx := context.Background()
+
+	b := newExportBackend(writeExport(t))
+	_, _, err := teamBuilder(b, newSyncCache(b)).Get(ctx, &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: "missing"}, nil)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected codes.NotFound, got %v", err)
+	}
+
+	if _, err := newExportBackend(filepath.Join(t.TempDir(), "missing")).ListTeams(ctx); err == nil {
+		t.Error("expected an error for a missing export directory")
+	}
+
+	dir := writeExport(t)
+	if err := os.WriteFile(filepath.Join(dir, "users", "broken.json"), []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to write export file: %v", err)
+	}
+	if _, _, err := newExportBackend(dir).ListUsers(ctx, 0); err == nil || !strings.Contains(err.Error(), "broken.json") {
+		t.Errorf("expected an error naming the broken file, got %v", err)
+	}
+}
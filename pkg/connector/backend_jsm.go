@@ -0,0 +1,461 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	custom_role "github.com/opsgenie/opsgenie-go-sdk-v2/custom_user_role"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+const (
+	jsmDefaultBaseURL = "https://api.atlassian.com"
+
+	// jiraAccountIDDetail is the user detail holding the Atlassian account ID of a user synced from
+	// the jsm-ops backend.
+	jiraAccountIDDetail = "jira_account_id"
+)
+
+// jsmBackend reads from the Jira Service Management Operations REST API, the successor of the
+// Opsgenie API. Teams, schedules and on-calls come from the operations API of the site, users from
+// the Jira platform API since they are Atlassian accounts. Requests are authenticated with the email
+// and API token of an Atlassian account.
+//
+// Jira users carry no operations role, so users synced from this backend have no role. They are
+// identified by the ID of the Opsgenie user with the same email, looked up in the classic API, so that
+// they keep the IDs they had before the migration. Accounts without an Opsgenie user, and every
+// account when there is no classic API client, are identified by their account ID.
+type jsmBackend struct {
+	httpClient    *http.Client
+	baseURL       string
+	cloudID       string
+	email         string
+	apiToken      string
+	opsgenieUsers *user.Client
+
+	mtx sync.Mutex
+	// userIDs maps the account IDs of the accounts with an Opsgenie user to the ID of that user.
+	userIDs map[string]string
+}
+
+func newJSMBackend(httpClient *http.Client, baseURL, cloudID, email, apiToken string, opsgenieUsers *user.Client) *jsmBackend {
+	if baseURL == "" {
+		baseURL = jsmDefaultBaseURL
+	}
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+
+	return &jsmBackend{
+		httpClient:    httpClient,
+		baseURL:       strings.TrimSuffix(baseURL, "/"),
+		cloudID:       cloudID,
+		email:         email,
+		apiToken:      apiToken,
+		opsgenieUsers: opsgenieUsers,
+	}
+}
+
+type jsmPage[T any] struct {
+	Values []T `json:"values"`
+	Links  struct {
+		Next string `json:"next"`
+	} `json:"links"`
+}
+
+type jsmParticipant struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type jsmTeam struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Members     []struct {
+		AccountID string `json:"accountId"`
+		Role      string `json:"role"`
+	} `json:"members"`
+}
+
+type jsmSchedule struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Timezone    string `json:"timezone"`
+	Enabled     bool   `json:"enabled"`
+	TeamID      string `json:"teamId"`
+	Rotations   []struct {
+		ID           string           `json:"id"`
+		Name         string           `json:"name"`
+		Participants []jsmParticipant `json:"participants"`
+	} `json:"rotations"`
+}
+
+type jiraUser struct {
+	AccountID    string `json:"accountId"`
+	AccountType  string `json:"accountType"`
+	DisplayName  string `json:"displayName"`
+	EmailAddress string `json:"emailAddress"`
+	Active       bool   `json:"active"`
+	TimeZone     string `json:"timeZone"`
+	Locale       string `json:"locale"`
+}
+
+func (b *jsmBackend) opsURL(path string, query url.Values) string {
+	u := fmt.Sprintf("%s/jsm/ops/api/%s/v1/%s", b.baseURL, url.PathEscape(b.cloudID), path)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+func (b *jsmBackend) jiraURL(path string, query url.Values) string {
+	u := fmt.Sprintf("%s/ex/jira/%s/rest/api/3/%s", b.baseURL, url.PathEscape(b.cloudID), path)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// get sends a GET request and decodes the JSON response into out. Error responses are returned as
+// *ogclient.ApiError, like the Opsgenie SDK does, translated to the gRPC code of their status.
+func (b *jsmBackend) get(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(b.email, b.apiToken)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		body, _ := io.ReadAll(resp.Body)
+		apiErr := &ogclient.ApiError{StatusCode: resp.StatusCode}
+		if json.Unmarshal(body, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(body))
+		}
+		return &opsgenieAPIError{
+			err:        apiErr,
+			apiErr:     apiErr,
+			endpoint:   endpointTemplate(req.Method, req.URL.Path),
+			retryAfter: retryAfter(resp.Header),
+		}
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// jsmListAll follows the offset pagination of the operations API until the last page.
+func jsmListAll[T any](ctx context.Context, b *jsmBackend, path string, query url.Values) ([]T, error) {
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("size", strconv.Itoa(ResourcesPageSize))
+
+	var rv []T
+	for offset := 0; ; {
+		query.Set("offset", strconv.Itoa(offset))
+
+		var page jsmPage[T]
+		if err := b.get(ctx, b.opsURL(path, query), &page); err != nil {
+			return nil, err
+		}
+
+		rv = append(rv, page.Values...)
+		if page.Links.Next == "" || len(page.Values) == 0 {
+			return rv, nil
+		}
+		offset += len(page.Values)
+	}
+}
+
+// jsmUserID returns the ID of the user of an account.
+func jsmUserID(userIDs map[string]string, accountID string) string {
+	if id, ok := userIDs[accountID]; ok {
+		return id
+	}
+
+	return accountID
+}
+
+func jiraUserToUser(u jiraUser, userIDs map[string]string) user.User {
+	return user.User{
+		Id:       jsmUserID(userIDs, u.AccountID),
+		Username: u.EmailAddress,
+		FullName: u.DisplayName,
+		Blocked:  !u.Active,
+		Verified: u.Active,
+		TimeZone: u.TimeZone,
+		Locale:   u.Locale,
+		Details:  map[string][]string{jiraAccountIDDetail: {u.AccountID}},
+	}
+}
+
+// searchJiraUsers returns a page of the accounts of the site, starting at offset.
+func (b *jsmBackend) searchJiraUsers(ctx context.Context, offset int) ([]jiraUser, error) {
+	var page []jiraUser
+	err := b.get(ctx, b.jiraURL("users/search", url.Values{
+		"startAt":    {strconv.Itoa(offset)},
+		"maxResults": {strconv.Itoa(ResourcesPageSize)},
+	}), &page)
+	if err != nil {
+		return nil, err
+	}
+
+	return page, nil
+}
+
+// userIDMap returns the Opsgenie user IDs of the accounts, keyed by account ID. The map is built on
+// first use and again when reload is set.
+func (b *jsmBackend) userIDMap(ctx context.Context, reload bool) (map[string]string, error) {
+	if b.opsgenieUsers == nil {
+		return nil, nil
+	}
+
+	b.mtx.Lock()
+	defer b.mtx.Unlock()
+
+	if b.userIDs != nil && !reload {
+		return b.userIDs, nil
+	}
+
+	// Opsgenie usernames are the emails of the users, which match the emails of their accounts.
+	opsgenieIDs := make(map[string]string)
+	for offset, more := 0, true; more; {
+		users, err := b.opsgenieUsers.List(ctx, &user.ListRequest{Limit: ResourcesPageSize, Offset: offset})
+		if err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to list opsgenie users: %w", translateAPIError(nil, err))
+		}
+		for _, u := range users.Users {
+			opsgenieIDs[strings.ToLower(u.Username)] = u.Id
+		}
+		if offset, more, err = nextPageOffset(users.Paging.Next); err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to list opsgenie users: %w", err)
+		}
+	}
+
+	userIDs := make(map[string]string)
+	for offset := 0; ; offset += ResourcesPageSize {
+		page, err := b.searchJiraUsers(ctx, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range page {
+			if id, ok := opsgenieIDs[strings.ToLower(u.EmailAddress)]; ok && u.EmailAddress != "" {
+				userIDs[u.AccountID] = id
+			}
+		}
+		if len(page) < ResourcesPageSize {
+			break
+		}
+	}
+	b.userIDs = userIDs
+
+	return userIDs, nil
+}
+
+// ListUsers returns the Atlassian accounts of the site, leaving out app and customer accounts. The
+// first page looks the Opsgenie users up again, so that each sync sees the users added since the last.
+func (b *jsmBackend) ListUsers(ctx context.Context, offset int) ([]user.User, string, error) {
+	userIDs, err := b.userIDMap(ctx, offset == 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	page, err := b.searchJiraUsers(ctx, offset)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rv := make([]user.User, 0, len(page))
+	for _, u := range page {
+		if u.AccountType == "atlassian" {
+			rv = append(rv, jiraUserToUser(u, userIDs))
+		}
+	}
+
+	// The user search has no next link, a full page means there may be more.
+	next := ""
+	if len(page) == ResourcesPageSize {
+		next = "?offset=" + strconv.Itoa(offset+len(page))
+	}
+
+	return rv, next, nil
+}
+
+// GetUser returns the user with the given ID, which is the account ID for accounts without an
+// Opsgenie user.
+func (b *jsmBackend) GetUser(ctx context.Context, userID string) (*user.User, error) {
+	userIDs, err := b.userIDMap(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	accountID := userID
+	for aid, id := range userIDs {
+		if id == userID {
+			accountID = aid
+			break
+		}
+	}
+
+	var u jiraUser
+	if err := b.get(ctx, b.jiraURL("user", url.Values{"accountId": {accountID}}), &u); err != nil {
+		return nil, err
+	}
+
+	rv := jiraUserToUser(u, userIDs)
+	return &rv, nil
+}
+
+func (b *jsmBackend) ListTeams(ctx context.Context) ([]oteam.ListedTeams, error) {
+	teams, err := jsmListAll[jsmTeam](ctx, b, "teams", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]oteam.ListedTeams, 0, len(teams))
+	for _, t := range teams {
+		rv = append(rv, oteam.ListedTeams{
+			TeamMeta:    oteam.TeamMeta{Id: t.ID, Name: t.Name},
+			Description: t.Description,
+		})
+	}
+
+	return rv, nil
+}
+
+func (b *jsmBackend) GetTeam(ctx context.Context, teamID string) (*oteam.GetTeamResult, error) {
+	var t jsmTeam
+	if err := b.get(ctx, b.opsURL("teams/"+url.PathEscape(teamID), nil), &t); err != nil {
+		return nil, err
+	}
+
+	userIDs, err := b.userIDMap(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := &oteam.GetTeamResult{
+		TeamMeta:    oteam.TeamMeta{Id: t.ID, Name: t.Name},
+		Description: t.Description,
+	}
+	for _, m := range t.Members {
+		rv.Members = append(rv.Members, oteam.Member{User: oteam.User{ID: jsmUserID(userIDs, m.AccountID)}, Role: m.Role})
+	}
+
+	return rv, nil
+}
+
+// ListCustomRoles returns no roles, users of the operations API carry no role to grant.
+func (b *jsmBackend) ListCustomRoles(_ context.Context) ([]custom_role.CustomUserRole, error) {
+	return nil, nil
+}
+
+// jsmParticipantToParticipant returns a participant with users identified by their user ID.
+func jsmParticipantToParticipant(p jsmParticipant, userIDs map[string]string) og.Participant {
+	rv := og.Participant{Type: og.ParticipantType(p.Type), Id: p.ID, Name: p.Name}
+	if rv.Type == og.User {
+		rv.Id = jsmUserID(userIDs, p.ID)
+	}
+
+	return rv
+}
+
+func jsmScheduleToSchedule(s jsmSchedule, userIDs map[string]string) ogSchedule.Schedule {
+	rv := ogSchedule.Schedule{
+		Id:          s.ID,
+		Name:        s.Name,
+		Description: s.Description,
+		Timezone:    s.Timezone,
+		Enabled:     s.Enabled,
+	}
+
+	if s.TeamID != "" {
+		rv.OwnerTeam = &og.OwnerTeam{Id: s.TeamID}
+	}
+
+	for _, r := range s.Rotations {
+		rotation := og.Rotation{Id: r.ID, Name: r.Name}
+		for _, p := range r.Participants {
+			rotation.Participants = append(rotation.Participants, jsmParticipantToParticipant(p, userIDs))
+		}
+		rv.Rotations = append(rv.Rotations, rotation)
+	}
+
+	return rv
+}
+
+func (b *jsmBackend) ListSchedules(ctx context.Context) ([]ogSchedule.Schedule, error) {
+	schedules, err := jsmListAll[jsmSchedule](ctx, b, "schedules", url.Values{"expand": {"rotation"}})
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs, err := b.userIDMap(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]ogSchedule.Schedule, 0, len(schedules))
+	for _, s := range schedules {
+		rv = append(rv, jsmScheduleToSchedule(s, userIDs))
+	}
+
+	return rv, nil
+}
+
+func (b *jsmBackend) GetSchedule(ctx context.Context, scheduleID string) (*ogSchedule.Schedule, error) {
+	var s jsmSchedule
+	if err := b.get(ctx, b.opsURL("schedules/"+url.PathEscape(scheduleID), url.Values{"expand": {"rotation"}}), &s); err != nil {
+		return nil, err
+	}
+
+	userIDs, err := b.userIDMap(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := jsmScheduleToSchedule(s, userIDs)
+	return &rv, nil
+}
+
+// ListOnCalls looks the schedule up by ID, the operations API has no lookup by name.
+func (b *jsmBackend) ListOnCalls(ctx context.Context, scheduleID, _ string) ([]og.Participant, error) {
+	var oncalls struct {
+		OnCallParticipants []jsmParticipant `json:"onCallParticipants"`
+	}
+	if err := b.get(ctx, b.opsURL("schedules/"+url.PathEscape(scheduleID)+"/on-calls", nil), &oncalls); err != nil {
+		return nil, err
+	}
+
+	userIDs, err := b.userIDMap(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]og.Participant, 0, len(oncalls.OnCallParticipants))
+	for _, p := range oncalls.OnCallParticipants {
+		rv = append(rv, jsmParticipantToParticipant(p, userIDs))
+	}
+
+	return rv, nil
+}
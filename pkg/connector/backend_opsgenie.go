@@ -0,0 +1,183 @@
+package connector
+
+import (
+	"context"
+
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	custom_role "github.com/opsgenie/opsgenie-go-sdk-v2/custom_user_role"
+	ogEscalation "github.com/opsgenie/opsgenie-go-sdk-v2/escalation"
+	ogHeartbeat "github.com/opsgenie/opsgenie-go-sdk-v2/heartbeat"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	ogService "github.com/opsgenie/opsgenie-go-sdk-v2/service"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+// opsgenieBackend reads from the classic Opsgenie REST API through the Opsgenie SDK. It also holds
+// the clients of the forwarding rule, heartbeat, escalation and service syncers, which only exist
+// in the classic API.
+//
+// The SDK clients are built once: building one writes SDK globals, so building them per call races
+// when teams are prefetched in parallel.
+type opsgenieBackend struct {
+	users       *user.Client
+	teams       *oteam.Client
+	customRoles *custom_role.Client
+	schedules   *ogSchedule.Client
+	heartbeats  *ogHeartbeat.Client
+	escalations *ogEscalation.Client
+	services    *ogService.Client
+	failures    *failureLog
+}
+
+func newOpsgenieBackend(config *ogclient.Config, failures *failureLog) (*opsgenieBackend, error) {
+	users, err := user.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	teams, err := oteam.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	customRoles, err := custom_role.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	schedules, err := ogSchedule.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	heartbeats, err := ogHeartbeat.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	escalations, err := ogEscalation.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	services, err := ogService.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &opsgenieBackend{
+		users:       users,
+		teams:       teams,
+		customRoles: customRoles,
+		schedules:   schedules,
+		heartbeats:  heartbeats,
+		escalations: escalations,
+		services:    services,
+		failures:    failures,
+	}, nil
+}
+
+func (b *opsgenieBackend) ListUsers(ctx context.Context, offset int) ([]user.User, string, error) {
+	users, err := b.users.List(ctx, &user.ListRequest{
+		Limit:  ResourcesPageSize,
+		Offset: offset,
+	})
+	if err != nil {
+		return nil, "", translateAPIError(b.failures, err)
+	}
+
+	return users.Users, users.Paging.Next, nil
+}
+
+func (b *opsgenieBackend) GetUser(ctx context.Context, userID string) (*user.User, error) {
+	u, err := b.users.Get(ctx, &user.GetRequest{Identifier: userID})
+	if err != nil {
+		return nil, translateAPIError(b.failures, err)
+	}
+
+	return &user.User{
+		Id:          u.Id,
+		Username:    u.Username,
+		FullName:    u.FullName,
+		Role:        u.Role,
+		Blocked:     u.Blocked,
+		Verified:    u.Verified,
+		UserAddress: u.UserAddress,
+		Tags:        u.Tags,
+		Details:     u.Details,
+		TimeZone:    u.TimeZone,
+		Locale:      u.Locale,
+		CreatedAt:   u.CreatedAt,
+	}, nil
+}
+
+func (b *opsgenieBackend) ListTeams(ctx context.Context) ([]oteam.ListedTeams, error) {
+	teams, err := b.teams.List(ctx, &oteam.ListTeamRequest{BaseRequest: ogclient.BaseRequest{}})
+	if err != nil {
+		return nil, translateAPIError(b.failures, err)
+	}
+
+	return teams.Teams, nil
+}
+
+func (b *opsgenieBackend) GetTeam(ctx context.Context, teamID string) (*oteam.GetTeamResult, error) {
+	team, err := b.teams.Get(ctx, &oteam.GetTeamRequest{
+		IdentifierValue: teamID,
+		IdentifierType:  oteam.Identifier(idIdentifierType),
+	})
+	if err != nil {
+		return nil, translateAPIError(b.failures, err)
+	}
+
+	return team, nil
+}
+
+func (b *opsgenieBackend) ListCustomRoles(ctx context.Context) ([]custom_role.CustomUserRole, error) {
+	roles, err := b.customRoles.List(ctx, &custom_role.ListRequest{BaseRequest: ogclient.BaseRequest{}})
+	if err != nil {
+		return nil, translateAPIError(b.failures, err)
+	}
+
+	return roles.CustomUserRoles, nil
+}
+
+func (b *opsgenieBackend) ListSchedules(ctx context.Context) ([]ogSchedule.Schedule, error) {
+	expand := true
+	schedules, err := b.schedules.List(ctx, &ogSchedule.ListRequest{
+		BaseRequest: ogclient.BaseRequest{},
+		Expand:      &expand,
+	})
+	if err != nil {
+		return nil, translateAPIError(b.failures, err)
+	}
+
+	return schedules.Schedule, nil
+}
+
+func (b *opsgenieBackend) GetSchedule(ctx context.Context, scheduleID string) (*ogSchedule.Schedule, error) {
+	result, err := b.schedules.Get(ctx, &ogSchedule.GetRequest{
+		IdentifierType:  ogSchedule.Id,
+		IdentifierValue: scheduleID,
+	})
+	if err != nil {
+		return nil, translateAPIError(b.failures, err)
+	}
+
+	return &result.Schedule, nil
+}
+
+// ListOnCalls looks the schedule up by name, the identifier the on-call endpoint expects by default.
+func (b *opsgenieBackend) ListOnCalls(ctx context.Context, _, scheduleName string) ([]og.Participant, error) {
+	flat := false
+	oncalls, err := b.schedules.GetOnCalls(ctx, &ogSchedule.GetOnCallsRequest{
+		BaseRequest:        ogclient.BaseRequest{},
+		Flat:               &flat,
+		ScheduleIdentifier: scheduleName,
+	})
+	if err != nil {
+		return nil, translateAPIError(b.failures, err)
+	}
+
+	rv := make([]og.Participant, 0, len(oncalls.OnCallParticipants))
+	for _, p := range oncalls.OnCallParticipants {
+		rv = append(rv, og.Participant{Type: p.Type, Name: p.Name, Id: p.Id})
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,260 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The servers below serve the same tenant: user-1, member of team-1, which owns the primary schedule.
+// user-1 and team-1 are in its rotation, and user-1 is on call. After migration, user-1 is the
+// Atlassian account jsmAccountID.
+
+// newTenantServer serves the tenant from a fake of the classic Opsgenie API.
+func newTenantServer(t *testing.T) *opsgenietest.Server {
+	t.Helper()
+
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1", Username: "jane@example.com", FullName: "Jane Doe", Role: "Admin"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "sre", Members: []opsgenietest.Member{{UserID: "user-1"}}})
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:          "schedule-1",
+		Name:        "primary",
+		OwnerTeamID: "team-1",
+		Rotations: []opsgenietest.Rotation{{Participants: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-1"},
+			{Type: opsgenietest.TeamParticipant, ID: "team-1"},
+		}}},
+		OnCall: []opsgenietest.Participant{{Type: opsgenietest.UserParticipant, ID: "user-1"}},
+	})
+
+	return srv
+}
+
+const jsmAccountID = "557058:f3a1c2d4"
+
+// newJSMMockServer serves the tenant from the Jira Service Management Operations API, after migration.
+// The site also has an app account, which isn't a user.
+func newJSMMockServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if email, token, ok := r.BasicAuth(); !ok || email != "admin@example.com" || token != "test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		ops := "/jsm/ops/api/cloud-1/v1/"
+		switch r.URL.Path {
+		case "/ex/jira/cloud-1/rest/api/3/user":
+			if r.URL.Query().Get("accountId") != jsmAccountID {
+				writeOpsgenieJSON(t, w, http.StatusNotFound, map[string]interface{}{"message": "not found"})
+				return
+			}
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"accountId": jsmAccountID, "accountType": "atlassian", "displayName": "Jane Doe", "emailAddress": "jane@example.com", "active": true})
+		case "/ex/jira/cloud-1/rest/api/3/users/search":
+			writeJSONArray(t, w, []interface{}{
+				map[string]interface{}{"accountId": jsmAccountID, "accountType": "atlassian", "displayName": "Jane Doe", "emailAddress": "jane@example.com", "active": true},
+				map[string]interface{}{"accountId": "app-1", "accountType": "app", "displayName": "Automation", "active": true},
+			})
+		case ops + "teams":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"values": []interface{}{
+				map[string]interface{}{"id": "team-1", "name": "sre"},
+			}})
+		case ops + "teams/team-1":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"id":      "team-1",
+				"name":    "sre",
+				"members": []interface{}{map[string]interface{}{"accountId": jsmAccountID}},
+			})
+		case ops + "schedules":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"values": []interface{}{
+				map[string]interface{}{
+					"id":     "schedule-1",
+					"name":   "primary",
+					"teamId": "team-1",
+					"rotations": []interface{}{map[string]interface{}{"participants": []interface{}{
+						map[string]interface{}{"type": "user", "id": jsmAccountID},
+						map[string]interface{}{"type": "team", "id": "team-1"},
+					}}},
+				},
+			}})
+		case ops + "schedules/schedule-1/on-calls":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"onCallParticipants": []interface{}{map[string]interface{}{"type": "user", "id": jsmAccountID}},
+			})
+		default:
+			writeOpsgenieJSON(t, w, http.StatusNotFound, map[string]interface{}{"message": "not found"})
+		}
+	}))
+}
+
+// writeJSONArray writes a JSON array response, like the Jira platform API returns for searches.
+func writeJSONArray(t *testing.T, w http.ResponseWriter, body []interface{}) {
+	t.Helper()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		t.Errorf("failed to encode response: %v", err)
+	}
+}
+
+// newTestJSMBackend returns a backend reading from srv. With a classic API server, users are
+// identified by their Opsgenie user IDs.
+func newTestJSMBackend(t *testing.T, srv *httptest.Server, classic *opsgenietest.Server) *jsmBackend {
+	t.Helper()
+
+	var opsgenieUsers *user.Client
+	if classic != nil {
+		opsgenieUsers = newTestOpsgenieBackend(t, classic.Config()).users
+	}
+
+	return newJSMBackend(srv.Client(), srv.URL, "cloud-1", "admin@example.com", "test-token", opsgenieUsers)
+}
+
+// syncIDs lists the users, teams and schedules of a backend and the grants of the teams and
+// schedules, and returns the IDs of all of them.
+func syncIDs(t *testing.T, b backend) []string {
+	t.Helper()
+
+	ctx := context.Background()
+	cache := newSyncCache(b)
+
+	var ids []string
+	for _, syncer := range []interface {
+		List(context.Context, *v2.ResourceId, rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error)
+		Grants(context.Context, *v2.Resource, rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error)
+	}{
+		teamBuilder(b, cache),
+		userBuilder(nil, nil, b, nil, "", false),
+		scheduleBuilder(nil, nil, b, cache, false),
+	} {
+		resources, _, err := syncer.List(ctx, nil, rs.SyncOpAttrs{})
+		if err != nil {
+			t.Fatalf("unexpected error listing resources: %v", err)
+		}
+
+		for _, r := range resources {
+			ids = append(ids, r.GetId().GetResourceType()+":"+r.GetId().GetResource())
+
+			grants, _, err := syncer.Grants(ctx, r, rs.SyncOpAttrs{})
+			if err != nil {
+				t.Fatalf("unexpected error listing grants of %s: %v", r.GetId().GetResource(), err)
+			}
+			for _, g := range grants {
+				ids = append(ids, g.GetId())
+			}
+		}
+	}
+	sort.Strings(ids)
+
+	return ids
+}
+
+func TestBackends_StableResourceIDs(t *testing.T) {
+	classic := newTenantServer(t)
+	jsm := newJSMMockServer(t)
+	defer jsm.Close()
+
+	before := syncIDs(t, newTestOpsgenieBackend(t, classic.Config()))
+	after := syncIDs(t, newTestJSMBackend(t, jsm, classic))
+
+	if len(before) == 0 || strings.Join(before, "\n") != strings.Join(after, "\n") {
+		t.Errorf("resource and grant IDs changed between backends:\nopsgenie:\n%s\njsm-ops:\n%s",
+			strings.Join(before, "\n"), strings.Join(after, "\n"))
+	}
+}
+
+func TestJSMBackend_UserIDs(t *testing.T) {
+	classic := newTenantServer(t)
+	jsm := newJSMMockServer(t)
+	defer jsm.Close()
+
+	ctx := context.Background()
+	b := newTestJSMBackend(t, jsm, classic)
+
+	users, _, err := b.ListUsers(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 1 || users[0].Id != "user-1" {
+		t.Fatalf("expected user-1 with its Opsgenie user ID, got %v", users)
+	}
+
+	u, err := b.GetUser(ctx, "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ur, err := userResource(ctx, *u, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ur.GetId().GetResource() != "user-1" {
+		t.Errorf("expected user-1, got %s", ur.GetId().GetResource())
+	}
+	if v, _ := rs.GetProfileStringValue(rs.GetProfile(ur), detailProfileKey(jiraAccountIDDetail)); v != jsmAccountID {
+		t.Errorf("expected the account ID in the profile, got %q", v)
+	}
+
+	// Without the classic API, users are identified by their account ID.
+	users, _, err = newTestJSMBackend(t, jsm, nil).ListUsers(ctx, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(users) != 1 || users[0].Id != jsmAccountID {
+		t.Errorf("expected the account ID as user ID, got %v", users)
+	}
+}
+
+func TestJSMBackend_RoleGrants(t *testing.T) {
+	srv := newJSMMockServer(t)
+	defer srv.Close()
+
+	b := newTestJSMBackend(t, srv, nil)
+	roles, _, err := roleBuilder(b, newSyncCache(b)).List(context.Background(), nil, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only the default roles exist, and Atlassian accounts hold none of them.
+	if len(roles) != len(defaultRoles) {
+		t.Errorf("expected the %d default roles, got %d", len(defaultRoles), len(roles))
+	}
+	for _, r := range roles {
+		grants, _, err := roleBuilder(b, newSyncCache(b)).Grants(context.Background(), r, rs.SyncOpAttrs{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(grants) != 0 {
+			t.Errorf("expected no grants for %s, got %v", r.DisplayName, grants)
+		}
+	}
+}
+
+func TestJSMBackend_Errors(t *testing.T) {
+	srv := newJSMMockServer(t)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	_, _, err := scheduleBuilder(nil, nil, newTestJSMBackend(t, srv, nil), nil, false).Get(ctx, &v2.ResourceId{ResourceType: resourceTypeSchedule.Id, Resource: "missing"}, nil)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected codes.NotFound, got %v", err)
+	}
+
+	unauthorized := newJSMBackend(srv.Client(), srv.URL, "cloud-1", "admin@example.com", "wrong-token", nil)
+	if _, err := unauthorized.ListTeams(ctx); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected a 401 error, got %v", err)
+	}
+}
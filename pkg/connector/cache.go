@@ -0,0 +1,328 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+	"go.uber.org/zap"
+)
+
+// teamPrefetchConcurrency bounds the number of team details fetched at the same time.
+const teamPrefetchConcurrency = 8
+
+// syncCache holds the user and team details fetched during a sync, so that builders can share them
+// instead of calling the API again. It is safe for concurrent use. The operations of a sync scope it
+// by sync ID, which drops what a previous sync cached. Get has no sync ID and builds its own lookups.
+type syncCache struct {
+	backend backend
+	// unfiltered caches the objects of the backend without its filter, for what has to account for
+	// filtered out objects too. It is the cache itself for an unfiltered backend.
+	unfiltered *syncCache
+	// usage is the usage evidence of the sync, collected again after a reset.
+	usage *usageEvidence
+	// sessionStore is whether the sync has a session store to share lookups between syncers.
+	sessionStore bool
+
+	mtx sync.Mutex
+	// syncID is the sync the cache holds the objects of.
+	syncID      string
+	teams       map[string]*oteam.GetTeamResult
+	teamIDs     map[string]bool
+	users       []user.User
+	usersLoaded bool
+	onCalls     map[string][]og.Participant
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func newSyncCache(b backend) *syncCache {
+	c := &syncCache{
+		backend: b,
+		teams:   make(map[string]*oteam.GetTeamResult),
+		onCalls: make(map[string][]og.Participant),
+	}
+
+	c.unfiltered = c
+	if fb, ok := b.(*filteredBackend); ok {
+		c.unfiltered = newSyncCache(fb.backend)
+	}
+
+	return c
+}
+
+// Reset drops everything cached by the previous sync.
+func (c *syncCache) Reset() {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.teams = make(map[string]*oteam.GetTeamResult)
+	c.teamIDs = nil
+	c.users = nil
+	c.usersLoaded = false
+	c.onCalls = make(map[string][]og.Participant)
+	c.hits.Store(0)
+	c.misses.Store(0)
+	c.usage.Reset()
+
+	if fb, ok := c.backend.(*filteredBackend); ok {
+		fb.filter.Reset()
+		c.unfiltered.Reset()
+	}
+}
+
+// scope drops the cache of a previous sync when opts belong to another sync. Operations without a
+// sync ID keep the cache.
+func (c *syncCache) scope(opts rs.SyncOpAttrs) {
+	if opts.SyncID == "" {
+		return
+	}
+
+	c.mtx.Lock()
+	stale := c.syncID != opts.SyncID
+	c.syncID = opts.SyncID
+	c.mtx.Unlock()
+
+	if stale {
+		c.Reset()
+	}
+}
+
+// record counts a cache lookup and logs the running hit rate.
+func (c *syncCache) record(ctx context.Context, kind string, hit bool) {
+	if hit {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+
+	hits, misses := c.hits.Load(), c.misses.Load()
+	ctxzap.Extract(ctx).Debug("opsgenie-connector: cache lookup",
+		zap.String("kind", kind),
+		zap.Bool("hit", hit),
+		zap.Int64("hits", hits),
+		zap.Int64("misses", misses),
+		zap.Float64("hit_rate", float64(hits)/float64(hits+misses)),
+	)
+}
+
+func fetchTeam(ctx context.Context, b backend, teamID string) (*oteam.GetTeamResult, error) {
+	t, err := b.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to get team %s: %w", teamID, err)
+	}
+
+	return t, nil
+}
+
+// Team returns the details of a team, fetching them on a cache miss.
+func (c *syncCache) Team(ctx context.Context, teamID string) (*oteam.GetTeamResult, error) {
+	c.mtx.Lock()
+	t, ok := c.teams[teamID]
+	c.mtx.Unlock()
+
+	c.record(ctx, "team", ok)
+	if ok {
+		return t, nil
+	}
+
+	t, err := fetchTeam(ctx, c.backend, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	c.teams[teamID] = t
+	c.mtx.Unlock()
+
+	return t, nil
+}
+
+// PrefetchTeams fetches the details of the given teams in parallel, at most teamPrefetchConcurrency
+// at a time. It stops at the first error and returns it; teams fetched until then stay cached.
+func (c *syncCache) PrefetchTeams(ctx context.Context, teamIDs []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	sem := make(chan struct{}, teamPrefetchConcurrency)
+	for _, teamID := range teamIDs {
+		if ctx.Err() != nil {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(teamID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			t, err := fetchTeam(ctx, c.backend, teamID)
+			if err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+
+			c.mtx.Lock()
+			c.teams[teamID] = t
+			c.mtx.Unlock()
+		}(teamID)
+	}
+	wg.Wait()
+
+	return firstErr
+}
+
+// OnCalls returns the current on-call participants of a schedule, fetching them on a cache miss.
+// Listing schedules fetches them to assess the schedule risks, listing grants reuses them.
+func (c *syncCache) OnCalls(ctx context.Context, scheduleID, scheduleName string) ([]og.Participant, error) {
+	c.mtx.Lock()
+	participants, ok := c.onCalls[scheduleID]
+	c.mtx.Unlock()
+
+	c.record(ctx, "on_calls", ok)
+	if ok {
+		return participants, nil
+	}
+
+	var err error
+	if fb, ok := c.backend.(*filteredBackend); ok {
+		// The unfiltered on-calls are cached for the schedule risks, the filter is applied to them.
+		participants, err = c.unfiltered.OnCalls(ctx, scheduleID, scheduleName)
+		if err == nil {
+			participants, err = fb.filter.keepParticipants(ctx, participants)
+		}
+	} else {
+		participants, err = c.backend.ListOnCalls(ctx, scheduleID, scheduleName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.mtx.Lock()
+	c.onCalls[scheduleID] = participants
+	c.mtx.Unlock()
+
+	return participants, nil
+}
+
+// SetTeamIDs records the IDs of all teams of the account.
+func (c *syncCache) SetTeamIDs(teamIDs []string) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.teamIDs = make(map[string]bool, len(teamIDs))
+	for _, id := range teamIDs {
+		c.teamIDs[id] = true
+	}
+}
+
+// TeamIDs returns the IDs of all teams of the account, listing them if the team syncer hasn't yet.
+func (c *syncCache) TeamIDs(ctx context.Context) (map[string]bool, error) {
+	c.mtx.Lock()
+	teamIDs := c.teamIDs
+	c.mtx.Unlock()
+
+	c.record(ctx, "team_ids", teamIDs != nil)
+	if teamIDs != nil {
+		return teamIDs, nil
+	}
+
+	teams, err := c.backend.ListTeams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to list teams: %w", err)
+	}
+
+	ids := make([]string, 0, len(teams))
+	for _, t := range teams {
+		ids = append(ids, t.Id)
+	}
+	c.SetTeamIDs(ids)
+
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	return c.teamIDs, nil
+}
+
+// TeamMembers returns the user IDs of the members of every cached team, keyed by team ID.
+func (c *syncCache) TeamMembers() map[string][]string {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	rv := make(map[string][]string, len(c.teams))
+	for id, t := range c.teams {
+		rv[id] = teamMemberIDs(t)
+	}
+
+	return rv
+}
+
+func teamMemberIDs(t *oteam.GetTeamResult) []string {
+	rv := make([]string, 0, len(t.Members))
+	for _, m := range t.Members {
+		rv = append(rv, m.User.ID)
+	}
+
+	return rv
+}
+
+// Users returns all users of the account, listing them on the first call.
+func (c *syncCache) Users(ctx context.Context) ([]user.User, error) {
+	// The lock is held while listing so that concurrent callers wait for a single listing.
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.record(ctx, "users", c.usersLoaded)
+	if c.usersLoaded {
+		return c.users, nil
+	}
+
+	var rv []user.User
+	for offset, more := 0, true; more; {
+		users, next, err := c.backend.ListUsers(ctx, offset)
+		if err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to list users: %w", err)
+		}
+
+		rv = append(rv, users...)
+		if offset, more, err = nextPageOffset(next); err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to list users: %w", err)
+		}
+	}
+
+	c.users = rv
+	c.usersLoaded = true
+
+	return rv, nil
+}
+
+// UserIDs returns the IDs of all users of the account.
+func (c *syncCache) UserIDs(ctx context.Context) (map[string]bool, error) {
+	users, err := c.Users(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(map[string]bool, len(users))
+	for _, u := range users {
+		rv[u.Id] = true
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,180 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+)
+
+// newTeamsTenant serves a team list of the given size, every team with one member.
+func newTeamsTenant(tb testing.TB, count int) *opsgenietest.Server {
+	tb.Helper()
+
+	srv := opsgenietest.NewServer(tb)
+	for i := 0; i < count; i++ {
+		id := fmt.Sprintf("team-%d", i)
+		srv.AddUser(opsgenietest.User{ID: "user-" + id, Username: id + "@example.com"})
+		srv.AddTeam(opsgenietest.Team{ID: id, Name: fmt.Sprintf("team %d", i), Members: []opsgenietest.Member{{UserID: "user-" + id}}})
+	}
+
+	return srv
+}
+
+// teamGets counts the team detail requests the fake served.
+func teamGets(srv *opsgenietest.Server) int {
+	rv := 0
+	for _, r := range srv.Requests() {
+		if strings.HasPrefix(r, "GET /v2/teams/") {
+			rv++
+		}
+	}
+
+	return rv
+}
+
+// syncTeams lists the teams and the grants of each of them, the way a sync does.
+func syncTeams(ctx context.Context, b *teamResourceType) (int, error) {
+	teams, _, err := b.List(ctx, nil, res.SyncOpAttrs{})
+	if err != nil {
+		return 0, err
+	}
+
+	grants := 0
+	for _, t := range teams {
+		g, _, err := b.Grants(ctx, t, res.SyncOpAttrs{})
+		if err != nil {
+			return 0, err
+		}
+		grants += len(g)
+	}
+
+	return grants, nil
+}
+
+func TestTeamGrants_UsesPrefetchedTeams(t *testing.T) {
+	srv := newTeamsTenant(t, 50)
+	config := srv.Config()
+	b := newTestOpsgenieBackend(t, config)
+	cache := newSyncCache(b)
+
+	grants, err := syncTeams(context.Background(), teamBuilder(b, cache))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if grants != 50 {
+		t.Errorf("expected 50 grants, got %d", grants)
+	}
+	if got := teamGets(srv); got != 50 {
+		t.Errorf("expected each team to be fetched once, got %d requests", got)
+	}
+	if cache.hits.Load() != 50 || cache.misses.Load() != 0 {
+		t.Errorf("expected 50 hits and no misses, got %d hits and %d misses", cache.hits.Load(), cache.misses.Load())
+	}
+}
+
+func TestRoleGrants_ListUsersOnce(t *testing.T) {
+	var userLists atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/users/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		userLists.Add(1)
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"id": "user-1", "username": "a@example.com", "role": map[string]interface{}{"id": "Admin", "name": "Admin"}},
+				{"id": "user-2", "username": "b@example.com", "role": map[string]interface{}{"id": "User", "name": "User"}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	ob := newTestOpsgenieBackend(t, config)
+	b := roleBuilder(ob, newSyncCache(ob))
+
+	for _, role := range []string{"Admin", "User"} {
+		r, err := roleResource(context.Background(), role, defaultRoles[role])
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		grants, _, err := b.Grants(context.Background(), r, res.SyncOpAttrs{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(grants) != 1 || grants[0].GetPrincipal().GetId().GetResource() == "" {
+			t.Errorf("expected one grant for %s, got %v", role, grants)
+		}
+	}
+
+	if userLists.Load() != 1 {
+		t.Errorf("expected users to be listed once, got %d requests", userLists.Load())
+	}
+}
+
+func BenchmarkTeamSync(b *testing.B) {
+	config := newTeamsTenant(b, 5000).Config()
+	ob := newTestOpsgenieBackend(b, config)
+	builder := teamBuilder(ob, newSyncCache(ob))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := syncTeams(context.Background(), builder); err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestTeamGrants_NewSyncDropsCachedMembers(t *testing.T) {
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1", Username: "jane@example.com"})
+	srv.AddUser(opsgenietest.User{ID: "user-2", Username: "john@example.com"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "sre", Members: []opsgenietest.Member{{UserID: "user-1"}}})
+
+	b := newTestOpsgenieBackend(t, srv.Config())
+	builder := teamBuilder(b, newSyncCache(b))
+	ctx := context.Background()
+
+	teams, _, err := builder.List(ctx, nil, res.SyncOpAttrs{SyncID: "sync-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	grants, _, err := builder.Grants(ctx, teams[0], res.SyncOpAttrs{SyncID: "sync-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(grants) != 1 {
+		t.Fatalf("expected 1 grant, got %d", len(grants))
+	}
+
+	teamClient, err := oteam.NewClient(srv.Config())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := teamClient.AddMember(ctx, &oteam.AddTeamMemberRequest{
+		TeamIdentifierType:  oteam.Id,
+		TeamIdentifierValue: "team-1",
+		User:                oteam.User{ID: "user-2"},
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A targeted sync lists the grants of the team without listing teams first.
+	grants, _, err = builder.Grants(ctx, teams[0], res.SyncOpAttrs{SyncID: "sync-2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(grants) != 2 {
+		t.Errorf("expected the grants of the new sync to include the new member, got %d", len(grants))
+	}
+}
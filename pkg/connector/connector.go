@@ -2,20 +2,26 @@ package connector
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"math"
 	"net/http"
 	"time"
 
 	zaphook "github.com/Sytten/logrus-zap-hook"
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
 	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/metrics"
+	"github.com/conductorone/baton-sdk/pkg/types/sessions"
 	"github.com/conductorone/baton-sdk/pkg/uhttp"
 	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
 	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
 	"go.uber.org/zap"
 )
 
@@ -45,20 +51,91 @@ var (
 			v2.ResourceType_TRAIT_GROUP,
 		},
 	}
+	resourceTypeForwardingRule = &v2.ResourceType{
+		Id:          "forwarding-rule",
+		DisplayName: "Forwarding Rule",
+	}
+	resourceTypeHeartbeat = &v2.ResourceType{
+		Id:          "heartbeat",
+		DisplayName: "Heartbeat",
+		Annotations: annotationsForHeartbeatResourceType(),
+	}
+	resourceTypeEscalation = &v2.ResourceType{
+		Id:          "escalation",
+		DisplayName: "Escalation",
+	}
+	resourceTypeService = &v2.ResourceType{
+		Id:          "service",
+		DisplayName: "Service",
+		Annotations: annotationsForServiceResourceType(),
+	}
+	resourceTypeUnknownPrincipal = &v2.ResourceType{
+		Id:          "unknown-principal",
+		DisplayName: "Unknown Principal",
+		Annotations: annotationsForUnknownPrincipalResourceType(),
+	}
+	resourceTypeAccount = &v2.ResourceType{
+		Id:          "account",
+		DisplayName: "Account",
+		Annotations: annotationsForAccountResourceType(),
+	}
 )
 
+// apiRetryCount is how many times the SDK retries a rate limited or failed request.
+const apiRetryCount = 20
+
 type Opsgenie struct {
-	config *ogclient.Config
-	apiKey string
+	config   *ogclient.Config
+	failures *failureLog
+	apiKey   string
+	backend  backend
+	filter   *resourceFilter
+
+	dryRunProvisioning bool
+
+	ticketTeam     string
+	ticketPriority string
+	ticketTags     []string
+
+	usageEvidence       *usageEvidence
+	employeeIDDetailKey string
+
+	cache *syncCache
+
+	// accounts are the accounts of a multi-account configuration, synced by their own connectors.
+	accounts []*opsgenieAccount
 }
 
-func New(ctx context.Context, apiKey string, baseURL string) (*Opsgenie, error) {
+func New(ctx context.Context, opsgenieConfig *cfg.Opsgenie) (*Opsgenie, error) {
+	if len(opsgenieConfig.Accounts) > 0 {
+		if opsgenieConfig.ApiKey != "" || opsgenieConfig.ExportDir != "" {
+			return nil, errors.New("opsgenie-connector: accounts can't be used with api-key or export-dir")
+		}
+
+		return newMultiAccount(ctx, opsgenieConfig)
+	}
+
+	apiKey := opsgenieConfig.ApiKey
+	baseURL := opsgenieConfig.BaseUrl
+
 	l := ctxzap.Extract(ctx)
 	httpClient, err := uhttp.NewClient(ctx, uhttp.WithLogger(true, l))
 	if err != nil {
 		return nil, err
 	}
 
+	// Read-only mode is enforced below every API client of the connector, including the actions.
+	if opsgenieConfig.ReadOnly {
+		httpClient.Transport = newReadOnlyTransport(httpClient.Transport)
+	}
+	// Failed responses are recorded so that API errors can name the endpoint they come from.
+	failures := newFailureLog()
+	httpClient.Transport = newAPIErrorTransport(httpClient.Transport, failures)
+
+	// Every API request is traced and measured, including the retries the SDK makes on its own.
+	metricsHandler := metrics.NewOtelHandler(ctx, otel.GetMeterProvider(), telemetryName)
+	httpClient.Transport = newTelemetryTransport(httpClient.Transport, otel.GetTracerProvider(), metricsHandler, apiRetryCount)
+
 	// OpsGenie client takes a logrus logger, but we use zap.
 	logger := logrus.New()
 	logger.ReportCaller = true   // So Zap reports the right caller
@@ -70,18 +147,26 @@ func New(ctx context.Context, apiKey string, baseURL string) (*Opsgenie, error)
 	}
 
 	logger.Hooks.Add(hook)
+	logger.Hooks.Add(newSDKTelemetryHook(metricsHandler))
 
 	clientConfig := &ogclient.Config{
 		ApiKey:     apiKey,
 		HttpClient: httpClient,
 		Logger:     logger,
-		RetryCount: 20,
+		RetryCount: apiRetryCount,
 		Backoff: func(_, _ time.Duration, attemptNum int, resp *http.Response) time.Duration {
 			// exponential backoff - more information about rate limits in OpsGenie here: https://docs.opsgenie.com/docs/api-rate-limiting
 			exp := math.Pow(2, float64(attemptNum))
 			t := time.Duration(200) * time.Millisecond
 
-			l.Debug("retrying in ", zap.Duration("retry_in", t*time.Duration(exp)))
+			fields := []zap.Field{zap.Int("attempt", attemptNum+1), zap.Duration("retry_in", t*time.Duration(exp))}
+			if resp != nil && resp.Request != nil {
+				fields = append(fields,
+					zap.String("endpoint", endpointTemplate(resp.Request.Method, resp.Request.URL.Path)),
+					zap.Int("status", resp.StatusCode),
+				)
+			}
+			l.Debug("retrying in ", fields...)
 			return t * time.Duration(exp)
 		},
 	}
@@ -90,10 +175,76 @@ func New(ctx context.Context, apiKey string, baseURL string) (*Opsgenie, error)
 		clientConfig.OpsGenieAPIURL = ogclient.ApiUrl(baseURL)
 	}
 
+	var b backend
+	switch {
+	case opsgenieConfig.ExportDir != "":
+		if opsgenieConfig.Backend == backendJSMOps {
+			return nil, fmt.Errorf("opsgenie-connector: export-dir can't be used with the %s backend", backendJSMOps)
+		}
+		// Alerts and audit logs are not part of a configuration export.
+		if opsgenieConfig.UsageEvidence || opsgenieConfig.LastActivity {
+			return nil, errors.New("opsgenie-connector: usage evidence and last activity are not available from an export")
+		}
+
+		b = newExportBackend(opsgenieConfig.ExportDir)
+	case opsgenieConfig.Backend == backendJSMOps:
+		if opsgenieConfig.JsmCloudId == "" || opsgenieConfig.JsmEmail == "" {
+			return nil, fmt.Errorf("opsgenie-connector: the %s backend requires jsm-cloud-id and jsm-email", backendJSMOps)
+		}
+		// Alerts and audit logs are only read from the classic API.
+		if opsgenieConfig.UsageEvidence || opsgenieConfig.LastActivity {
+			return nil, fmt.Errorf("opsgenie-connector: usage evidence and last activity require the %s backend", backendOpsgenie)
+		}
+
+		// Users are looked up in the classic API, which provisioning and actions also call, to keep their Opsgenie user IDs.
+		opsgenieUsers, err := user.NewClient(clientConfig)
+		if err != nil {
+			return nil, err
+		}
+		b = newJSMBackend(httpClient, baseURL, opsgenieConfig.JsmCloudId, opsgenieConfig.JsmEmail, apiKey, opsgenieUsers)
+	default:
+		b, err = newOpsgenieBackend(clientConfig, failures)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	filter, err := newResourceFilter(opsgenieConfig, b)
+	if err != nil {
+		return nil, err
+	}
+	b = newFilteredBackend(b, filter)
+
 	rv := &Opsgenie{
-		apiKey: apiKey,
-		config: clientConfig,
+		apiKey:   apiKey,
+		config:   clientConfig,
+		failures: failures,
+		backend:  b,
+		filter:   filter,
+
+		ticketTeam:     opsgenieConfig.TicketTeam,
+		ticketPriority: opsgenieConfig.TicketPriority,
+		ticketTags:     opsgenieConfig.TicketTags,
+
+		employeeIDDetailKey: opsgenieConfig.EmployeeIdDetailKey,
+		dryRunProvisioning:  opsgenieConfig.DryRunProvisioning,
+
+		cache: newSyncCache(b),
+	}
+
+	// Last activity also considers alert activity, so it needs the alert scan even without usage evidence.
+	if opsgenieConfig.UsageEvidence || opsgenieConfig.LastActivity {
+		lookbackDays := opsgenieConfig.UsageEvidenceLookbackDays
+		if !opsgenieConfig.UsageEvidence {
+			lookbackDays = opsgenieConfig.LastActivityLookbackDays
+		}
+
+		rv.usageEvidence = newUsageEvidence(clientConfig, failures, time.Duration(lookbackDays)*24*time.Hour)
+		if opsgenieConfig.LastActivity {
+			rv.usageEvidence.auditLogLookback = lastActivityLookback(opsgenieConfig.LastActivityLookbackDays)
+		}
 	}
+	rv.cache.usage = rv.usageEvidence
 
 	return rv, nil
 }
@@ -106,12 +257,16 @@ func (c *Opsgenie) Metadata(ctx context.Context) (*v2.ConnectorMetadata, error)
 }
 
 func (c *Opsgenie) Validate(ctx context.Context) (annotations.Annotations, error) {
-	userClient, err := user.NewClient(c.config)
-	if err != nil {
-		return nil, err
+	for _, account := range c.accounts {
+		if _, err := account.conn.Validate(ctx); err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: account %s: %w", account.name, err)
+		}
+	}
+	if len(c.accounts) > 0 {
+		return nil, nil
 	}
 
-	_, err = userClient.List(ctx, &user.ListRequest{Limit: 1, Offset: 0})
+	_, _, err := c.backend.ListUsers(ctx, 0)
 	if err != nil {
 		return nil, err
 	}
@@ -119,15 +274,42 @@ func (c *Opsgenie) Validate(ctx context.Context) (annotations.Annotations, error
 	return nil, nil
 }
 
+// SetSessionStore records that the sync runs with a session store. The SDK hands every syncer a
+// store wrapped with the sync ID even when none is configured, so the syncers can't tell on their own.
+func (c *Opsgenie) SetSessionStore(ctx context.Context, store sessions.SessionStore) {
+	c.cache.sessionStore = store != nil
+	for _, account := range c.accounts {
+		account.conn.SetSessionStore(ctx, store)
+	}
+}
+
 func (c *Opsgenie) Asset(ctx context.Context, asset *v2.AssetRef) (string, io.ReadCloser, error) {
 	return "", nil, nil
 }
 
-func (c *Opsgenie) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncer {
-	return []connectorbuilder.ResourceSyncer{
-		teamBuilder(c.config),
-		roleBuilder(c.config),
-		userBuilder(c.config),
-		scheduleBuilder(c.config),
+func (c *Opsgenie) ResourceSyncers(ctx context.Context) []connectorbuilder.ResourceSyncerV2 {
+	if len(c.accounts) > 0 {
+		return c.accountSyncers(ctx)
 	}
+
+	syncers := []connectorbuilder.ResourceSyncerV2{
+		teamBuilder(c.backend, c.cache),
+		roleBuilder(c.backend, c.cache),
+		userBuilder(c.config, c.failures, c.backend, c.usageEvidence, c.employeeIDDetailKey, c.dryRunProvisioning),
+		scheduleBuilder(c.config, c.failures, c.backend, c.cache, c.dryRunProvisioning),
+		unknownPrincipalBuilder(c.backend, c.cache),
+	}
+
+	// Forwarding rules, heartbeats, escalations and services are only synced from the classic API.
+	ob, ok := withoutFilter(c.backend).(*opsgenieBackend)
+	if !ok {
+		return syncers
+	}
+
+	return append(syncers,
+		forwardingRuleBuilder(ob, c.filter),
+		heartbeatBuilder(ob, c.filter),
+		escalationBuilder(ob, c.filter),
+		serviceBuilder(ob, c.filter),
+	)
 }
@@ -0,0 +1,257 @@
+package connector
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	"github.com/conductorone/baton-sdk/pkg/types"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newE2EServer serves four users on pages of two, two teams, a custom role and a schedule owned by
+// the first team, with alice on call.
+func newE2EServer(t *testing.T) *opsgenietest.Server {
+	t.Helper()
+
+	srv := opsgenietest.NewServer(t)
+	srv.SetPageSize(2)
+
+	srv.AddUser(opsgenietest.User{ID: "user-alice", Username: "alice@example.com", FullName: "Alice", Role: "Admin", Verified: true})
+	srv.AddUser(opsgenietest.User{ID: "user-bob", Username: "bob@example.com", FullName: "Bob", Verified: true})
+	srv.AddUser(opsgenietest.User{ID: "user-carol", Username: "carol@example.com", FullName: "Carol", Role: "Responder", Verified: true})
+	srv.AddUser(opsgenietest.User{ID: "user-dave", Username: "dave@example.com", FullName: "Dave", Blocked: true})
+
+	srv.AddRole(opsgenietest.Role{ID: "role-responder", Name: "Responder"})
+
+	srv.AddTeam(opsgenietest.Team{ID: "team-sre", Name: "sre", Members: []opsgenietest.Member{
+		{UserID: "user-alice", Role: teamRoleAdmin},
+		{UserID: "user-bob"},
+	}})
+	srv.AddTeam(opsgenietest.Team{ID: "team-platform", Name: "platform", Members: []opsgenietest.Member{
+		{UserID: "user-carol"},
+	}})
+
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:          "schedule-primary",
+		Name:        "primary",
+		Enabled:     true,
+		OwnerTeamID: "team-sre",
+		Rotations: []opsgenietest.Rotation{{ID: "rotation-weekly", Name: "weekly", Participants: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-alice"},
+			{Type: opsgenietest.UserParticipant, ID: "user-bob"},
+		}}},
+	})
+	srv.SetOnCall("schedule-primary", opsgenietest.Participant{Type: opsgenietest.UserParticipant, ID: "user-alice"})
+
+	return srv
+}
+
+func newE2EConnector(t *testing.T, srv *opsgenietest.Server) types.ConnectorServer {
+	t.Helper()
+
+	ctx := context.Background()
+	c, err := New(ctx, &cfg.Opsgenie{ApiKey: opsgenietest.APIKey, BaseUrl: srv.APIURL()})
+	if err != nil {
+		t.Fatalf("failed to create connector: %v", err)
+	}
+
+	s, err := connectorbuilder.NewConnector(ctx, c)
+	if err != nil {
+		t.Fatalf("failed to create connector server: %v", err)
+	}
+
+	return s
+}
+
+// listAllResources lists every page of resources of a type.
+func listAllResources(t *testing.T, s types.ConnectorServer, resourceTypeID string) map[string]*v2.Resource {
+	t.Helper()
+
+	rv := make(map[string]*v2.Resource)
+	token := ""
+	for {
+		resp, err := s.ListResources(context.Background(), &v2.ResourcesServiceListResourcesRequest{ResourceTypeId: resourceTypeID, PageToken: token})
+		if err != nil {
+			t.Fatalf("failed to list %s resources: %v", resourceTypeID, err)
+		}
+		for _, r := range resp.GetList() {
+			rv[r.GetId().GetResource()] = r
+		}
+		if token = resp.GetNextPageToken(); token == "" {
+			return rv
+		}
+	}
+}
+
+// grantedPrincipals lists the grants of a resource, as principal IDs by entitlement slug.
+func grantedPrincipals(t *testing.T, s types.ConnectorServer, resource *v2.Resource) map[string][]string {
+	t.Helper()
+
+	resp, err := s.ListGrants(context.Background(), &v2.GrantsServiceListGrantsRequest{Resource: resource})
+	if err != nil {
+		t.Fatalf("failed to list grants of %s: %v", resource.GetId().GetResource(), err)
+	}
+
+	rv := make(map[string][]string)
+	for _, g := range resp.GetList() {
+		slug := entitlementSlug(g.GetEntitlement())
+		rv[slug] = append(rv[slug], g.GetPrincipal().GetId().GetResource())
+	}
+	for _, principals := range rv {
+		sort.Strings(principals)
+	}
+
+	return rv
+}
+
+func invokeAction(t *testing.T, s types.ConnectorServer, name, resourceTypeID string, args map[string]*structpb.Value) *structpb.Struct {
+	t.Helper()
+
+	resp, err := s.InvokeAction(context.Background(), &v2.InvokeActionRequest{
+		Name:           name,
+		ResourceTypeId: resourceTypeID,
+		Args:           &structpb.Struct{Fields: args},
+		InlineWait:     durationpb.New(10 * time.Second),
+	})
+	if err != nil {
+		t.Fatalf("failed to invoke %s: %v", name, err)
+	}
+	if resp.GetStatus() != v2.BatonActionStatus_BATON_ACTION_STATUS_COMPLETE {
+		t.Fatalf("expected %s to complete, got %v: %v", name, resp.GetStatus(), resp.GetResponse())
+	}
+
+	return resp.GetResponse()
+}
+
+func TestE2E_Sync(t *testing.T) {
+	srv := newE2EServer(t)
+	s := newE2EConnector(t, srv)
+
+	if _, err := s.Validate(context.Background(), &v2.ConnectorServiceValidateRequest{}); err != nil {
+		t.Fatalf("failed to validate: %v", err)
+	}
+
+	teams := listAllResources(t, s, resourceTypeTeam.Id)
+	if len(teams) != 2 {
+		t.Fatalf("expected 2 teams, got %d", len(teams))
+	}
+
+	// The first page of users is rate limited once, and retried.
+	srv.RateLimit(1)
+	users := listAllResources(t, s, resourceTypeUser.Id)
+	if len(users) != 4 {
+		t.Fatalf("expected 4 users over two pages, got %d", len(users))
+	}
+
+	roles := listAllResources(t, s, resourceTypeRole.Id)
+	if _, ok := roles["role-responder"]; !ok || len(roles) != len(defaultRoles)+1 {
+		t.Errorf("expected the default roles and the custom role, got %d roles", len(roles))
+	}
+
+	schedules := listAllResources(t, s, resourceTypeSchedule.Id)
+	if len(schedules) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(schedules))
+	}
+
+	if got := grantedPrincipals(t, s, teams["team-sre"]); !reflect.DeepEqual(got[teamMemberEntitlement], []string{"user-alice", "user-bob"}) {
+		t.Errorf("unexpected members of team sre %v", got)
+	}
+	if got := grantedPrincipals(t, s, roles["role-responder"]); !reflect.DeepEqual(got[roleMemberEntitlement], []string{"user-carol"}) {
+		t.Errorf("unexpected members of role responder %v", got)
+	}
+	got := grantedPrincipals(t, s, schedules["schedule-primary"])
+	if !reflect.DeepEqual(got[scheduleOnCall], []string{"user-alice"}) {
+		t.Errorf("unexpected on-call of schedule primary %v", got)
+	}
+	if !reflect.DeepEqual(got[scheduleOwner], []string{"team-sre"}) {
+		t.Errorf("unexpected owner of schedule primary %v", got)
+	}
+}
+
+func TestE2E_Provisioning(t *testing.T) {
+	srv := newE2EServer(t)
+	s := newE2EConnector(t, srv)
+
+	teams := listAllResources(t, s, resourceTypeTeam.Id)
+	schedules := listAllResources(t, s, resourceTypeSchedule.Id)
+
+	ents, err := s.ListEntitlements(context.Background(), &v2.EntitlementsServiceListEntitlementsRequest{Resource: schedules["schedule-primary"]})
+	if err != nil {
+		t.Fatalf("failed to list entitlements: %v", err)
+	}
+	var owner *v2.Entitlement
+	for _, e := range ents.GetList() {
+		if entitlementSlug(e) == scheduleOwner {
+			owner = e
+		}
+	}
+	if owner == nil {
+		t.Fatal("expected an owner entitlement")
+	}
+
+	if _, err := s.Grant(context.Background(), &v2.GrantManagerServiceGrantRequest{Principal: teams["team-platform"], Entitlement: owner}); err != nil {
+		t.Fatalf("failed to grant schedule ownership: %v", err)
+	}
+	if schedule, _ := srv.Schedule("schedule-primary"); schedule.OwnerTeamID != "team-platform" {
+		t.Errorf("expected schedule primary to be owned by team platform, got %s", schedule.OwnerTeamID)
+	}
+
+	invokeAction(t, s, addUserToTeamAction, "", map[string]*structpb.Value{
+		"user":      resourceIDValue(resourceTypeUser.Id, "user-carol"),
+		"team":      resourceIDValue(resourceTypeTeam.Id, "team-sre"),
+		"team_role": structpb.NewStringValue(teamRoleAdmin),
+	})
+	if team, _ := srv.Team("team-sre"); !reflect.DeepEqual(team.Members[len(team.Members)-1], opsgenietest.Member{UserID: "user-carol", Role: teamRoleAdmin}) {
+		t.Errorf("expected carol to join team sre as admin, got %v", team.Members)
+	}
+
+	invokeAction(t, s, setUserRoleAction, "", map[string]*structpb.Value{
+		"user": resourceIDValue(resourceTypeUser.Id, "user-bob"),
+		"role": resourceIDValue(resourceTypeRole.Id, "role-responder"),
+	})
+	if u, _ := srv.User("user-bob"); u.Role != "Responder" {
+		t.Errorf("expected bob to have the responder role, got %s", u.Role)
+	}
+
+	now := time.Now()
+	invokeAction(t, s, createScheduleOverrideAction, "", map[string]*structpb.Value{
+		"schedule":   resourceIDValue(resourceTypeSchedule.Id, "schedule-primary"),
+		"user":       resourceIDValue(resourceTypeUser.Id, "user-carol"),
+		"start_date": structpb.NewStringValue(now.Add(-time.Hour).Format(time.RFC3339)),
+		"end_date":   structpb.NewStringValue(now.Add(time.Hour).Format(time.RFC3339)),
+	})
+	rv := invokeAction(t, s, getCurrentOnCallAction, resourceTypeSchedule.Id, map[string]*structpb.Value{
+		scheduleActionResourceIDArg: resourceIDValue(resourceTypeSchedule.Id, "schedule-primary"),
+	})
+	participants := rv.GetFields()["on_call_participants"].GetListValue().GetValues()
+	if len(participants) != 1 || participants[0].GetStringValue() != "carol@example.com" {
+		t.Errorf("expected the override to put carol on call, got %v", participants)
+	}
+
+	invokeAction(t, s, offboardUserAction, resourceTypeUser.Id, map[string]*structpb.Value{
+		"resource_id": resourceIDValue(resourceTypeUser.Id, "user-alice"),
+		"replacement": resourceIDValue(resourceTypeUser.Id, "user-bob"),
+	})
+	schedule, _ := srv.Schedule("schedule-primary")
+	if !reflect.DeepEqual(schedule.Rotations[0].Participants, []opsgenietest.Participant{{Type: opsgenietest.UserParticipant, ID: "user-bob"}}) {
+		t.Errorf("expected bob to take over the rotation of alice, got %v", schedule.Rotations[0].Participants)
+	}
+	// Bob is already a member of team sre, and keeps their role.
+	if team, _ := srv.Team("team-sre"); !reflect.DeepEqual(team.Members, []opsgenietest.Member{
+		{UserID: "user-bob"},
+		{UserID: "user-carol", Role: teamRoleAdmin},
+	}) {
+		t.Errorf("expected alice to leave team sre, got %v", team.Members)
+	}
+	if u, _ := srv.User("user-alice"); !u.Blocked {
+		t.Error("expected alice to be blocked")
+	}
+}
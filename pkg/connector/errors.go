@@ -0,0 +1,268 @@
+package connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Opsgenie API errors are translated where they enter the connector, so that baton-sdk sees the gRPC
+// code matching the HTTP status and support can trace the request: the status details carry the
+// Opsgenie request ID and the endpoint. The SDK keeps neither the endpoint nor the response headers
+// in its errors, so apiErrorTransport records them for failed responses, by request ID, in the
+// failure log of its connector.
+
+const (
+	opsgenieErrorDomain = "api.opsgenie.com"
+
+	// maxRecordedFailures bounds the failed responses kept for translating their errors.
+	maxRecordedFailures = 256
+	// maxErrorBodySize bounds the error body read to find the request ID.
+	maxErrorBodySize = 64 * 1024
+)
+
+// apiFailure is what the HTTP client saw of a failed response and the SDK doesn't keep.
+type apiFailure struct {
+	endpoint   string
+	retryAfter time.Duration
+}
+
+// failureLog keeps the most recent failed responses of a connector by request ID. A nil log has no
+// failures recorded.
+type failureLog struct {
+	mu       sync.Mutex
+	failures map[string]apiFailure
+	order    []string
+}
+
+func newFailureLog() *failureLog {
+	return &failureLog{failures: make(map[string]apiFailure)}
+}
+
+func (l *failureLog) record(requestID string, f apiFailure) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.failures[requestID]; !ok {
+		l.order = append(l.order, requestID)
+		if len(l.order) > maxRecordedFailures {
+			delete(l.failures, l.order[0])
+			l.order = l.order[1:]
+		}
+	}
+	l.failures[requestID] = f
+}
+
+func (l *failureLog) lookup(requestID string) (apiFailure, bool) {
+	if l == nil || requestID == "" {
+		return apiFailure{}, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, ok := l.failures[requestID]
+	return f, ok
+}
+
+// apiErrorTransport records the endpoint and the retry delay of failed responses.
+type apiErrorTransport struct {
+	next     http.RoundTripper
+	failures *failureLog
+}
+
+func newAPIErrorTransport(next http.RoundTripper, failures *failureLog) *apiErrorTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &apiErrorTransport{next: next, failures: failures}
+}
+
+func (t *apiErrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode < http.StatusBadRequest {
+		return resp, err
+	}
+
+	requestID := resp.Header.Get("X-Request-Id")
+	if resp.Body != nil {
+		body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		_ = resp.Body.Close()
+		if readErr != nil {
+			return nil, readErr
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		// The SDK reports the request ID of the body, prefer it when both are set.
+		var payload struct {
+			RequestID string `json:"requestId"`
+		}
+		if json.Unmarshal(body, &payload) == nil && payload.RequestID != "" {
+			requestID = payload.RequestID
+		}
+	}
+
+	if requestID != "" {
+		t.failures.record(requestID, apiFailure{
+			endpoint:   endpointTemplate(req.Method, req.URL.Path),
+			retryAfter: retryAfter(resp.Header),
+		})
+	}
+
+	return resp, nil
+}
+
+// retryAfter returns the delay asked for by a rate limited response, from Retry-After or from the
+// rate limit period Opsgenie reports.
+func retryAfter(header http.Header) time.Duration {
+	for _, key := range []string{"Retry-After", "X-RateLimit-Period-In-Sec"} {
+		if seconds, err := strconv.Atoi(header.Get(key)); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return 0
+}
+
+// endpointLiterals are the path segments of the Opsgenie and JSM APIs the connector calls. Any other
+// segment is an identifier.
+var endpointLiterals = map[string]bool{
+	"v1": true, "v2": true, "users": true, "teams": true, "members": true, "roles": true,
+	"schedules": true, "on-calls": true, "next-on-calls": true, "overrides": true, "rotations": true,
+	"timeline": true, "escalations": true, "services": true, "heartbeats": true, "enable": true,
+	"disable": true, "forwarding-rules": true, "alerts": true, "requests": true, "count": true,
+	"logs": true, "list": true, "download": true, "jsm": true, "ops": true, "api": true, "ex": true,
+	"jira": true, "rest": true, "3": true, "user": true, "search": true,
+}
+
+// endpointTemplate returns the method and path of a request with identifiers replaced by {id}, so
+// that requests to the same endpoint share one name.
+func endpointTemplate(method, path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for i, segment := range segments {
+		if segment != "" && !endpointLiterals[segment] {
+			segments[i] = "{id}"
+		}
+	}
+
+	return method + " /" + strings.Join(segments, "/")
+}
+
+// opsgenieAPIError is an Opsgenie API error with the gRPC code of its HTTP status.
+type opsgenieAPIError struct {
+	err        error
+	apiErr     *ogclient.ApiError
+	endpoint   string
+	retryAfter time.Duration
+}
+
+// translateAPIError returns err as a gRPC status error if it is, or wraps, an Opsgenie API error,
+// with what the failure log recorded of its response. Other errors are returned as is.
+func translateAPIError(failures *failureLog, err error) error {
+	var translated *opsgenieAPIError
+	if err == nil || errors.As(err, &translated) {
+		return err
+	}
+
+	var apiErr *ogclient.ApiError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+
+	rv := &opsgenieAPIError{err: err, apiErr: apiErr}
+	if f, ok := failures.lookup(apiErr.RequestId); ok {
+		rv.endpoint = f.endpoint
+		rv.retryAfter = f.retryAfter
+	}
+
+	return rv
+}
+
+func (e *opsgenieAPIError) Error() string {
+	msg := e.err.Error()
+	if e.endpoint != "" {
+		msg += ", Endpoint: " + e.endpoint
+	}
+	if e.retryAfter > 0 {
+		msg += ", Retry After: " + e.retryAfter.String()
+	}
+
+	return msg
+}
+
+func (e *opsgenieAPIError) Unwrap() error {
+	return e.err
+}
+
+// GRPCStatus returns the status of the error, with the request ID, the endpoint and the retry delay
+// of rate limited requests as details.
+func (e *opsgenieAPIError) GRPCStatus() *status.Status {
+	st := status.New(apiErrorCode(e.apiErr.StatusCode), e.Error())
+
+	metadata := map[string]string{
+		"status_code": strconv.Itoa(e.apiErr.StatusCode),
+	}
+	if e.apiErr.RequestId != "" {
+		metadata["request_id"] = e.apiErr.RequestId
+	}
+	if e.endpoint != "" {
+		metadata["endpoint"] = e.endpoint
+	}
+	if e.apiErr.ErrorHeader != "" {
+		metadata["error_type"] = e.apiErr.ErrorHeader
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{
+		Reason:   fmt.Sprintf("HTTP_%d", e.apiErr.StatusCode),
+		Domain:   opsgenieErrorDomain,
+		Metadata: metadata,
+	}}
+	if e.apiErr.RequestId != "" {
+		details = append(details, &errdetails.RequestInfo{RequestId: e.apiErr.RequestId})
+	}
+	if e.apiErr.StatusCode == http.StatusTooManyRequests && e.retryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(e.retryAfter)})
+	}
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+
+	return withDetails
+}
+
+// apiErrorCode maps the HTTP status of an Opsgenie API error to a gRPC code.
+func apiErrorCode(statusCode int) codes.Code {
+	switch {
+	case statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case statusCode == http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case statusCode == http.StatusForbidden:
+		return codes.PermissionDenied
+	case statusCode == http.StatusNotFound:
+		return codes.NotFound
+	case statusCode == http.StatusTooManyRequests:
+		return codes.Unavailable
+	case statusCode >= http.StatusInternalServerError:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
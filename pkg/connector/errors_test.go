@@ -0,0 +1,140 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTranslateAPIError(t *testing.T) {
+	// team-<status> answers with that status and a request ID naming it.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/v2/teams/team-"))
+		if err != nil {
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Period-In-Sec", "60")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		_, _ = w.Write([]byte(`{"message":"failed","took":0.01,"requestId":"request-` + strconv.Itoa(code) + `"}`))
+	}))
+	defer srv.Close()
+
+	failures := newFailureLog()
+	config := newActionTestConnector(srv).config
+	config.HttpClient = &http.Client{Transport: newAPIErrorTransport(nil, failures)}
+	config.Backoff = func(_, _ time.Duration, _ int, _ *http.Response) time.Duration { return 0 }
+	b, err := newOpsgenieBackend(config, failures)
+	if err != nil {
+		t.Fatalf("failed to create backend: %v", err)
+	}
+
+	for statusCode, expected := range map[int]codes.Code{
+		http.StatusUnauthorized:    codes.Unauthenticated,
+		http.StatusForbidden:       codes.PermissionDenied,
+		http.StatusNotFound:        codes.NotFound,
+		http.StatusTooManyRequests: codes.Unavailable,
+	} {
+		teamID := "team-" + strconv.Itoa(statusCode)
+		_, _, err := teamBuilder(b, newSyncCache(b)).Get(context.Background(), &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: teamID}, nil)
+
+		st := status.Convert(err)
+		if st.Code() != expected {
+			t.Errorf("expected %v for status %d, got %v", expected, statusCode, err)
+			continue
+		}
+		if statusCode == http.StatusNotFound && !isNotFound(err) {
+			t.Errorf("expected the API error to be kept for status %d", statusCode)
+		}
+
+		var info *errdetails.ErrorInfo
+		var request *errdetails.RequestInfo
+		var retry *errdetails.RetryInfo
+		for _, d := range st.Details() {
+			switch d := d.(type) {
+			case *errdetails.ErrorInfo:
+				info = d
+			case *errdetails.RequestInfo:
+				request = d
+			case *errdetails.RetryInfo:
+				retry = d
+			}
+		}
+
+		requestID := "request-" + strconv.Itoa(statusCode)
+		if info.GetMetadata()["endpoint"] != "GET /v2/teams/{id}" || info.GetMetadata()["request_id"] != requestID {
+			t.Errorf("unexpected error info for status %d: %v", statusCode, info)
+		}
+		if request.GetRequestId() != requestID {
+			t.Errorf("unexpected request info for status %d: %v", statusCode, request)
+		}
+		if statusCode == http.StatusTooManyRequests {
+			if retry.GetRetryDelay().AsDuration() != time.Minute {
+				t.Errorf("expected a retry delay of a minute, got %v", retry)
+			}
+		} else if retry != nil {
+			t.Errorf("unexpected retry info for status %d: %v", statusCode, retry)
+		}
+	}
+}
+
+func TestTranslateAPIError_PerConnectorFailures(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"failed","took":0.01,"requestId":"request-1"}`))
+	}))
+	defer srv.Close()
+
+	recorded := newFailureLog()
+	config := newActionTestConnector(srv).config
+	config.HttpClient = &http.Client{Transport: newAPIErrorTransport(nil, recorded)}
+
+	// Each connector only sees the failures its own transport recorded.
+	for _, tt := range []struct {
+		failures *failureLog
+		endpoint bool
+	}{
+		{failures: recorded, endpoint: true},
+		{failures: newFailureLog(), endpoint: false},
+	} {
+		b, err := newOpsgenieBackend(config, tt.failures)
+		if err != nil {
+			t.Fatalf("failed to create backend: %v", err)
+		}
+
+		_, err = b.GetTeam(context.Background(), "team-1")
+		if code := status.Code(err); code != codes.NotFound {
+			t.Fatalf("expected %v, got %v", codes.NotFound, err)
+		}
+		if got := strings.Contains(err.Error(), "Endpoint: GET /v2/teams/{id}"); got != tt.endpoint {
+			t.Errorf("expected the endpoint to be named: %v, got %q", tt.endpoint, err.Error())
+		}
+	}
+}
+
+func TestEndpointTemplate(t *testing.T) {
+	for path, expected := range map[string]string{
+		"/v2/users/":                              "GET /v2/users",
+		"/v2/schedules/primary/on-calls":          "GET /v2/schedules/{id}/on-calls",
+		"/v2/heartbeats/db-backup/enable":         "GET /v2/heartbeats/{id}/enable",
+		"/jsm/ops/api/cloud-1/v1/teams/team-1":    "GET /jsm/ops/api/{id}/v1/teams/{id}",
+		"/v2/schedules/on-calls/user@example.com": "GET /v2/schedules/on-calls/{id}",
+	} {
+		if got := endpointTemplate(http.MethodGet, path); got != expected {
+			t.Errorf("expected %s for %s, got %s", expected, path, got)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	ogEscalation "github.com/opsgenie/opsgenie-go-sdk-v2/escalation"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+)
+
+// escalationRecipient is held by the users, teams and schedules that the rules of an escalation notify.
+const escalationRecipient = "recipient"
+
+type escalationResourceType struct {
+	resourceType *v2.ResourceType
+	backend      *opsgenieBackend
+	filter       *resourceFilter
+}
+
+func (e *escalationResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return e.resourceType
+}
+
+// parseEscalationRules returns the users, teams and schedules notified by the rules of an escalation.
+func parseEscalationRules(rules []ogEscalation.Rule) ([]string, []string, []string) {
+	var users, teams, schedules []string
+
+	for _, r := range rules {
+		switch r.Recipient.Type {
+		case og.User:
+			users = append(users, r.Recipient.Id)
+		case og.Team:
+			teams = append(teams, r.Recipient.Id)
+		case og.Schedule:
+			schedules = append(schedules, r.Recipient.Id)
+		default:
+		}
+	}
+
+	return users, teams, schedules
+}
+
+// escalationResource creates a new connector resource for an OpsGenie escalation, parented to its owner team.
+func escalationResource(escalation *ogEscalation.Escalation) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"escalation_id":   escalation.Id,
+		"escalation_name": escalation.Name,
+		"description":     escalation.Description,
+	}
+
+	users, teams, schedules := parseEscalationRules(escalation.Rules)
+	if len(users) > 0 {
+		profile["escalation_users"] = scheduleParticipantsToInterfaceSlice(users)
+	}
+	if len(teams) > 0 {
+		profile["escalation_teams"] = scheduleParticipantsToInterfaceSlice(teams)
+	}
+	if len(schedules) > 0 {
+		profile["escalation_schedules"] = scheduleParticipantsToInterfaceSlice(schedules)
+	}
+
+	opts := []rs.ResourceOption{
+		rs.WithResourceProfile(profile),
+		rs.WithDescription(escalation.Description),
+	}
+
+	if escalation.OwnerTeam != nil {
+		profile["owner_team_id"] = escalation.OwnerTeam.Id
+		profile["owner_team_name"] = escalation.OwnerTeam.Name
+
+		if parentID := ownerTeamParentResourceID(escalation.OwnerTeam.Id); parentID != nil {
+			opts = append(opts, rs.WithParentResourceID(parentID))
+		}
+	}
+
+	resource, err := rs.NewResource(
+		escalation.Name,
+		resourceTypeEscalation,
+		escalation.Id,
+		opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (e *escalationResourceType) List(ctx context.Context, parentID *v2.ResourceId, _ rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error) {
+	// Escalations are listed once at the top level, they carry their owner team as parent.
+	if parentID != nil {
+		return nil, nil, nil
+	}
+
+	escalations, err := e.backend.escalations.List(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list escalations: %w", translateAPIError(e.backend.failures, err))
+	}
+
+	var rv []*v2.Resource
+	for _, escalation := range escalations.Escalations {
+		escalationCopy := escalation
+		if err := e.filter.filterEscalation(ctx, &escalationCopy); err != nil {
+			return nil, nil, err
+		}
+
+		er, err := escalationResource(&escalationCopy)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rv = append(rv, er)
+	}
+
+	return rv, &rs.SyncOpResults{}, nil
+}
+
+func (e *escalationResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Entitlement, *rs.SyncOpResults, error) {
+	recipientOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(resourceTypeUser, resourceTypeTeam, resourceTypeSchedule),
+		ent.WithDisplayName(fmt.Sprintf("%s escalation %s", resource.DisplayName, escalationRecipient)),
+		ent.WithDescription(fmt.Sprintf("Is notified by the %s OpsGenie escalation", resource.DisplayName)),
+	}
+
+	return []*v2.Entitlement{
+		ent.NewAssignmentEntitlement(resource, escalationRecipient, recipientOptions...),
+	}, &rs.SyncOpResults{}, nil
+}
+
+// Grants grants the recipient entitlement to everyone the escalation rules notify. Grants to teams
+// and schedules expand to their members and on-call users.
+func (e *escalationResourceType) Grants(_ context.Context, resource *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error) {
+	profile := rs.GetProfile(resource)
+
+	var rv []*v2.Grant
+	for _, recipients := range []struct {
+		participantType string
+		profileKey      string
+	}{
+		{userParticipantType, "escalation_users"},
+		{teamParticipantType, "escalation_teams"},
+		{scheduleParticipantType, "escalation_schedules"},
+	} {
+		ids, _ := getProfileStringArray(profile, recipients.profileKey)
+		for _, id := range ids {
+			g, err := participantGrant(resource, escalationRecipient, recipients.participantType, id)
+			if err != nil {
+				return nil, nil, err
+			}
+			rv = append(rv, g)
+		}
+	}
+
+	return rv, &rs.SyncOpResults{}, nil
+}
+
+func escalationBuilder(b *opsgenieBackend, filter *resourceFilter) *escalationResourceType {
+	return &escalationResourceType{
+		resourceType: resourceTypeEscalation,
+		backend:      b,
+		filter:       filter,
+	}
+}
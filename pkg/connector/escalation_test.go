@@ -0,0 +1,40 @@
+package connector
+
+import (
+	"testing"
+
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	ogEscalation "github.com/opsgenie/opsgenie-go-sdk-v2/escalation"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+)
+
+func TestEscalationResource(t *testing.T) {
+	er, err := escalationResource(&ogEscalation.Escalation{
+		Id:        "escalation-1",
+		Name:      "sre escalation",
+		OwnerTeam: &og.OwnerTeam{Id: "team-1", Name: "sre"},
+		Rules: []ogEscalation.Rule{
+			{Recipient: og.Participant{Type: og.Schedule, Id: "schedule-1"}},
+			{Recipient: og.Participant{Type: og.User, Id: "user-1"}},
+			{Recipient: og.Participant{Type: og.Team, Id: "team-2"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if er.GetParentResourceId().GetResourceType() != resourceTypeTeam.Id || er.GetParentResourceId().GetResource() != "team-1" {
+		t.Errorf("expected escalation to be parented to team-1, got %v", er.GetParentResourceId())
+	}
+
+	profile := res.GetProfile(er)
+	for k, expected := range map[string]string{
+		"escalation_users":     "user-1",
+		"escalation_teams":     "team-2",
+		"escalation_schedules": "schedule-1",
+	} {
+		if v, _ := getProfileStringArray(profile, k); len(v) != 1 || v[0] != expected {
+			t.Errorf("expected %s to be [%s], got %v", k, expected, v)
+		}
+	}
+}
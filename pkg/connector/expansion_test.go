@@ -0,0 +1,180 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	ogEscalation "github.com/opsgenie/opsgenie-go-sdk-v2/escalation"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+)
+
+// effectiveUsers returns the users holding an entitlement, following GrantExpandable annotations
+// the way the SDK expands grants: holders of an expandable entitlement also hold the granted one.
+func effectiveUsers(grants []*v2.Grant, entitlementID string) []string {
+	byEntitlement := make(map[string][]*v2.Grant)
+	for _, g := range grants {
+		byEntitlement[g.GetEntitlement().GetId()] = append(byEntitlement[g.GetEntitlement().GetId()], g)
+	}
+
+	users := make(map[string]bool)
+	seen := make(map[string]bool)
+
+	var visit func(id string)
+	visit = func(id string) {
+		if seen[id] {
+			return
+		}
+		seen[id] = true
+
+		for _, g := range byEntitlement[id] {
+			if g.GetPrincipal().GetId().GetResourceType() == resourceTypeUser.Id {
+				users[g.GetPrincipal().GetId().GetResource()] = true
+			}
+
+			annos := annotations.Annotations(g.GetAnnotations())
+			expandable := &v2.GrantExpandable{}
+			if ok, _ := annos.Pick(expandable); ok {
+				for _, eid := range expandable.GetEntitlementIds() {
+					visit(eid)
+				}
+			}
+		}
+	}
+	visit(entitlementID)
+
+	rv := make([]string, 0, len(users))
+	for u := range users {
+		rv = append(rv, u)
+	}
+	sort.Strings(rv)
+
+	return rv
+}
+
+func TestEffectiveOnCallAccess(t *testing.T) {
+	// primary is on call through team-1 and escalation-1. The escalation notifies user-4 and
+	// whoever is on call for secondary, which is user-3.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var participants []interface{}
+		switch r.URL.Path {
+		case "/v2/schedules/primary/on-calls":
+			participants = []interface{}{
+				map[string]interface{}{"type": "team", "id": "team-1"},
+				map[string]interface{}{"type": "escalation", "id": "escalation-1"},
+			}
+		case "/v2/schedules/secondary/on-calls":
+			participants = []interface{}{
+				map[string]interface{}{"type": "user", "id": "user-3"},
+			}
+		case "/v2/users/":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": []interface{}{
+				map[string]interface{}{"id": "user-1"}, map[string]interface{}{"id": "user-2"},
+				map[string]interface{}{"id": "user-3"}, map[string]interface{}{"id": "user-4"},
+			}})
+			return
+		case "/v2/teams":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": []interface{}{map[string]interface{}{"id": "team-1"}}})
+			return
+		case "/v2/teams/team-1":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"id":      "team-1",
+				"name":    "sre",
+				"members": []interface{}{map[string]interface{}{"user": map[string]interface{}{"id": "user-2"}}},
+			}})
+			return
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"onCallParticipants": participants}})
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	ctx := context.Background()
+
+	primary, err := scheduleResource(&ogSchedule.Schedule{
+		Id:   "schedule-1",
+		Name: "primary",
+		Rotations: []og.Rotation{{Participants: []og.Participant{
+			{Type: og.User, Id: "user-1"},
+			{Type: og.Team, Id: "team-1"},
+		}}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	secondary, err := scheduleResource(&ogSchedule.Schedule{Id: "schedule-2", Name: "secondary"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	escalation, err := escalationResource(&ogEscalation.Escalation{
+		Id:   "escalation-1",
+		Name: "fallback",
+		Rules: []ogEscalation.Rule{
+			{Recipient: og.Participant{Type: og.Schedule, Id: "schedule-2"}},
+			{Recipient: og.Participant{Type: og.User, Id: "user-4"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	team, err := teamResource(ctx, oteam.ListedTeams{TeamMeta: oteam.TeamMeta{Id: "team-1", Name: "sre"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b := newTestOpsgenieBackend(t, config)
+	var grants []*v2.Grant
+	for _, tc := range []struct {
+		resource *v2.Resource
+		grants   func(context.Context, *v2.Resource, rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error)
+	}{
+		{primary, scheduleBuilder(config, nil, b, newSyncCache(b), false).Grants},
+		{secondary, scheduleBuilder(config, nil, b, newSyncCache(b), false).Grants},
+		{escalation, escalationBuilder(b, nil).Grants},
+		{team, teamBuilder(b, newSyncCache(b)).Grants},
+	} {
+		g, _, err := tc.grants(ctx, tc.resource, rs.SyncOpAttrs{})
+		if err != nil {
+			t.Fatalf("unexpected error listing grants of %s: %v", tc.resource.GetId().GetResource(), err)
+		}
+		grants = append(grants, g...)
+	}
+
+	for _, tc := range []struct {
+		entitlement string
+		expected    []string
+	}{
+		{entitlementID(resourceTypeSchedule, "schedule-1", scheduleOnCall), []string{"user-2", "user-3", "user-4"}},
+		{entitlementID(resourceTypeSchedule, "schedule-1", scheduleMember), []string{"user-1", "user-2"}},
+		{entitlementID(resourceTypeEscalation, "escalation-1", escalationRecipient), []string{"user-3", "user-4"}},
+	} {
+		got := effectiveUsers(grants, tc.entitlement)
+		if len(got) != len(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.entitlement, tc.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != tc.expected[i] {
+				t.Errorf("%s: expected %v, got %v", tc.entitlement, tc.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestEntitlementID(t *testing.T) {
+	if got := entitlementID(resourceTypeTeam, "team-1", teamMemberEntitlement); got != "team:team-1:member" {
+		t.Errorf("unexpected entitlement ID %q", got)
+	}
+}
@@ -0,0 +1,520 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	ogEscalation "github.com/opsgenie/opsgenie-go-sdk-v2/escalation"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+// stakeholderRole is the default role of users who can only follow alerts, not respond to them.
+const stakeholderRole = "Stakeholder"
+
+// resourceFilter leaves teams, schedules and users out of the sync. Teams and schedules are matched
+// by name, since Opsgenie has no tags on them, and users by tag or role.
+//
+// Filtered out objects are dropped everywhere they are referenced, not only from their own listing:
+// team members, rotation and on-call participants, escalation recipients, forwarding rule delegates
+// and owner teams. No grant is ever made to or on a filtered out resource.
+//
+// A nil filter keeps everything.
+type resourceFilter struct {
+	teamInclude     *regexp.Regexp
+	teamExclude     *regexp.Regexp
+	scheduleInclude *regexp.Regexp
+	scheduleExclude *regexp.Regexp
+	userTags        map[string]bool
+	skipStakeholder bool
+
+	// backend is the unfiltered backend the excluded IDs are looked up in.
+	backend backend
+
+	mtx       sync.Mutex
+	users     map[string]bool
+	teams     map[string]bool
+	schedules map[string]bool
+}
+
+func compileFilterPattern(name, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: invalid %s: %w", name, err)
+	}
+
+	return re, nil
+}
+
+// newResourceFilter returns the filter configured for a backend, or nil if none is.
+func newResourceFilter(opsgenieConfig *cfg.Opsgenie, b backend) (*resourceFilter, error) {
+	f := &resourceFilter{
+		backend:         b,
+		skipStakeholder: opsgenieConfig.SkipStakeholders,
+	}
+
+	for _, p := range []struct {
+		re      **regexp.Regexp
+		name    string
+		pattern string
+	}{
+		{&f.teamInclude, cfg.TeamIncludeRegexField.FieldName, opsgenieConfig.TeamIncludeRegex},
+		{&f.teamExclude, cfg.TeamExcludeRegexField.FieldName, opsgenieConfig.TeamExcludeRegex},
+		{&f.scheduleInclude, cfg.ScheduleIncludeRegexField.FieldName, opsgenieConfig.ScheduleIncludeRegex},
+		{&f.scheduleExclude, cfg.ScheduleExcludeRegexField.FieldName, opsgenieConfig.ScheduleExcludeRegex},
+	} {
+		re, err := compileFilterPattern(p.name, p.pattern)
+		if err != nil {
+			return nil, err
+		}
+		*p.re = re
+	}
+
+	if len(opsgenieConfig.SkipUserTags) > 0 {
+		f.userTags = make(map[string]bool, len(opsgenieConfig.SkipUserTags))
+		for _, tag := range opsgenieConfig.SkipUserTags {
+			f.userTags[tag] = true
+		}
+	}
+
+	if f.teamInclude == nil && f.teamExclude == nil && f.scheduleInclude == nil && f.scheduleExclude == nil &&
+		f.userTags == nil && !f.skipStakeholder {
+		return nil, nil
+	}
+
+	return f, nil
+}
+
+// keepName applies include and exclude patterns to a name. Without an include pattern every name is
+// included.
+func keepName(include, exclude *regexp.Regexp, name string) bool {
+	if include != nil && !include.MatchString(name) {
+		return false
+	}
+
+	return exclude == nil || !exclude.MatchString(name)
+}
+
+func (f *resourceFilter) keepTeam(name string) bool {
+	return f == nil || keepName(f.teamInclude, f.teamExclude, name)
+}
+
+func (f *resourceFilter) keepSchedule(name string) bool {
+	return f == nil || keepName(f.scheduleInclude, f.scheduleExclude, name)
+}
+
+func (f *resourceFilter) keepUser(u *user.User) bool {
+	if f == nil {
+		return true
+	}
+
+	if f.skipStakeholder && u.Role != nil && u.Role.RoleName == stakeholderRole {
+		return false
+	}
+
+	for _, tag := range u.Tags {
+		if f.userTags[tag] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Reset drops the excluded IDs looked up during the previous sync.
+func (f *resourceFilter) Reset() {
+	if f == nil {
+		return
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	f.users = nil
+	f.teams = nil
+	f.schedules = nil
+}
+
+// excludedUsers returns the IDs of the filtered out users, listing them on the first call.
+func (f *resourceFilter) excludedUsers(ctx context.Context) (map[string]bool, error) {
+	if f.userTags == nil && !f.skipStakeholder {
+		return nil, nil
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.users != nil {
+		return f.users, nil
+	}
+
+	excluded := make(map[string]bool)
+	for offset, more := 0, true; more; {
+		users, next, err := f.backend.ListUsers(ctx, offset)
+		if err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to list users: %w", err)
+		}
+
+		for i := range users {
+			if !f.keepUser(&users[i]) {
+				excluded[users[i].Id] = true
+			}
+		}
+		if offset, more, err = nextPageOffset(next); err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to list users: %w", err)
+		}
+	}
+	f.users = excluded
+
+	return excluded, nil
+}
+
+// excludedTeams returns the IDs of the filtered out teams, listing them on the first call.
+func (f *resourceFilter) excludedTeams(ctx context.Context) (map[string]bool, error) {
+	if f.teamInclude == nil && f.teamExclude == nil {
+		return nil, nil
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.teams != nil {
+		return f.teams, nil
+	}
+
+	teams, err := f.backend.ListTeams(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to list teams: %w", err)
+	}
+
+	excluded := make(map[string]bool)
+	for _, t := range teams {
+		if !f.keepTeam(t.Name) {
+			excluded[t.Id] = true
+		}
+	}
+	f.teams = excluded
+
+	return excluded, nil
+}
+
+// excludedSchedules returns the IDs of the filtered out schedules, listing them on the first call.
+func (f *resourceFilter) excludedSchedules(ctx context.Context) (map[string]bool, error) {
+	if f.scheduleInclude == nil && f.scheduleExclude == nil {
+		return nil, nil
+	}
+
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+
+	if f.schedules != nil {
+		return f.schedules, nil
+	}
+
+	schedules, err := f.backend.ListSchedules(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to list schedules: %w", err)
+	}
+
+	excluded := make(map[string]bool)
+	for _, s := range schedules {
+		if !f.keepSchedule(s.Name) {
+			excluded[s.Id] = true
+		}
+	}
+	f.schedules = excluded
+
+	return excluded, nil
+}
+
+// Excluded reports whether a user, team or schedule referenced by ID is filtered out. Other
+// participant types are never filtered out.
+func (f *resourceFilter) Excluded(ctx context.Context, participantType, id string) (bool, error) {
+	if f == nil || id == "" {
+		return false, nil
+	}
+
+	var (
+		excluded map[string]bool
+		err      error
+	)
+	switch participantType {
+	case userParticipantType:
+		excluded, err = f.excludedUsers(ctx)
+	case teamParticipantType:
+		excluded, err = f.excludedTeams(ctx)
+	case scheduleParticipantType:
+		excluded, err = f.excludedSchedules(ctx)
+	default:
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return excluded[id], nil
+}
+
+// keepParticipants returns the participants that aren't filtered out.
+func (f *resourceFilter) keepParticipants(ctx context.Context, participants []og.Participant) ([]og.Participant, error) {
+	rv := make([]og.Participant, 0, len(participants))
+	for _, p := range participants {
+		excluded, err := f.Excluded(ctx, string(p.Type), p.Id)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			rv = append(rv, p)
+		}
+	}
+
+	return rv, nil
+}
+
+// filteredBackend applies a resourceFilter to the objects of a backend. Filtered out objects aren't
+// listed, can't be fetched, and are removed from the teams and schedules that reference them.
+type filteredBackend struct {
+	backend
+	filter *resourceFilter
+}
+
+func newFilteredBackend(b backend, filter *resourceFilter) backend {
+	if filter == nil {
+		return b
+	}
+
+	return &filteredBackend{backend: b, filter: filter}
+}
+
+// filteredNotFound returns the error the API would return for a missing object, so that filtered
+// out objects look like they don't exist.
+func filteredNotFound(kind, id string) error {
+	return translateAPIError(nil, &ogclient.ApiError{
+		StatusCode: http.StatusNotFound,
+		Message:    fmt.Sprintf("%s %s is filtered out", kind, id),
+	})
+}
+
+// ListUsers returns the users of a page that aren't filtered out. Pages can be shorter than the
+// page size, the link to the next page is kept.
+func (b *filteredBackend) ListUsers(ctx context.Context, offset int) ([]user.User, string, error) {
+	users, next, err := b.backend.ListUsers(ctx, offset)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rv := make([]user.User, 0, len(users))
+	for i := range users {
+		if b.filter.keepUser(&users[i]) {
+			rv = append(rv, users[i])
+		}
+	}
+
+	return rv, next, nil
+}
+
+func (b *filteredBackend) GetUser(ctx context.Context, userID string) (*user.User, error) {
+	u, err := b.backend.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.filter.keepUser(u) {
+		return nil, filteredNotFound("user", userID)
+	}
+
+	return u, nil
+}
+
+func (b *filteredBackend) ListTeams(ctx context.Context) ([]oteam.ListedTeams, error) {
+	teams, err := b.backend.ListTeams(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]oteam.ListedTeams, 0, len(teams))
+	for _, t := range teams {
+		if b.filter.keepTeam(t.Name) {
+			rv = append(rv, t)
+		}
+	}
+
+	return rv, nil
+}
+
+// GetTeam returns a team without its filtered out members.
+func (b *filteredBackend) GetTeam(ctx context.Context, teamID string) (*oteam.GetTeamResult, error) {
+	t, err := b.backend.GetTeam(ctx, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !b.filter.keepTeam(t.Name) {
+		return nil, filteredNotFound("team", teamID)
+	}
+
+	rv := *t
+	rv.Members = make([]oteam.Member, 0, len(t.Members))
+	for _, m := range t.Members {
+		excluded, err := b.filter.Excluded(ctx, userParticipantType, m.User.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !excluded {
+			rv.Members = append(rv.Members, m)
+		}
+	}
+
+	return &rv, nil
+}
+
+// filterSchedule returns a copy of a schedule without its filtered out rotation participants, and
+// without its owner team if that team is filtered out.
+func (b *filteredBackend) filterSchedule(ctx context.Context, s *ogSchedule.Schedule) (*ogSchedule.Schedule, error) {
+	rv := *s
+
+	if s.OwnerTeam != nil {
+		excluded, err := b.filter.Excluded(ctx, teamParticipantType, s.OwnerTeam.Id)
+		if err != nil {
+			return nil, err
+		}
+		if excluded {
+			rv.OwnerTeam = nil
+		}
+	}
+
+	rv.Rotations = make([]og.Rotation, 0, len(s.Rotations))
+	for _, r := range s.Rotations {
+		participants, err := b.filter.keepParticipants(ctx, r.Participants)
+		if err != nil {
+			return nil, err
+		}
+		r.Participants = participants
+		rv.Rotations = append(rv.Rotations, r)
+	}
+
+	return &rv, nil
+}
+
+func (b *filteredBackend) ListSchedules(ctx context.Context) ([]ogSchedule.Schedule, error) {
+	schedules, err := b.backend.ListSchedules(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make([]ogSchedule.Schedule, 0, len(schedules))
+	for i := range schedules {
+		s, err := filterSchedule(ctx, b, &schedules[i])
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			rv = append(rv, *s)
+		}
+	}
+
+	return rv, nil
+}
+
+func (b *filteredBackend) GetSchedule(ctx context.Context, scheduleID string) (*ogSchedule.Schedule, error) {
+	s, err := b.backend.GetSchedule(ctx, scheduleID)
+	if err != nil {
+		return nil, err
+	}
+
+	rv, err := filterSchedule(ctx, b, s)
+	if err != nil {
+		return nil, err
+	}
+	if rv == nil {
+		return nil, filteredNotFound("schedule", scheduleID)
+	}
+
+	return rv, nil
+}
+
+// withoutFilter returns the backend a filteredBackend applies its filter to, or b itself.
+func withoutFilter(b backend) backend {
+	if fb, ok := b.(*filteredBackend); ok {
+		return fb.backend
+	}
+
+	return b
+}
+
+// filterSchedule returns a schedule of the unfiltered backend as b returns it: nil if it is filtered
+// out, and without its filtered out participants otherwise.
+func filterSchedule(ctx context.Context, b backend, s *ogSchedule.Schedule) (*ogSchedule.Schedule, error) {
+	fb, ok := b.(*filteredBackend)
+	if !ok {
+		return s, nil
+	}
+
+	if !fb.filter.keepSchedule(s.Name) {
+		return nil, nil
+	}
+
+	return fb.filterSchedule(ctx, s)
+}
+
+// ListOnCalls returns the on-call participants that aren't filtered out.
+func (b *filteredBackend) ListOnCalls(ctx context.Context, scheduleID, scheduleName string) ([]og.Participant, error) {
+	participants, err := b.backend.ListOnCalls(ctx, scheduleID, scheduleName)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.filter.keepParticipants(ctx, participants)
+}
+
+// ownerTeamID returns the ID of an owner team, or an empty string if the team is filtered out.
+func (f *resourceFilter) ownerTeamID(ctx context.Context, teamID string) (string, error) {
+	excluded, err := f.Excluded(ctx, teamParticipantType, teamID)
+	if err != nil || excluded {
+		return "", err
+	}
+
+	return teamID, nil
+}
+
+// filterEscalation removes the filtered out recipients and owner team of an escalation.
+func (f *resourceFilter) filterEscalation(ctx context.Context, escalation *ogEscalation.Escalation) error {
+	if f == nil {
+		return nil
+	}
+
+	if escalation.OwnerTeam != nil {
+		teamID, err := f.ownerTeamID(ctx, escalation.OwnerTeam.Id)
+		if err != nil {
+			return err
+		}
+		if teamID == "" {
+			escalation.OwnerTeam = nil
+		}
+	}
+
+	rules := make([]ogEscalation.Rule, 0, len(escalation.Rules))
+	for _, r := range escalation.Rules {
+		excluded, err := f.Excluded(ctx, string(r.Recipient.Type), r.Recipient.Id)
+		if err != nil {
+			return err
+		}
+		if !excluded {
+			rules = append(rules, r)
+		}
+	}
+	escalation.Rules = rules
+
+	return nil
+}
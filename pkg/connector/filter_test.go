@@ -0,0 +1,209 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	ogEscalation "github.com/opsgenie/opsgenie-go-sdk-v2/escalation"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newFilteredTenant serves a tenant with a bot user, a stakeholder and a sandbox team next to
+// user-1 and team-1. The sandbox team owns the primary schedule and is in its rotation, and the bot
+// is a member of team-1. A second schedule belongs to the sandbox.
+func newFilteredTenant(t *testing.T) *opsgenietest.Server {
+	t.Helper()
+
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1"})
+	srv.AddUser(opsgenietest.User{ID: "user-bot", Tags: []string{"bot"}})
+	srv.AddUser(opsgenietest.User{ID: "user-stakeholder", Role: "Stakeholder"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "sre", Members: []opsgenietest.Member{{UserID: "user-1"}, {UserID: "user-bot"}}})
+	srv.AddTeam(opsgenietest.Team{ID: "team-sandbox", Name: "sandbox-alpha"})
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:          "schedule-1",
+		Name:        "primary",
+		OwnerTeamID: "team-sandbox",
+		Rotations: []opsgenietest.Rotation{{Participants: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-1"},
+			{Type: opsgenietest.UserParticipant, ID: "user-stakeholder"},
+			{Type: opsgenietest.TeamParticipant, ID: "team-sandbox"},
+		}}},
+		OnCall: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-1"},
+			{Type: opsgenietest.TeamParticipant, ID: "team-sandbox"},
+		},
+	})
+	srv.AddSchedule(opsgenietest.Schedule{ID: "schedule-sandbox", Name: "sandbox rota"})
+
+	return srv
+}
+
+func newTestFilteredBackend(t *testing.T, srv *opsgenietest.Server) (backend, *resourceFilter) {
+	t.Helper()
+
+	inner := newTestOpsgenieBackend(t, srv.Config())
+	filter, err := newResourceFilter(&cfg.Opsgenie{
+		TeamExcludeRegex:     "^sandbox",
+		ScheduleExcludeRegex: "sandbox",
+		SkipUserTags:         []string{"bot"},
+		SkipStakeholders:     true,
+	}, inner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return newFilteredBackend(inner, filter), filter
+}
+
+func TestFilteredBackend_GrantsSkipFilteredResources(t *testing.T) {
+	b, _ := newTestFilteredBackend(t, newFilteredTenant(t))
+	got := strings.Join(syncIDs(t, b), "\n")
+
+	expected := strings.Join([]string{
+		"schedule:schedule-1",
+		"schedule:schedule-1:member:user:user-1",
+		"schedule:schedule-1:on-call:user:user-1",
+		"team:team-1",
+		"team:team-1:member:user:user-1",
+		"user:user-1",
+	}, "\n")
+	if got != expected {
+		t.Errorf("unexpected resources and grants:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	// Filtered out participants aren't mistaken for dangling ones.
+	unknown, _, err := unknownPrincipalBuilder(b, newSyncCache(b)).List(context.Background(), nil, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(unknown) != 0 {
+		t.Errorf("expected no unknown principals, got %v", unknown)
+	}
+}
+
+func TestFilteredBackend_ListsUsersPastAFilteredPage(t *testing.T) {
+	// The second page of 100 users only holds bots, so the filtered backend returns it empty.
+	srv := opsgenietest.NewServer(t)
+	for i := 0; i < 3*ResourcesPageSize; i++ {
+		u := opsgenietest.User{ID: fmt.Sprintf("user-%03d", i)}
+		if i >= ResourcesPageSize && i < 2*ResourcesPageSize {
+			u.Tags = []string{"bot"}
+		}
+		srv.AddUser(u)
+	}
+
+	inner := newTestOpsgenieBackend(t, srv.Config())
+	filter, err := newResourceFilter(&cfg.Opsgenie{SkipUserTags: []string{"bot"}}, inner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := newFilteredBackend(inner, filter)
+
+	users, err := newSyncCache(b).Users(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	seen := make(map[string]bool, len(users))
+	for _, u := range users {
+		if seen[u.Id] {
+			t.Errorf("user %s listed twice", u.Id)
+		}
+		seen[u.Id] = true
+	}
+	if len(seen) != 2*ResourcesPageSize || !seen["user-000"] || !seen["user-299"] || seen["user-100"] {
+		t.Errorf("expected the 200 users of the first and last pages, got %d", len(seen))
+	}
+
+	excluded, err := filter.excludedUsers(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(excluded) != ResourcesPageSize || !excluded["user-100"] || !excluded["user-199"] {
+		t.Errorf("expected the 100 bots to be excluded, got %d", len(excluded))
+	}
+}
+
+func TestFilteredBackend_GetFilteredResource(t *testing.T) {
+	b, _ := newTestFilteredBackend(t, newFilteredTenant(t))
+	_, _, err := teamBuilder(b, newSyncCache(b)).Get(context.Background(), &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: "team-sandbox"}, nil)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("expected codes.NotFound for a filtered out team, got %v", err)
+	}
+}
+
+func TestResourceFilter_Escalation(t *testing.T) {
+	_, filter := newTestFilteredBackend(t, newFilteredTenant(t))
+	escalation := &ogEscalation.Escalation{
+		OwnerTeam: &og.OwnerTeam{Id: "team-sandbox"},
+		Rules: []ogEscalation.Rule{
+			{Recipient: og.Participant{Type: og.User, Id: "user-bot"}},
+			{Recipient: og.Participant{Type: og.Team, Id: "team-1"}},
+			{Recipient: og.Participant{Type: og.Schedule, Id: "schedule-sandbox"}},
+		},
+	}
+	if err := filter.filterEscalation(context.Background(), escalation); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if escalation.OwnerTeam != nil {
+		t.Errorf("expected the filtered out owner team to be removed, got %v", escalation.OwnerTeam)
+	}
+	if len(escalation.Rules) != 1 || escalation.Rules[0].Recipient.Id != "team-1" {
+		t.Errorf("expected only the team-1 rule to be kept, got %v", escalation.Rules)
+	}
+}
+
+func TestNewResourceFilter(t *testing.T) {
+	if f, err := newResourceFilter(&cfg.Opsgenie{}, nil); f != nil || err != nil {
+		t.Errorf("expected no filter without filter settings, got %v, %v", f, err)
+	}
+
+	if _, err := newResourceFilter(&cfg.Opsgenie{TeamIncludeRegex: "("}, nil); err == nil || !strings.Contains(err.Error(), "team-include-regex") {
+		t.Errorf("expected an error naming the invalid setting, got %v", err)
+	}
+
+	f, err := newResourceFilter(&cfg.Opsgenie{TeamIncludeRegex: "^prod-", TeamExcludeRegex: "-legacy$"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for name, keep := range map[string]bool{"prod-sre": true, "prod-sre-legacy": false, "staging-sre": false} {
+		if f.keepTeam(name) != keep {
+			t.Errorf("expected keepTeam(%q) to be %v", name, keep)
+		}
+	}
+}
+
+func TestResourceSyncers_FilteredBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+	c.filter = &resourceFilter{teamExclude: regexp.MustCompile("^sandbox-")}
+	c.backend = newFilteredBackend(newTestOpsgenieBackend(t, c.config), c.filter)
+	c.cache = newSyncCache(c.backend)
+
+	// The classic API syncers are kept when the backend is wrapped by a filter.
+	synced := make(map[string]bool)
+	for _, syncer := range c.ResourceSyncers(context.Background()) {
+		synced[syncer.ResourceType(context.Background()).Id] = true
+	}
+	for _, rt := range []*v2.ResourceType{resourceTypeForwardingRule, resourceTypeHeartbeat, resourceTypeEscalation, resourceTypeService} {
+		if !synced[rt.Id] {
+			t.Errorf("expected %s to be synced with a filter", rt.Id)
+		}
+	}
+}
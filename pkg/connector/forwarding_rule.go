@@ -0,0 +1,155 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+const (
+	forwardingRuleDelegateEntitlement = "delegate"
+)
+
+type forwardingRuleResourceType struct {
+	resourceType *v2.ResourceType
+	backend      *opsgenieBackend
+	filter       *resourceFilter
+}
+
+func (o *forwardingRuleResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return o.resourceType
+}
+
+// formatForwardingRuleTime returns the RFC3339 representation of t, or an empty string for an unset time.
+func formatForwardingRuleTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// forwardingRuleResource creates a new connector resource for an Opsgenie forwarding rule, parented to the user whose alerts are forwarded.
+func forwardingRuleResource(rule user.ForwardingRule, parentResourceID *v2.ResourceId) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"forwarding_rule_id": rule.Id,
+		"alias":              rule.Alias,
+		"from_user_id":       rule.FromUser.Id,
+		"from_username":      rule.FromUser.Username,
+		"to_user_id":         rule.ToUser.Id,
+		"to_username":        rule.ToUser.Username,
+		"start_date":         formatForwardingRuleTime(rule.StartDate),
+		"end_date":           formatForwardingRuleTime(rule.EndDate),
+	}
+
+	resource, err := res.NewResource(
+		fmt.Sprintf("%s to %s", rule.FromUser.Username, rule.ToUser.Username),
+		resourceTypeForwardingRule,
+		rule.Id,
+		res.WithParentResourceID(parentResourceID),
+		res.WithResourceProfile(profile),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (o *forwardingRuleResourceType) List(ctx context.Context, parentResourceID *v2.ResourceId, _ res.SyncOpAttrs) ([]*v2.Resource, *res.SyncOpResults, error) {
+	if parentResourceID == nil || parentResourceID.ResourceType != resourceTypeUser.Id {
+		return nil, nil, nil
+	}
+
+	rules, err := o.backend.users.ListUserForwardingRules(ctx, &user.ListUserForwardingRulesRequest{
+		Identifier: parentResourceID.Resource,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list forwarding rules: %w", translateAPIError(o.backend.failures, err))
+	}
+
+	rv := make([]*v2.Resource, 0)
+	for _, rule := range rules.ForwardingRules {
+		fr, err := forwardingRuleResource(rule, parentResourceID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rv = append(rv, fr)
+	}
+
+	return rv, &res.SyncOpResults{}, nil
+}
+
+func (o *forwardingRuleResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ res.SyncOpAttrs) ([]*v2.Entitlement, *res.SyncOpResults, error) {
+	var rv []*v2.Entitlement
+
+	fromUsername, _ := res.GetProfileStringValue(res.GetProfile(resource), "from_username")
+
+	assignmentOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(resourceTypeUser),
+		ent.WithDisplayName(fmt.Sprintf("Receives forwarded alerts from %s", fromUsername)),
+		ent.WithDescription(fmt.Sprintf("Receives alerts forwarded from %s in Opsgenie", fromUsername)),
+	}
+
+	rv = append(rv, ent.NewAssignmentEntitlement(
+		resource,
+		forwardingRuleDelegateEntitlement,
+		assignmentOptions...,
+	))
+
+	return rv, &res.SyncOpResults{}, nil
+}
+
+func (o *forwardingRuleResourceType) Grants(ctx context.Context, resource *v2.Resource, _ res.SyncOpAttrs) ([]*v2.Grant, *res.SyncOpResults, error) {
+	profile := res.GetProfile(resource)
+
+	toUserID, ok := res.GetProfileStringValue(profile, "to_user_id")
+	if !ok || toUserID == "" {
+		return nil, nil, nil
+	}
+
+	// Alerts forwarded to a filtered out user are left out like the user.
+	excluded, err := o.filter.Excluded(ctx, userParticipantType, toUserID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if excluded {
+		return nil, &res.SyncOpResults{}, nil
+	}
+
+	metadata := map[string]interface{}{}
+	for _, k := range []string{"from_user_id", "start_date", "end_date"} {
+		if v, ok := res.GetProfileStringValue(profile, k); ok && v != "" {
+			metadata[k] = v
+		}
+	}
+
+	rv := []*v2.Grant{
+		grant.NewGrant(
+			resource,
+			forwardingRuleDelegateEntitlement,
+			&v2.ResourceId{
+				ResourceType: resourceTypeUser.Id,
+				Resource:     toUserID,
+			},
+			grant.WithGrantMetadata(metadata),
+		),
+	}
+
+	return rv, &res.SyncOpResults{}, nil
+}
+
+func forwardingRuleBuilder(b *opsgenieBackend, filter *resourceFilter) *forwardingRuleResourceType {
+	return &forwardingRuleResourceType{
+		resourceType: resourceTypeForwardingRule,
+		backend:      b,
+		filter:       filter,
+	}
+}
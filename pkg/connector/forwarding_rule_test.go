@@ -0,0 +1,153 @@
+package connector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+// newForwardingRuleTenant serves the forwarding rules of user-1: one to user-2 during a vacation,
+// an open-ended one to user-3, and one to a bot.
+func newForwardingRuleTenant(t *testing.T) *opsgenietest.Server {
+	t.Helper()
+
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1", Username: "jane@example.com"})
+	srv.AddUser(opsgenietest.User{ID: "user-2", Username: "john@example.com"})
+	srv.AddUser(opsgenietest.User{ID: "user-3", Username: "ops@example.com"})
+	srv.AddUser(opsgenietest.User{ID: "user-bot", Username: "bot@example.com", Tags: []string{"bot"}})
+	srv.AddForwardingRule(opsgenietest.ForwardingRule{
+		ID:         "rule-1",
+		Alias:      "vacation",
+		FromUserID: "user-1",
+		ToUserID:   "user-2",
+		StartDate:  time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+		EndDate:    time.Date(2026, 7, 15, 0, 0, 0, 0, time.UTC),
+	})
+	srv.AddForwardingRule(opsgenietest.ForwardingRule{
+		ID:         "rule-2",
+		FromUserID: "user-1",
+		ToUserID:   "user-3",
+		StartDate:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+	srv.AddForwardingRule(opsgenietest.ForwardingRule{
+		ID:         "rule-bot",
+		FromUserID: "user-1",
+		ToUserID:   "user-bot",
+		StartDate:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+	})
+
+	return srv
+}
+
+func TestForwardingRuleList(t *testing.T) {
+	builder := forwardingRuleBuilder(newTestOpsgenieBackend(t, newForwardingRuleTenant(t).Config()), nil)
+	ctx := context.Background()
+
+	// Forwarding rules are only listed under the user whose alerts they forward.
+	for _, parentID := range []*v2.ResourceId{nil, {ResourceType: resourceTypeTeam.Id, Resource: "team-1"}} {
+		rules, _, err := builder.List(ctx, parentID, res.SyncOpAttrs{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(rules) != 0 {
+			t.Errorf("expected no forwarding rules under %v, got %d", parentID, len(rules))
+		}
+	}
+
+	parentID := &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "user-1"}
+	rules, _, err := builder.List(ctx, parentID, res.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 3 {
+		t.Fatalf("expected 3 forwarding rules, got %d", len(rules))
+	}
+
+	rule := rules[0]
+	if rule.GetId().GetResource() != "rule-1" || rule.GetDisplayName() != "jane@example.com to john@example.com" {
+		t.Errorf("unexpected forwarding rule %s (%s)", rule.GetDisplayName(), rule.GetId().GetResource())
+	}
+	if rule.GetParentResourceId().GetResourceType() != resourceTypeUser.Id || rule.GetParentResourceId().GetResource() != "user-1" {
+		t.Errorf("expected the forwarding rule to be parented to user-1, got %v", rule.GetParentResourceId())
+	}
+
+	profile := res.GetProfile(rule)
+	for k, expected := range map[string]string{
+		"alias":         "vacation",
+		"from_username": "jane@example.com",
+		"to_user_id":    "user-2",
+		"start_date":    "2026-07-01T00:00:00Z",
+		"end_date":      "2026-07-15T00:00:00Z",
+	} {
+		if v, _ := res.GetProfileStringValue(profile, k); v != expected {
+			t.Errorf("expected %s to be %q, got %q", k, expected, v)
+		}
+	}
+	if v, _ := res.GetProfileStringValue(res.GetProfile(rules[1]), "end_date"); v != "" {
+		t.Errorf("expected an open-ended rule to have no end date, got %q", v)
+	}
+}
+
+func TestForwardingRuleGrants(t *testing.T) {
+	inner := newTestOpsgenieBackend(t, newForwardingRuleTenant(t).Config())
+	filter, err := newResourceFilter(&cfg.Opsgenie{SkipUserTags: []string{"bot"}}, inner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	builder := forwardingRuleBuilder(inner, filter)
+	ctx := context.Background()
+
+	rules, _, err := builder.List(ctx, &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "user-1"}, res.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	grants, _, err := builder.Grants(ctx, rules[0], res.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(grants) != 1 {
+		t.Fatalf("expected 1 grant, got %d", len(grants))
+	}
+
+	g := grants[0]
+	if g.GetEntitlement().GetId() != resourceTypeForwardingRule.Id+":rule-1:"+forwardingRuleDelegateEntitlement {
+		t.Errorf("unexpected entitlement %s", g.GetEntitlement().GetId())
+	}
+	if g.GetPrincipal().GetId().GetResourceType() != resourceTypeUser.Id || g.GetPrincipal().GetId().GetResource() != "user-2" {
+		t.Errorf("expected the delegate grant to go to user-2, got %v", g.GetPrincipal().GetId())
+	}
+	// Alerts forwarded to a filtered out user have no delegate grant.
+	grants, _, err = builder.Grants(ctx, rules[2], res.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(grants) != 0 {
+		t.Errorf("expected no grant to the filtered out bot, got %v", grants)
+	}
+}
+
+func TestUserResource_ForwardingRuleChildren(t *testing.T) {
+	ur, err := userResource(context.Background(), user.User{Id: "user-1", Username: "jane@example.com"}, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	annos := annotations.Annotations(ur.GetAnnotations())
+	childType := &v2.ChildResourceType{}
+	ok, err := annos.Pick(childType)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !ok || childType.GetResourceTypeId() != resourceTypeForwardingRule.Id {
+		t.Errorf("expected users to have forwarding rule children, got %v", childType)
+	}
+}
@@ -0,0 +1,190 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	ogHeartbeat "github.com/opsgenie/opsgenie-go-sdk-v2/heartbeat"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	enableHeartbeatAction  = "enable_heartbeat"
+	disableHeartbeatAction = "disable_heartbeat"
+)
+
+var (
+	heartbeatResourceIDArgument = resourceIDArgument("resource_id", "Heartbeat", "The heartbeat to update", resourceTypeHeartbeat)
+
+	heartbeatReturnTypes = []*config.Field{
+		boolReturnType("success"),
+		stringReturnType("heartbeat_name"),
+		boolReturnType("enabled"),
+		boolReturnType("expired"),
+		stringReturnType("request_id"),
+	}
+
+	enableHeartbeatActionSchema = &v2.BatonActionSchema{
+		Name:        enableHeartbeatAction,
+		DisplayName: "Enable Heartbeat",
+		Description: "Enable an Opsgenie heartbeat so it alerts again when pings stop",
+		Arguments:   []*config.Field{heartbeatResourceIDArgument},
+		ReturnTypes: heartbeatReturnTypes,
+		ActionType:  []v2.ActionType{v2.ActionType_ACTION_TYPE_RESOURCE_ENABLE},
+	}
+
+	disableHeartbeatActionSchema = &v2.BatonActionSchema{
+		Name:        disableHeartbeatAction,
+		DisplayName: "Disable Heartbeat",
+		Description: "Disable an Opsgenie heartbeat",
+		Arguments:   []*config.Field{heartbeatResourceIDArgument},
+		ReturnTypes: heartbeatReturnTypes,
+		ActionType:  []v2.ActionType{v2.ActionType_ACTION_TYPE_RESOURCE_DISABLE},
+	}
+)
+
+type heartbeatResourceType struct {
+	resourceType *v2.ResourceType
+	backend      *opsgenieBackend
+	filter       *resourceFilter
+}
+
+func (h *heartbeatResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return h.resourceType
+}
+
+// heartbeatResource creates a new connector resource for an OpsGenie heartbeat.
+// Heartbeats are identified by name and parented to their owner team when they have one.
+func heartbeatResource(heartbeat *ogHeartbeat.Heartbeat) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"heartbeat_name":  heartbeat.Name,
+		"description":     heartbeat.Description,
+		"interval":        heartbeat.Interval,
+		"interval_unit":   heartbeat.IntervalUnit,
+		"enabled":         heartbeat.Enabled,
+		"expired":         heartbeat.Expired,
+		"alert_priority":  heartbeat.AlertPriority,
+		"alert_message":   heartbeat.AlertMessage,
+		"owner_team_id":   heartbeat.OwnerTeam.Id,
+		"owner_team_name": heartbeat.OwnerTeam.Name,
+	}
+
+	status := v2.Status_RESOURCE_STATUS_ENABLED
+	if !heartbeat.Enabled {
+		status = v2.Status_RESOURCE_STATUS_DISABLED
+	}
+
+	opts := []rs.ResourceOption{
+		rs.WithResourceProfile(profile),
+		rs.WithDescription(heartbeat.Description),
+		rs.WithResourceStatus(status, ""),
+	}
+
+	if parentID := ownerTeamParentResourceID(heartbeat.OwnerTeam.Id); parentID != nil {
+		opts = append(opts, rs.WithParentResourceID(parentID))
+	}
+
+	resource, err := rs.NewResource(
+		heartbeat.Name,
+		resourceTypeHeartbeat,
+		heartbeat.Name,
+		opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (h *heartbeatResourceType) List(ctx context.Context, parentID *v2.ResourceId, _ rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error) {
+	if parentID != nil {
+		return nil, nil, nil
+	}
+
+	heartbeats, err := h.backend.heartbeats.List(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list heartbeats: %w", translateAPIError(h.backend.failures, err))
+	}
+
+	var rv []*v2.Resource
+	for _, heartbeat := range heartbeats.Heartbeats {
+		heartbeatCopy := heartbeat
+		if heartbeatCopy.OwnerTeam.Id, err = h.filter.ownerTeamID(ctx, heartbeatCopy.OwnerTeam.Id); err != nil {
+			return nil, nil, err
+		}
+		if heartbeatCopy.OwnerTeam.Id == "" {
+			heartbeatCopy.OwnerTeam.Name = ""
+		}
+
+		hr, err := heartbeatResource(&heartbeatCopy)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rv = append(rv, hr)
+	}
+
+	return rv, &rs.SyncOpResults{}, nil
+}
+
+func (h *heartbeatResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Entitlement, *rs.SyncOpResults, error) {
+	return nil, nil, nil
+}
+
+func (h *heartbeatResourceType) Grants(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error) {
+	return nil, nil, nil
+}
+
+func (h *heartbeatResourceType) ResourceActions(ctx context.Context, registry actions.ActionRegistry) error {
+	if err := registry.Register(ctx, enableHeartbeatActionSchema, h.enableHeartbeat); err != nil {
+		return err
+	}
+
+	return registry.Register(ctx, disableHeartbeatActionSchema, h.disableHeartbeat)
+}
+
+func (h *heartbeatResourceType) enableHeartbeat(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	return h.setHeartbeatEnabled(ctx, args, true)
+}
+
+func (h *heartbeatResourceType) disableHeartbeat(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	return h.setHeartbeatEnabled(ctx, args, false)
+}
+
+func (h *heartbeatResourceType) setHeartbeatEnabled(ctx context.Context, args *structpb.Struct, enabled bool) (*structpb.Struct, annotations.Annotations, error) {
+	resourceID, err := requireResourceIDArg(args, "resource_id", resourceTypeHeartbeat)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var info *ogHeartbeat.HeartbeatInfo
+	if enabled {
+		info, err = h.backend.heartbeats.Enable(ctx, resourceID.Resource)
+	} else {
+		info, err = h.backend.heartbeats.Disable(ctx, resourceID.Resource)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to update heartbeat %s: %w", resourceID.Resource, translateAPIError(h.backend.failures, err))
+	}
+
+	return actionResult(map[string]*structpb.Value{
+		"heartbeat_name": structpb.NewStringValue(info.Name),
+		"enabled":        structpb.NewBoolValue(info.Enabled),
+		"expired":        structpb.NewBoolValue(info.Expired),
+		"request_id":     structpb.NewStringValue(info.RequestId),
+	}), nil, nil
+}
+
+func heartbeatBuilder(b *opsgenieBackend, filter *resourceFilter) *heartbeatResourceType {
+	return &heartbeatResourceType{
+		resourceType: resourceTypeHeartbeat,
+		backend:      b,
+		filter:       filter,
+	}
+}
@@ -0,0 +1,165 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestHeartbeatList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/v2/heartbeats" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"heartbeats": []interface{}{
+			map[string]interface{}{
+				"name":         "backup-job",
+				"description":  "Nightly backups",
+				"interval":     1,
+				"intervalUnit": "days",
+				"enabled":      true,
+				"ownerTeam":    map[string]interface{}{"id": "team-1", "name": "ops"},
+			},
+			map[string]interface{}{
+				"name":      "legacy-job",
+				"enabled":   false,
+				"expired":   true,
+				"ownerTeam": map[string]interface{}{"id": "team-2", "name": "legacy"},
+			},
+		}}})
+	}))
+	defer srv.Close()
+
+	filter := &resourceFilter{teamExclude: regexp.MustCompile("^legacy$"), teams: map[string]bool{"team-2": true}}
+	builder := heartbeatBuilder(newTestOpsgenieBackend(t, newActionTestConnector(srv).config), filter)
+	ctx := context.Background()
+
+	// Heartbeats are only listed at the top level.
+	heartbeats, _, err := builder.List(ctx, &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: "team-1"}, res.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(heartbeats) != 0 {
+		t.Errorf("expected no heartbeats under a team, got %d", len(heartbeats))
+	}
+
+	heartbeats, _, err = builder.List(ctx, nil, res.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(heartbeats) != 2 {
+		t.Fatalf("expected 2 heartbeats, got %d", len(heartbeats))
+	}
+
+	hb := heartbeats[0]
+	if hb.GetId().GetResource() != "backup-job" || hb.GetDisplayName() != "backup-job" {
+		t.Errorf("unexpected heartbeat %s (%s)", hb.GetDisplayName(), hb.GetId().GetResource())
+	}
+	if hb.GetParentResourceId().GetResourceType() != resourceTypeTeam.Id || hb.GetParentResourceId().GetResource() != "team-1" {
+		t.Errorf("expected the heartbeat to be parented to team-1, got %v", hb.GetParentResourceId())
+	}
+	if hb.GetStatus().GetStatus() != v2.Status_RESOURCE_STATUS_ENABLED {
+		t.Errorf("expected the heartbeat to be enabled, got %v", hb.GetStatus().GetStatus())
+	}
+	if v, _ := res.GetProfileStringValue(res.GetProfile(hb), "interval_unit"); v != "days" {
+		t.Errorf("expected interval unit days, got %q", v)
+	}
+
+	// The owner team of the second heartbeat is filtered out, so it isn't parented or named.
+	hb = heartbeats[1]
+	if hb.GetParentResourceId() != nil {
+		t.Errorf("expected no parent for a filtered out owner team, got %v", hb.GetParentResourceId())
+	}
+	if v, _ := res.GetProfileStringValue(res.GetProfile(hb), "owner_team_name"); v != "" {
+		t.Errorf("expected no owner team name, got %q", v)
+	}
+	if hb.GetStatus().GetStatus() != v2.Status_RESOURCE_STATUS_DISABLED {
+		t.Errorf("expected the heartbeat to be disabled, got %v", hb.GetStatus().GetStatus())
+	}
+}
+
+func TestHeartbeatActions(t *testing.T) {
+	tests := map[string]struct {
+		enabled bool
+		path    string
+	}{
+		enableHeartbeatAction:  {enabled: true, path: "/v2/heartbeats/backup-job/enable"},
+		disableHeartbeatAction: {enabled: false, path: "/v2/heartbeats/backup-job/disable"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodPost || r.URL.Path != tt.path {
+					t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+
+				writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+					"name":    "backup-job",
+					"enabled": tt.enabled,
+					"expired": false,
+				}})
+			}))
+			defer srv.Close()
+
+			h := heartbeatBuilder(newTestOpsgenieBackend(t, newActionTestConnector(srv).config), nil)
+			args := &structpb.Struct{Fields: map[string]*structpb.Value{
+				"resource_id": resourceIDValue(resourceTypeHeartbeat.Id, "backup-job"),
+			}}
+
+			var (
+				rv  *structpb.Struct
+				err error
+			)
+			if tt.enabled {
+				rv, _, err = h.enableHeartbeat(context.Background(), args)
+			} else {
+				rv, _, err = h.disableHeartbeat(context.Background(), args)
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !rv.Fields["success"].GetBoolValue() {
+				t.Error("expected success")
+			}
+			if got := rv.Fields["heartbeat_name"].GetStringValue(); got != "backup-job" {
+				t.Errorf("expected heartbeat name backup-job, got %q", got)
+			}
+			if got := rv.Fields["enabled"].GetBoolValue(); got != tt.enabled {
+				t.Errorf("expected enabled to be %v, got %v", tt.enabled, got)
+			}
+			if got := rv.Fields["request_id"].GetStringValue(); got != "test-request-id" {
+				t.Errorf("expected request id to be returned, got %q", got)
+			}
+		})
+	}
+}
+
+func TestHeartbeatActions_WrongResourceType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	h := heartbeatBuilder(newTestOpsgenieBackend(t, newActionTestConnector(srv).config), nil)
+	_, _, err := h.enableHeartbeat(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		"resource_id": resourceIDValue(resourceTypeTeam.Id, "team-1"),
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a non-heartbeat resource, got %v", err)
+	}
+}
@@ -1,8 +1,16 @@
 package connector
 
 import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
@@ -14,6 +22,110 @@ func annotationsForUserResourceType() annotations.Annotations {
 	return annos
 }
 
+func annotationsForHeartbeatResourceType() annotations.Annotations {
+	annos := annotations.Annotations{}
+	annos.Update(&v2.SkipEntitlementsAndGrants{})
+	return annos
+}
+
+func annotationsForServiceResourceType() annotations.Annotations {
+	annos := annotations.Annotations{}
+	annos.Update(&v2.SkipEntitlementsAndGrants{})
+	return annos
+}
+
+func annotationsForUnknownPrincipalResourceType() annotations.Annotations {
+	annos := annotations.Annotations{}
+	annos.Update(&v2.SkipEntitlementsAndGrants{})
+	return annos
+}
+
+func annotationsForAccountResourceType() annotations.Annotations {
+	annos := annotations.Annotations{}
+	annos.Update(&v2.SkipEntitlementsAndGrants{})
+	return annos
+}
+
+// ownerTeamParentResourceID returns the resource ID of the team owning an object, or nil if it has no owner team.
+func ownerTeamParentResourceID(teamID string) *v2.ResourceId {
+	if teamID == "" {
+		return nil
+	}
+
+	return &v2.ResourceId{
+		ResourceType: resourceTypeTeam.Id,
+		Resource:     teamID,
+	}
+}
+
+// isNotFound reports whether err is a 404 returned by the Opsgenie API.
+func isNotFound(err error) bool {
+	var apiErr *ogclient.ApiError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// entitlementSlug returns the slug of an entitlement, falling back to the last segment of its ID.
+func entitlementSlug(entitlement *v2.Entitlement) string {
+	if slug := entitlement.GetSlug(); slug != "" {
+		return slug
+	}
+
+	id := entitlement.GetId()
+	return id[strings.LastIndex(id, ":")+1:]
+}
+
+// entitlementID returns the ID of an entitlement of another resource, built the same way the SDK
+// builds the IDs of the entitlements it creates.
+func entitlementID(resourceType *v2.ResourceType, resourceID, slug string) string {
+	return ent.NewEntitlementID(&v2.Resource{
+		Id: &v2.ResourceId{
+			ResourceType: resourceType.Id,
+			Resource:     resourceID,
+		},
+	}, slug)
+}
+
+// participantEntitlements maps the participant types that stand for a group of people to the
+// entitlement whose holders are those people: the members of a team, the users on call for a
+// schedule and the recipients of an escalation.
+var participantEntitlements = map[string]struct {
+	resourceType *v2.ResourceType
+	slug         string
+}{
+	teamParticipantType:       {resourceTypeTeam, teamMemberEntitlement},
+	scheduleParticipantType:   {resourceTypeSchedule, scheduleOnCall},
+	escalationParticipantType: {resourceTypeEscalation, escalationRecipient},
+}
+
+// participantGrant grants an entitlement to a schedule rotation, on-call or escalation participant.
+// Grants to group-like participants are expandable, so that they reach the individual users behind
+// them, through any number of nested teams, schedules and escalations.
+func participantGrant(resource *v2.Resource, entitlement, participantType, participantID string) (*v2.Grant, error) {
+	if participantType == userParticipantType {
+		return grant.NewGrant(resource, entitlement, &v2.ResourceId{
+			ResourceType: resourceTypeUser.Id,
+			Resource:     participantID,
+		}), nil
+	}
+
+	group, ok := participantEntitlements[participantType]
+	if !ok {
+		return nil, fmt.Errorf("opsgenie-connector: unknown participant type: %s", participantType)
+	}
+
+	return grant.NewGrant(
+		resource,
+		entitlement,
+		&v2.ResourceId{
+			ResourceType: group.resourceType.Id,
+			Resource:     participantID,
+		},
+		grant.WithAnnotation(&v2.GrantExpandable{
+			EntitlementIds: []string{entitlementID(group.resourceType, participantID, group.slug)},
+		}),
+	), nil
+}
+
 func getProfileStringArray(profile *structpb.Struct, k string) ([]string, bool) {
 	var values []string
 	if profile == nil {
@@ -0,0 +1,732 @@
+package connector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	"github.com/conductorone/baton-sdk/pkg/types/grant"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sdk/pkg/types/sessions"
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// With several accounts configured, each account is synced by its own connector, and its resources
+// are parented by an account resource. Resource IDs are prefixed with the account name, so that the
+// same Opsgenie ID in two tenants doesn't collide. A single account keeps its IDs unprefixed.
+
+const (
+	accountRegionUS = "us"
+	accountRegionEU = "eu"
+
+	accountIDSeparator = "/"
+)
+
+// opsgenieAccount is one of the accounts of a multi-account configuration.
+type opsgenieAccount struct {
+	name   string
+	region string
+	conn   *Opsgenie
+}
+
+// parseAccount parses an account entry of the accounts setting, formatted as name:region:api-key.
+func parseAccount(entry string) (name, region, apiKey string, err error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return "", "", "", errors.New("opsgenie-connector: invalid account, expected name:region:api-key")
+	}
+
+	name, region, apiKey = parts[0], strings.ToLower(parts[1]), parts[2]
+	if strings.Contains(name, accountIDSeparator) {
+		return "", "", "", fmt.Errorf("opsgenie-connector: account name %s can't contain %q", name, accountIDSeparator)
+	}
+	if region != accountRegionUS && region != accountRegionEU {
+		return "", "", "", fmt.Errorf("opsgenie-connector: account %s has unknown region %s, expected %s or %s", name, region, accountRegionUS, accountRegionEU)
+	}
+
+	return name, region, apiKey, nil
+}
+
+// newMultiAccount creates a connector for every configured account. Actions run in the account of
+// their resource arguments, and tickets are filed in the first account.
+func newMultiAccount(ctx context.Context, opsgenieConfig *cfg.Opsgenie) (*Opsgenie, error) {
+	if opsgenieConfig.Backend == backendJSMOps {
+		return nil, fmt.Errorf("opsgenie-connector: accounts can't be used with the %s backend", backendJSMOps)
+	}
+
+	var accounts []*opsgenieAccount
+	seen := make(map[string]bool)
+	for _, entry := range opsgenieConfig.Accounts {
+		name, region, apiKey, err := parseAccount(entry)
+		if err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("opsgenie-connector: account %s is configured more than once", name)
+		}
+		seen[name] = true
+
+		accountConfig := *opsgenieConfig
+		accountConfig.Accounts = nil
+		accountConfig.ApiKey = apiKey
+		if accountConfig.BaseUrl == "" && region == accountRegionEU {
+			accountConfig.BaseUrl = string(ogclient.API_URL_EU)
+		}
+
+		conn, err := New(ctx, &accountConfig)
+		if err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: account %s: %w", name, err)
+		}
+		accounts = append(accounts, &opsgenieAccount{name: name, region: region, conn: conn})
+	}
+
+	return newAccountsConnector(accounts), nil
+}
+
+func newAccountsConnector(accounts []*opsgenieAccount) *Opsgenie {
+	rv := *accounts[0].conn
+	rv.accounts = accounts
+	return &rv
+}
+
+// accountSyncers returns the syncers of every account, merged by resource type.
+func (c *Opsgenie) accountSyncers(ctx context.Context) []connectorbuilder.ResourceSyncerV2 {
+	var resourceTypes []*v2.ResourceType
+	byType := make(map[string]map[string]connectorbuilder.ResourceSyncerV2)
+	for _, account := range c.accounts {
+		for _, syncer := range account.conn.ResourceSyncers(ctx) {
+			rt := syncer.ResourceType(ctx)
+			if byType[rt.Id] == nil {
+				byType[rt.Id] = make(map[string]connectorbuilder.ResourceSyncerV2)
+				resourceTypes = append(resourceTypes, rt)
+			}
+			byType[rt.Id][account.name] = syncer
+		}
+	}
+
+	syncers := []connectorbuilder.ResourceSyncerV2{accountBuilder(c.accounts, resourceTypes)}
+	for _, rt := range resourceTypes {
+		syncers = append(syncers, newAccountScopedSyncer(rt, byType[rt.Id]))
+	}
+
+	return syncers
+}
+
+type accountResourceType struct {
+	resourceType *v2.ResourceType
+	accounts     []*opsgenieAccount
+	children     []*v2.ResourceType
+}
+
+func (a *accountResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return a.resourceType
+}
+
+// List returns the configured accounts. Every synced resource type is listed under them, except
+// forwarding rules, which are listed under their user.
+func (a *accountResourceType) List(_ context.Context, parentID *v2.ResourceId, _ rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error) {
+	if parentID != nil {
+		return nil, &rs.SyncOpResults{}, nil
+	}
+
+	var children []proto.Message
+	for _, rt := range a.children {
+		if rt.Id != resourceTypeForwardingRule.Id {
+			children = append(children, &v2.ChildResourceType{ResourceTypeId: rt.Id})
+		}
+	}
+
+	rv := make([]*v2.Resource, 0, len(a.accounts))
+	for _, account := range a.accounts {
+		r, err := rs.NewResource(
+			account.name,
+			resourceTypeAccount,
+			account.name,
+			rs.WithResourceProfile(map[string]interface{}{
+				"account_name": account.name,
+				"region":       account.region,
+			}),
+			rs.WithAnnotation(children...),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		rv = append(rv, r)
+	}
+
+	return rv, &rs.SyncOpResults{}, nil
+}
+
+func (a *accountResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Entitlement, *rs.SyncOpResults, error) {
+	return nil, &rs.SyncOpResults{}, nil
+}
+
+func (a *accountResourceType) Grants(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error) {
+	return nil, &rs.SyncOpResults{}, nil
+}
+
+func accountBuilder(accounts []*opsgenieAccount, children []*v2.ResourceType) *accountResourceType {
+	return &accountResourceType{
+		resourceType: resourceTypeAccount,
+		accounts:     accounts,
+		children:     children,
+	}
+}
+
+// accountScope namespaces the IDs returned by the syncers of an account.
+type accountScope string
+
+func (a accountScope) id(id string) string {
+	return string(a) + accountIDSeparator + id
+}
+
+func (a accountScope) resourceID(id *v2.ResourceId) *v2.ResourceId {
+	if id == nil {
+		return nil
+	}
+
+	return &v2.ResourceId{ResourceType: id.GetResourceType(), Resource: a.id(id.GetResource())}
+}
+
+// entitlementID namespaces the resource part of a type:resource:slug entitlement ID.
+func (a accountScope) entitlementID(id string) string {
+	first, last := strings.Index(id, ":"), strings.LastIndex(id, ":")
+	if first < 0 || first == last {
+		return id
+	}
+
+	return id[:first+1] + a.id(id[first+1:last]) + id[last:]
+}
+
+// resource namespaces a resource, parenting it to the account if it has no parent.
+func (a accountScope) resource(r *v2.Resource) *v2.Resource {
+	if r == nil {
+		return nil
+	}
+
+	r.Id = a.resourceID(r.GetId())
+	if parentID := r.GetParentResourceId(); parentID != nil {
+		r.ParentResourceId = a.resourceID(parentID)
+	} else {
+		r.ParentResourceId = &v2.ResourceId{ResourceType: resourceTypeAccount.Id, Resource: string(a)}
+	}
+
+	return r
+}
+
+// principal namespaces the principal of a grant, which only carries the IDs of the resource.
+func (a accountScope) principal(r *v2.Resource) *v2.Resource {
+	r.Id = a.resourceID(r.GetId())
+	r.ParentResourceId = a.resourceID(r.GetParentResourceId())
+	return r
+}
+
+func (a accountScope) entitlement(e *v2.Entitlement, resource *v2.Resource) *v2.Entitlement {
+	e.Id = ent.NewEntitlementID(resource, entitlementSlug(e))
+	e.Resource = resource
+	return e
+}
+
+func (a accountScope) grant(g *v2.Grant, resource *v2.Resource) *v2.Grant {
+	g.Entitlement = a.entitlement(g.GetEntitlement(), resource)
+	g.Principal = a.principal(g.GetPrincipal())
+
+	annos := annotations.Annotations(g.GetAnnotations())
+	expandable := &v2.GrantExpandable{}
+	if ok, err := annos.Pick(expandable); err == nil && ok {
+		for i, id := range expandable.GetEntitlementIds() {
+			expandable.EntitlementIds[i] = a.entitlementID(id)
+		}
+		annos.Update(expandable)
+		g.Annotations = annos
+	}
+
+	g.Id = grant.NewGrantID(g.GetPrincipal(), g.GetEntitlement())
+	return g
+}
+
+// splitAccountScopedID returns the account and the Opsgenie ID of a namespaced ID.
+func splitAccountScopedID(id string) (accountScope, string, error) {
+	account, rawID, ok := strings.Cut(id, accountIDSeparator)
+	if !ok {
+		return "", "", status.Errorf(codes.InvalidArgument, "opsgenie-connector: resource ID %s has no account", id)
+	}
+
+	return accountScope(account), rawID, nil
+}
+
+func unscopeResourceID(id *v2.ResourceId) (accountScope, *v2.ResourceId, error) {
+	account, rawID, err := splitAccountScopedID(id.GetResource())
+	if err != nil {
+		return "", nil, err
+	}
+
+	return account, &v2.ResourceId{ResourceType: id.GetResourceType(), Resource: rawID}, nil
+}
+
+// unscopeResource returns a copy of a namespaced resource as its account's syncers know it.
+func unscopeResource(r *v2.Resource) (accountScope, *v2.Resource, error) {
+	account, id, err := unscopeResourceID(r.GetId())
+	if err != nil {
+		return "", nil, err
+	}
+
+	rv := proto.Clone(r).(*v2.Resource)
+	rv.Id = id
+	rv.ParentResourceId = nil
+	if parentID := r.GetParentResourceId(); parentID != nil && parentID.GetResourceType() != resourceTypeAccount.Id {
+		if _, rv.ParentResourceId, err = unscopeResourceID(parentID); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return account, rv, nil
+}
+
+func unscopeEntitlement(e *v2.Entitlement) (accountScope, *v2.Entitlement, error) {
+	account, resource, err := unscopeResource(e.GetResource())
+	if err != nil {
+		return "", nil, err
+	}
+
+	rv := proto.Clone(e).(*v2.Entitlement)
+	rv.Resource = resource
+	rv.Id = ent.NewEntitlementID(resource, entitlementSlug(e))
+	return account, rv, nil
+}
+
+// accountSessionStore keeps the session values of an account apart from the other accounts'.
+type accountSessionStore struct {
+	sessions.SessionStore
+	account accountScope
+}
+
+func (s *accountSessionStore) options(opt []sessions.SessionStoreOption) []sessions.SessionStoreOption {
+	return append(opt, func(_ context.Context, bag *sessions.SessionStoreBag) error {
+		bag.Prefix = s.account.id(bag.Prefix)
+		return nil
+	})
+}
+
+func (s *accountSessionStore) Get(ctx context.Context, key string, opt ...sessions.SessionStoreOption) ([]byte, bool, error) {
+	return s.SessionStore.Get(ctx, key, s.options(opt)...)
+}
+
+func (s *accountSessionStore) GetMany(ctx context.Context, keys []string, opt ...sessions.SessionStoreOption) (map[string][]byte, []string, error) {
+	return s.SessionStore.GetMany(ctx, keys, s.options(opt)...)
+}
+
+func (s *accountSessionStore) Set(ctx context.Context, key string, value []byte, opt ...sessions.SessionStoreOption) error {
+	return s.SessionStore.Set(ctx, key, value, s.options(opt)...)
+}
+
+func (s *accountSessionStore) SetMany(ctx context.Context, values map[string][]byte, opt ...sessions.SessionStoreOption) error {
+	return s.SessionStore.SetMany(ctx, values, s.options(opt)...)
+}
+
+func (s *accountSessionStore) Delete(ctx context.Context, key string, opt ...sessions.SessionStoreOption) error {
+	return s.SessionStore.Delete(ctx, key, s.options(opt)...)
+}
+
+func (s *accountSessionStore) Clear(ctx context.Context, opt ...sessions.SessionStoreOption) error {
+	return s.SessionStore.Clear(ctx, s.options(opt)...)
+}
+
+func (s *accountSessionStore) GetAll(ctx context.Context, pageToken string, opt ...sessions.SessionStoreOption) (map[string][]byte, string, error) {
+	return s.SessionStore.GetAll(ctx, pageToken, s.options(opt)...)
+}
+
+// accountScopedSyncer syncs a resource type of every account, through each account's own syncer.
+type accountScopedSyncer struct {
+	resourceType *v2.ResourceType
+	syncers      map[string]connectorbuilder.ResourceSyncerV2
+}
+
+// newAccountScopedSyncer returns a syncer providing the targeted sync and provisioning of the
+// account syncers, if they have them.
+func newAccountScopedSyncer(rt *v2.ResourceType, syncers map[string]connectorbuilder.ResourceSyncerV2) connectorbuilder.ResourceSyncerV2 {
+	base := &accountScopedSyncer{resourceType: rt, syncers: syncers}
+
+	targeted, provisioner := true, true
+	for _, syncer := range syncers {
+		_, ok := syncer.(connectorbuilder.ResourceTargetedSyncerLimited)
+		targeted = targeted && ok
+		_, ok = syncer.(connectorbuilder.ResourceProvisionerLimited)
+		provisioner = provisioner && ok
+	}
+
+	switch {
+	case provisioner && targeted:
+		return &accountScopedProvisioner{accountScopedTargetedSyncer{base}}
+	case targeted:
+		return &accountScopedTargetedSyncer{base}
+	default:
+		return base
+	}
+}
+
+func (s *accountScopedSyncer) ResourceType(_ context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+func (s *accountScopedSyncer) syncer(account accountScope) (connectorbuilder.ResourceSyncerV2, error) {
+	syncer, ok := s.syncers[string(account)]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "opsgenie-connector: account %s has no %s resources", account, s.resourceType.Id)
+	}
+
+	return syncer, nil
+}
+
+func (s *accountScopedSyncer) scopeOpts(account accountScope, opts rs.SyncOpAttrs) rs.SyncOpAttrs {
+	if opts.Session != nil {
+		opts.Session = &accountSessionStore{SessionStore: opts.Session, account: account}
+	}
+	return opts
+}
+
+// List lists the resources of an account, or the children of a namespaced resource.
+func (s *accountScopedSyncer) List(ctx context.Context, parentID *v2.ResourceId, opts rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error) {
+	if parentID == nil {
+		return nil, &rs.SyncOpResults{}, nil
+	}
+
+	account := accountScope(parentID.GetResource())
+	var innerID *v2.ResourceId
+	if parentID.GetResourceType() != resourceTypeAccount.Id {
+		var err error
+		if account, innerID, err = unscopeResourceID(parentID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	syncer, ok := s.syncers[string(account)]
+	if !ok {
+		return nil, &rs.SyncOpResults{}, nil
+	}
+
+	resources, results, err := syncer.List(ctx, innerID, s.scopeOpts(account, opts))
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: account %s: %w", account, err)
+	}
+
+	for _, r := range resources {
+		account.resource(r)
+	}
+
+	return resources, results, nil
+}
+
+func (s *accountScopedSyncer) Entitlements(ctx context.Context, resource *v2.Resource, opts rs.SyncOpAttrs) ([]*v2.Entitlement, *rs.SyncOpResults, error) {
+	account, inner, err := unscopeResource(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	syncer, err := s.syncer(account)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entitlements, results, err := syncer.Entitlements(ctx, inner, s.scopeOpts(account, opts))
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: account %s: %w", account, err)
+	}
+
+	for _, e := range entitlements {
+		account.entitlement(e, resource)
+	}
+
+	return entitlements, results, nil
+}
+
+func (s *accountScopedSyncer) Grants(ctx context.Context, resource *v2.Resource, opts rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error) {
+	account, inner, err := unscopeResource(resource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	syncer, err := s.syncer(account)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	grants, results, err := syncer.Grants(ctx, inner, s.scopeOpts(account, opts))
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: account %s: %w", account, err)
+	}
+
+	for _, g := range grants {
+		account.grant(g, resource)
+	}
+
+	return grants, results, nil
+}
+
+type accountScopedTargetedSyncer struct {
+	*accountScopedSyncer
+}
+
+func (s *accountScopedTargetedSyncer) Get(ctx context.Context, resourceID *v2.ResourceId, parentResourceID *v2.ResourceId) (*v2.Resource, annotations.Annotations, error) {
+	account, innerID, err := unscopeResourceID(resourceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var innerParentID *v2.ResourceId
+	if parentResourceID != nil && parentResourceID.GetResourceType() != resourceTypeAccount.Id {
+		if _, innerParentID, err = unscopeResourceID(parentResourceID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	syncer, err := s.syncer(account)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	targeted, ok := syncer.(connectorbuilder.ResourceTargetedSyncerLimited)
+	if !ok {
+		return nil, nil, status.Errorf(codes.Unimplemented, "opsgenie-connector: account %s can't get %s resources", account, s.resourceType.Id)
+	}
+
+	r, annos, err := targeted.Get(ctx, innerID, innerParentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return account.resource(r), annos, nil
+}
+
+type accountScopedProvisioner struct {
+	accountScopedTargetedSyncer
+}
+
+func (s *accountScopedProvisioner) provisioner(account accountScope) (connectorbuilder.ResourceProvisionerLimited, error) {
+	syncer, err := s.syncer(account)
+	if err != nil {
+		return nil, err
+	}
+
+	provisioner, ok := syncer.(connectorbuilder.ResourceProvisionerLimited)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "opsgenie-connector: account %s can't provision %s resources", account, s.resourceType.Id)
+	}
+
+	return provisioner, nil
+}
+
+// Grant provisions an entitlement in the principal's account. Principals can't be granted
+// entitlements of another account.
+func (s *accountScopedProvisioner) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	account, innerEntitlement, err := unscopeEntitlement(entitlement)
+	if err != nil {
+		return nil, err
+	}
+
+	principalAccount, innerPrincipal, err := unscopeResource(principal)
+	if err != nil {
+		return nil, err
+	}
+	if principalAccount != account {
+		return nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: %s of account %s can't be granted an entitlement of account %s",
+			principal.GetId().GetResourceType(), principalAccount, account)
+	}
+
+	provisioner, err := s.provisioner(account)
+	if err != nil {
+		return nil, err
+	}
+
+	return provisioner.Grant(ctx, innerPrincipal, innerEntitlement)
+}
+
+func (s *accountScopedProvisioner) Revoke(ctx context.Context, g *v2.Grant) (annotations.Annotations, error) {
+	account, innerEntitlement, err := unscopeEntitlement(g.GetEntitlement())
+	if err != nil {
+		return nil, err
+	}
+
+	_, innerPrincipal, err := unscopeResource(g.GetPrincipal())
+	if err != nil {
+		return nil, err
+	}
+
+	provisioner, err := s.provisioner(account)
+	if err != nil {
+		return nil, err
+	}
+
+	inner := proto.Clone(g).(*v2.Grant)
+	inner.Entitlement = innerEntitlement
+	inner.Principal = innerPrincipal
+	inner.Id = grant.NewGrantID(innerPrincipal, innerEntitlement)
+
+	return provisioner.Revoke(ctx, inner)
+}
+
+// actionRecorder collects the actions an account registers, so that they can be registered once
+// for all accounts.
+type actionRecorder struct {
+	schemas  map[string]*v2.BatonActionSchema
+	handlers map[string]actions.ActionHandler
+}
+
+func newActionRecorder() *actionRecorder {
+	return &actionRecorder{
+		schemas:  make(map[string]*v2.BatonActionSchema),
+		handlers: make(map[string]actions.ActionHandler),
+	}
+}
+
+func (r *actionRecorder) Register(ctx context.Context, schema *v2.BatonActionSchema, handler actions.ActionHandler) error {
+	return r.RegisterAction(ctx, schema.GetName(), schema, handler)
+}
+
+func (r *actionRecorder) RegisterAction(_ context.Context, name string, schema *v2.BatonActionSchema, handler actions.ActionHandler) error {
+	r.schemas[name] = schema
+	r.handlers[name] = handler
+	return nil
+}
+
+// registerAccountActions registers every action of the accounts once. The action runs in the
+// account of its resource ID arguments, which must all belong to the same account, and returns
+// that account's name next to its results.
+func registerAccountActions(ctx context.Context, registry actions.ActionRegistry, recorders map[accountScope]*actionRecorder) error {
+	accounts := make([]string, 0, len(recorders))
+	for account := range recorders {
+		accounts = append(accounts, string(account))
+	}
+	sort.Strings(accounts)
+
+	schemas := make(map[string]*v2.BatonActionSchema)
+	handlers := make(map[string]map[accountScope]actions.ActionHandler)
+	var names []string
+	for _, account := range accounts {
+		recorder := recorders[accountScope(account)]
+		for name, schema := range recorder.schemas {
+			if handlers[name] == nil {
+				handlers[name] = make(map[accountScope]actions.ActionHandler)
+				schemas[name] = schema
+				names = append(names, name)
+			}
+			handlers[name][accountScope(account)] = recorder.handlers[name]
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		schema := proto.Clone(schemas[name]).(*v2.BatonActionSchema)
+		schema.ReturnTypes = append(schema.ReturnTypes, stringReturnType("account"))
+
+		if err := registry.RegisterAction(ctx, name, schema, routeAccountAction(schema, handlers[name])); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// routeAccountAction returns a handler running an action in the account of its resource ID
+// arguments, with the account prefix removed from them.
+func routeAccountAction(schema *v2.BatonActionSchema, handlers map[accountScope]actions.ActionHandler) actions.ActionHandler {
+	return func(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+		inner := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(args.GetFields()))}
+		for k, v := range args.GetFields() {
+			inner.Fields[k] = v
+		}
+
+		var account accountScope
+		for _, field := range schema.GetArguments() {
+			if field.GetResourceIdField() == nil {
+				continue
+			}
+			resourceID, ok := actions.GetResourceIDArg(args, field.GetName())
+			if !ok {
+				continue
+			}
+
+			argAccount, rawID, err := splitAccountScopedID(resourceID.GetResource())
+			if err != nil {
+				return nil, nil, err
+			}
+			if account != "" && argAccount != account {
+				return nil, nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: %s belongs to account %s, the other arguments of %s to account %s",
+					field.GetName(), argAccount, schema.GetName(), account)
+			}
+			account = argAccount
+
+			inner.Fields[field.GetName()] = structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+				"resource_type_id": structpb.NewStringValue(resourceID.GetResourceType()),
+				"resource_id":      structpb.NewStringValue(rawID),
+			}})
+		}
+		if account == "" {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: %s needs a resource ID argument to pick an account", schema.GetName())
+		}
+
+		handler, ok := handlers[account]
+		if !ok {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: account %s has no %s action", account, schema.GetName())
+		}
+
+		rv, annos, err := handler(ctx, inner)
+		if err != nil {
+			return nil, annos, fmt.Errorf("opsgenie-connector: account %s: %w", account, err)
+		}
+		if rv == nil {
+			rv = &structpb.Struct{}
+		}
+		if rv.Fields == nil {
+			rv.Fields = make(map[string]*structpb.Value)
+		}
+		rv.Fields["account"] = structpb.NewStringValue(string(account))
+
+		return rv, annos, nil
+	}
+}
+
+// accountGlobalActions registers the global actions of every account.
+func (c *Opsgenie) accountGlobalActions(ctx context.Context, registry actions.ActionRegistry) error {
+	recorders := make(map[accountScope]*actionRecorder, len(c.accounts))
+	for _, account := range c.accounts {
+		recorder := newActionRecorder()
+		if err := account.conn.GlobalActions(ctx, recorder); err != nil {
+			return fmt.Errorf("opsgenie-connector: account %s: %w", account.name, err)
+		}
+		recorders[accountScope(account.name)] = recorder
+	}
+
+	return registerAccountActions(ctx, registry, recorders)
+}
+
+// ResourceActions registers the resource actions of every account.
+func (s *accountScopedSyncer) ResourceActions(ctx context.Context, registry actions.ActionRegistry) error {
+	recorders := make(map[accountScope]*actionRecorder, len(s.syncers))
+	for account, syncer := range s.syncers {
+		provider, ok := syncer.(connectorbuilder.ResourceActionProvider)
+		if !ok {
+			continue
+		}
+
+		recorder := newActionRecorder()
+		if err := provider.ResourceActions(ctx, recorder); err != nil {
+			return fmt.Errorf("opsgenie-connector: account %s: %w", account, err)
+		}
+		recorders[accountScope(account)] = recorder
+	}
+
+	return registerAccountActions(ctx, registry, recorders)
+}
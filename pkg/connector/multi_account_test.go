@@ -0,0 +1,299 @@
+package connector
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newTestAccount returns an account synced from a fake.
+func newTestAccount(t *testing.T, name string, srv *opsgenietest.Server) *opsgenieAccount {
+	t.Helper()
+
+	conn := &Opsgenie{config: srv.Config()}
+	conn.backend = newTestOpsgenieBackend(t, conn.config)
+	conn.cache = newSyncCache(conn.backend)
+
+	return &opsgenieAccount{name: name, region: accountRegionUS, conn: conn}
+}
+
+// syncAccounts lists the accounts and the users, teams and schedules under them, and returns the
+// resources and grants by ID. The fakes don't serve the other resource types.
+func syncAccounts(t *testing.T, c *Opsgenie) (map[string]*v2.Resource, map[string]*v2.Grant) {
+	t.Helper()
+
+	ctx := context.Background()
+	syncers := make(map[string]connectorbuilder.ResourceSyncerV2)
+	for _, syncer := range c.ResourceSyncers(ctx) {
+		syncers[syncer.ResourceType(ctx).Id] = syncer
+	}
+
+	accounts, _, err := syncers[resourceTypeAccount.Id].List(ctx, nil, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error listing accounts: %v", err)
+	}
+
+	resources := make(map[string]*v2.Resource)
+	grants := make(map[string]*v2.Grant)
+	for _, account := range accounts {
+		resources[account.GetId().GetResource()] = account
+
+		for _, resourceType := range []string{resourceTypeTeam.Id, resourceTypeUser.Id, resourceTypeSchedule.Id} {
+			// Types are listed without a parent first, like the SDK does.
+			if rv, _, err := syncers[resourceType].List(ctx, nil, rs.SyncOpAttrs{}); err != nil || len(rv) != 0 {
+				t.Fatalf("expected no %s resources without an account, got %v, %v", resourceType, rv, err)
+			}
+
+			rv, _, err := syncers[resourceType].List(ctx, account.GetId(), rs.SyncOpAttrs{})
+			if err != nil {
+				t.Fatalf("unexpected error listing %s resources: %v", resourceType, err)
+			}
+
+			for _, r := range rv {
+				resources[r.GetId().GetResourceType()+":"+r.GetId().GetResource()] = r
+
+				gs, _, err := syncers[resourceType].Grants(ctx, r, rs.SyncOpAttrs{})
+				if err != nil {
+					t.Fatalf("unexpected error listing grants of %s: %v", r.GetId().GetResource(), err)
+				}
+				for _, g := range gs {
+					grants[g.GetId()] = g
+				}
+			}
+		}
+	}
+
+	return resources, grants
+}
+
+func TestMultiAccount_NamespacedIDs(t *testing.T) {
+	prod := newTenantServer(t)
+	staging := newTenantServer(t)
+
+	c := newAccountsConnector([]*opsgenieAccount{newTestAccount(t, "prod", prod), newTestAccount(t, "staging", staging)})
+	resources, grants := syncAccounts(t, c)
+
+	for _, account := range []string{"prod", "staging"} {
+		for _, id := range []string{"team:" + account + "/team-1", "user:" + account + "/user-1"} {
+			r, ok := resources[id]
+			if !ok {
+				t.Fatalf("missing resource %s, got %v", id, resources)
+			}
+			if parent := r.GetParentResourceId(); parent.GetResourceType() != resourceTypeAccount.Id || parent.GetResource() != account {
+				t.Errorf("expected %s to be parented by account %s, got %v", id, account, parent)
+			}
+		}
+
+		// Schedules keep their owner team as parent, in the same account.
+		schedule := resources["schedule:"+account+"/schedule-1"]
+		if parent := schedule.GetParentResourceId(); parent.GetResourceType() != resourceTypeTeam.Id || parent.GetResource() != account+"/team-1" {
+			t.Errorf("expected the schedule of %s to be parented by its owner team, got %v", account, parent)
+		}
+
+		member := grants["team:"+account+"/team-1:member:user:"+account+"/user-1"]
+		if member == nil || member.GetEntitlement().GetResource().GetId().GetResource() != account+"/team-1" {
+			t.Errorf("missing team membership grant of %s, got %v", account, grants)
+		}
+
+		teamRotation := grants["schedule:"+account+"/schedule-1:member:team:"+account+"/team-1"]
+		annos := annotations.Annotations(teamRotation.GetAnnotations())
+		expandable := &v2.GrantExpandable{}
+		if ok, _ := annos.Pick(expandable); !ok ||
+			len(expandable.GetEntitlementIds()) != 1 || expandable.GetEntitlementIds()[0] != "team:"+account+"/team-1:member" {
+			t.Errorf("expected the team rotation grant of %s to expand the namespaced team, got %v", account, expandable)
+		}
+	}
+
+	for id := range grants {
+		if !strings.Contains(id, ":prod/") && !strings.Contains(id, ":staging/") {
+			t.Errorf("grant ID %s isn't namespaced", id)
+		}
+	}
+}
+
+func TestMultiAccount_SingleAccountIDsUnchanged(t *testing.T) {
+	srv := newTenantServer(t)
+
+	c := newTestAccount(t, "prod", srv).conn
+	for _, syncer := range c.ResourceSyncers(context.Background()) {
+		if syncer.ResourceType(context.Background()).Id == resourceTypeAccount.Id {
+			t.Fatal("unexpected account resource type for a single account")
+		}
+	}
+
+	ids := syncIDs(t, c.backend)
+	for _, id := range ids {
+		if strings.Contains(id, "prod/") {
+			t.Errorf("unexpected namespaced ID %s", id)
+		}
+	}
+}
+
+func TestMultiAccount_TargetedGet(t *testing.T) {
+	srv := newTenantServer(t)
+
+	ctx := context.Background()
+	c := newAccountsConnector([]*opsgenieAccount{newTestAccount(t, "prod", srv)})
+
+	var schedules connectorbuilder.ResourceTargetedSyncerLimited
+	for _, syncer := range c.ResourceSyncers(ctx) {
+		if syncer.ResourceType(ctx).Id == resourceTypeSchedule.Id {
+			schedules, _ = syncer.(connectorbuilder.ResourceTargetedSyncerLimited)
+		}
+	}
+	if schedules == nil {
+		t.Fatal("expected the schedules of every account to support targeted sync")
+	}
+
+	if _, _, err := schedules.Get(ctx, &v2.ResourceId{ResourceType: resourceTypeSchedule.Id, Resource: "schedule-1"}, nil); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected codes.InvalidArgument for an ID without account, got %v", err)
+	}
+	if _, _, err := schedules.Get(ctx, &v2.ResourceId{ResourceType: resourceTypeSchedule.Id, Resource: "other/schedule-1"}, nil); status.Code(err) != codes.NotFound {
+		t.Errorf("expected codes.NotFound for an unknown account, got %v", err)
+	}
+}
+
+func TestParseAccount(t *testing.T) {
+	name, region, apiKey, err := parseAccount("prod:EU:key:with:colons")
+	if err != nil || name != "prod" || region != accountRegionEU || apiKey != "key:with:colons" {
+		t.Errorf("unexpected account %s %s %s: %v", name, region, apiKey, err)
+	}
+
+	for _, entry := range []string{"prod", "prod:us:", "prod:apac:key", "a/b:us:key"} {
+		if _, _, _, err := parseAccount(entry); err == nil {
+			t.Errorf("expected an error for %q", entry)
+		}
+	}
+
+	// Errors never include the API key.
+	if _, _, _, err := parseAccount("prod:apac:secret-key"); err == nil || strings.Contains(err.Error(), "secret-key") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// newFakeAccountsConnector returns a connector syncing a prod and a staging fake, which hold the
+// same IDs: user-1 and user-2, team-1 with user-1, and schedule-1 with user-1 on call in prod and
+// user-2 in staging.
+func newFakeAccountsConnector(t *testing.T) (*Opsgenie, *opsgenietest.Server, *opsgenietest.Server) {
+	t.Helper()
+
+	var accounts []*opsgenieAccount
+	servers := make(map[string]*opsgenietest.Server)
+	for _, name := range []string{"prod", "staging"} {
+		srv := opsgenietest.NewServer(t)
+		srv.AddUser(opsgenietest.User{ID: "user-1", Username: "jane@example.com"})
+		srv.AddUser(opsgenietest.User{ID: "user-2", Username: "john@example.com"})
+		srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "sre", Members: []opsgenietest.Member{{UserID: "user-1"}}})
+		srv.AddSchedule(opsgenietest.Schedule{ID: "schedule-1", Name: "primary", Enabled: true})
+		onCall := "user-1"
+		if name == "staging" {
+			onCall = "user-2"
+		}
+		srv.SetOnCall("schedule-1", opsgenietest.Participant{Type: opsgenietest.UserParticipant, ID: onCall})
+
+		conn, err := New(context.Background(), &cfg.Opsgenie{ApiKey: opsgenietest.APIKey, BaseUrl: srv.APIURL()})
+		if err != nil {
+			t.Fatalf("failed to create connector: %v", err)
+		}
+		accounts = append(accounts, &opsgenieAccount{name: name, region: accountRegionUS, conn: conn})
+		servers[name] = srv
+	}
+
+	return newAccountsConnector(accounts), servers["prod"], servers["staging"]
+}
+
+func TestMultiAccount_ActionsRunInTheirAccount(t *testing.T) {
+	c, prod, staging := newFakeAccountsConnector(t)
+	s, err := connectorbuilder.NewConnector(context.Background(), c)
+	if err != nil {
+		t.Fatalf("failed to create connector server: %v", err)
+	}
+
+	schemas, err := s.ListActionSchemas(context.Background(), &v2.ListActionSchemasRequest{ResourceTypeId: resourceTypeUser.Id})
+	if err != nil {
+		t.Fatalf("failed to list action schemas: %v", err)
+	}
+	if len(schemas.GetSchemas()) != 1 || schemas.GetSchemas()[0].GetName() != offboardUserAction {
+		t.Errorf("expected the offboarding action of users, got %v", schemas.GetSchemas())
+	}
+
+	rv := invokeAction(t, s, addUserToTeamAction, "", map[string]*structpb.Value{
+		"user": resourceIDValue(resourceTypeUser.Id, "staging/user-2"),
+		"team": resourceIDValue(resourceTypeTeam.Id, "staging/team-1"),
+	})
+	if got := rv.GetFields()["account"].GetStringValue(); got != "staging" {
+		t.Errorf("expected the action to run in staging, got %s", got)
+	}
+	if team, _ := staging.Team("team-1"); len(team.Members) != 2 {
+		t.Errorf("expected user-2 to join team-1 of staging, got %v", team.Members)
+	}
+	if team, _ := prod.Team("team-1"); len(team.Members) != 1 {
+		t.Errorf("expected team-1 of prod to be left alone, got %v", team.Members)
+	}
+
+	for account, onCall := range map[string]string{"prod": "jane@example.com", "staging": "john@example.com"} {
+		rv := invokeAction(t, s, getCurrentOnCallAction, resourceTypeSchedule.Id, map[string]*structpb.Value{
+			scheduleActionResourceIDArg: resourceIDValue(resourceTypeSchedule.Id, account+"/schedule-1"),
+		})
+		participants := rv.GetFields()["on_call_participants"].GetListValue().GetValues()
+		if len(participants) != 1 || participants[0].GetStringValue() != onCall {
+			t.Errorf("expected %s on call in %s, got %v", onCall, account, participants)
+		}
+	}
+}
+
+func TestMultiAccount_ActionsRefuseOtherAccounts(t *testing.T) {
+	c, prod, staging := newFakeAccountsConnector(t)
+
+	recorder := newActionRecorder()
+	if err := c.GlobalActions(context.Background(), recorder); err != nil {
+		t.Fatalf("failed to register global actions: %v", err)
+	}
+
+	for name, args := range map[string]map[string]*structpb.Value{
+		"mixed accounts": {
+			"user": resourceIDValue(resourceTypeUser.Id, "prod/user-2"),
+			"team": resourceIDValue(resourceTypeTeam.Id, "staging/team-1"),
+		},
+		"unscoped IDs": {
+			"user": resourceIDValue(resourceTypeUser.Id, "user-2"),
+			"team": resourceIDValue(resourceTypeTeam.Id, "team-1"),
+		},
+		"unknown account": {
+			"user": resourceIDValue(resourceTypeUser.Id, "dev/user-2"),
+			"team": resourceIDValue(resourceTypeTeam.Id, "dev/team-1"),
+		},
+	} {
+		_, _, err := recorder.handlers[addUserToTeamAction](context.Background(), &structpb.Struct{Fields: args})
+		if status.Code(err) != codes.InvalidArgument {
+			t.Errorf("%s: expected codes.InvalidArgument, got %v", name, err)
+		}
+	}
+
+	for _, srv := range []*opsgenietest.Server{prod, staging} {
+		if team, _ := srv.Team("team-1"); len(team.Members) != 1 {
+			t.Errorf("expected no account to change, got %v", team.Members)
+		}
+	}
+
+	// Tickets are filed in prod, which doesn't know the users of staging.
+	ticket := &v2.Ticket{Assignees: []*v2.Resource{{Id: &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "staging/user-1"}}}}
+	if _, err := c.ticketResponders(ticket); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected codes.InvalidArgument for an assignee of staging, got %v", err)
+	}
+	ticket.Assignees[0].Id.Resource = "prod/user-1"
+	responders, err := c.ticketResponders(ticket)
+	if err != nil || len(responders) != 1 || responders[0].Id != "user-1" {
+		t.Errorf("expected prod/user-1 to be assigned as user-1, got %v: %v", responders, err)
+	}
+}
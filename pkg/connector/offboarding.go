@@ -0,0 +1,647 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	ogEscalation "github.com/opsgenie/opsgenie-go-sdk-v2/escalation"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Offboarding detaches a user from everything that could page them, or page nobody because of them,
+// before the user is blocked or deleted. Every change is planned before the first one is sent, so
+// that a user who can't be detached safely is left untouched.
+
+const (
+	offboardUserAction = "offboard_user"
+
+	// offboardPolicyReplace hands every team membership, rotation turn, escalation rule and
+	// forwarding rule of the user over to a replacement user.
+	offboardPolicyReplace = "replace"
+	// offboardPolicyTeam falls back to the owner team of each schedule and escalation, and drops
+	// the team memberships and forwarding rules of the user.
+	offboardPolicyTeam = "team"
+	// offboardPolicyRemove drops the user everywhere. Rotations left empty have nobody on call.
+	offboardPolicyRemove = "remove"
+
+	offboardFinalStepBlock  = "block"
+	offboardFinalStepDelete = "delete"
+)
+
+var offboardUserActionSchema = &v2.BatonActionSchema{
+	Name:        offboardUserAction,
+	DisplayName: "Offboard User",
+	Description: "Detach a user from teams, on-call rotations, escalations and forwarding rules, then block or delete the user",
+	Arguments: []*config.Field{
+		resourceIDArgument("resource_id", "User", "The user to offboard", resourceTypeUser),
+		{
+			Name:        "replacement",
+			DisplayName: "Replacement",
+			Description: "The user taking over the memberships, rotations, escalations and forwarding rules (required by the replace policy)",
+			Field: &config.Field_ResourceIdField{ResourceIdField: &config.ResourceIdField{
+				Rules: &config.ResourceIDRules{AllowedResourceTypeIds: []string{resourceTypeUser.Id}},
+			}},
+		},
+		stringArgument("policy", "Policy", "How the user is detached: replace, team or remove (defaults to replace with a replacement, team otherwise)", false),
+		stringArgument("final_step", "Final step", "What happens to the user once detached: block or delete (defaults to block)", false),
+		{
+			Name:        "dry_run",
+			DisplayName: "Dry run",
+			Description: "Report the changes without making them",
+			Field:       &config.Field_BoolField{BoolField: &config.BoolField{}},
+		},
+	},
+	ReturnTypes: []*config.Field{
+		boolReturnType("success"),
+		stringReturnType("user_id"),
+		stringReturnType("policy"),
+		stringReturnType("final_step"),
+		boolReturnType("dry_run"),
+		listReturnType("changes"),
+	},
+	ActionType: []v2.ActionType{v2.ActionType_ACTION_TYPE_ACCOUNT_DISABLE},
+}
+
+func (o *userResourceType) ResourceActions(ctx context.Context, registry actions.ActionRegistry) error {
+	return registry.Register(ctx, offboardUserActionSchema, o.offboardUser)
+}
+
+// offboardingChange is a change made by offboarding, with the request that makes it.
+type offboardingChange struct {
+	objectType string
+	id         string
+	name       string
+	action     string
+	detail     string
+	request    ogclient.ApiRequest
+	requestID  string
+}
+
+// value reports the change as a line of the changes list, such as
+// "update_rotation schedule primary/weekly (schedule-1): replaced by user bob@example.com".
+func (c *offboardingChange) value() *structpb.Value {
+	line := fmt.Sprintf("%s %s %s (%s): %s", c.action, c.objectType, c.name, c.id, c.detail)
+	if c.requestID != "" {
+		line += ", request id " + c.requestID
+	}
+
+	return structpb.NewStringValue(line)
+}
+
+type offboardingResult struct {
+	ogclient.ResultMetadata
+	Result string `json:"result"`
+}
+
+// offboardingPlan collects the changes offboarding makes, and the reasons it can't be done safely.
+type offboardingPlan struct {
+	userID      string
+	policy      string
+	replacement *user.GetResult
+	failures    *failureLog
+
+	changes    []*offboardingChange
+	unresolved []string
+}
+
+func (p *offboardingPlan) add(change *offboardingChange) {
+	p.changes = append(p.changes, change)
+}
+
+func (p *offboardingPlan) refuse(format string, args ...interface{}) {
+	p.unresolved = append(p.unresolved, fmt.Sprintf(format, args...))
+}
+
+// substitute returns who takes the place of the user in a schedule or escalation owned by
+// ownerTeam, or nil when the user is only removed.
+func (p *offboardingPlan) substitute(ownerTeam *og.OwnerTeam) (*og.Participant, string, bool) {
+	switch p.policy {
+	case offboardPolicyReplace:
+		return &og.Participant{Type: og.User, Id: p.replacement.Id}, "replaced by user " + p.replacement.Username, true
+	case offboardPolicyTeam:
+		if ownerTeam == nil || ownerTeam.Id == "" {
+			return nil, "", false
+		}
+		return &og.Participant{Type: og.Team, Id: ownerTeam.Id}, "replaced by owner team " + ownerTeam.Name, true
+	default:
+		return nil, "removed", true
+	}
+}
+
+// planRotations reassigns the turns of the user in the rotations of their schedules.
+func (p *offboardingPlan) planRotations(ctx context.Context, cfg *ogclient.Config, userClient *user.Client) error {
+	schedules, err := userClient.ListUserSchedules(ctx, &user.ListUserSchedulesRequest{Identifier: p.userID})
+	if err != nil {
+		return fmt.Errorf("opsgenie-connector: failed to list schedules of user %s: %w", p.userID, translateAPIError(p.failures, err))
+	}
+	if len(schedules.Schedules) == 0 {
+		return nil
+	}
+
+	scheduleClient, err := ogSchedule.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range schedules.Schedules {
+		current, err := scheduleClient.Get(ctx, &ogSchedule.GetRequest{
+			IdentifierType:  ogSchedule.Id,
+			IdentifierValue: s.Id,
+		})
+		if err != nil {
+			return fmt.Errorf("opsgenie-connector: failed to get schedule %s: %w", s.Id, translateAPIError(p.failures, err))
+		}
+		schedule := current.Schedule
+
+		for _, rotation := range schedule.Rotations {
+			if !hasUserParticipant(rotation.Participants, p.userID) {
+				continue
+			}
+
+			name := schedule.Name + "/" + rotation.Name
+			sub, detail, ok := p.substitute(schedule.OwnerTeam)
+			if !ok {
+				p.refuse("schedule %s has no owner team to take over rotation %s", schedule.Name, rotation.Name)
+				continue
+			}
+
+			// The substitute takes the turns of the user, so the rest of the rotation keeps its order. A
+			// substitute who is already in the rotation keeps only their own turns.
+			takeOver := sub != nil && !hasParticipant(rotation.Participants, *sub)
+			var participants []og.Participant
+			for _, participant := range rotation.Participants {
+				if participant.Type == og.User && participant.Id == p.userID {
+					if takeOver {
+						participants = append(participants, *sub)
+					}
+					continue
+				}
+				participants = append(participants, participant)
+			}
+			// A rotation needs a participant, "none" keeps its turns with nobody on call.
+			if len(participants) == 0 {
+				participants = []og.Participant{{Type: og.None}}
+				detail = "removed, the rotation has nobody on call"
+			}
+
+			p.add(&offboardingChange{
+				objectType: resourceTypeSchedule.Id,
+				id:         schedule.Id,
+				name:       name,
+				action:     "update_rotation",
+				detail:     detail,
+				request: &ogSchedule.UpdateRotationRequest{
+					ScheduleIdentifierType:  ogSchedule.Id,
+					ScheduleIdentifierValue: schedule.Id,
+					RotationId:              rotation.Id,
+					Rotation:                &og.Rotation{Participants: participants},
+				},
+			})
+		}
+	}
+
+	return nil
+}
+
+// planEscalations reassigns the escalation rules notifying the user.
+func (p *offboardingPlan) planEscalations(ctx context.Context, userClient *user.Client) error {
+	escalations, err := userClient.ListUserEscalations(ctx, &user.ListUserEscalationsRequest{Identifier: p.userID})
+	if err != nil {
+		return fmt.Errorf("opsgenie-connector: failed to list escalations of user %s: %w", p.userID, translateAPIError(p.failures, err))
+	}
+
+	for _, escalation := range escalations.Escalations {
+		ownerTeam := &og.OwnerTeam{Id: escalation.OwnerTeam.Id, Name: escalation.OwnerTeam.Name}
+		sub, detail, ok := p.substitute(ownerTeam)
+		if !ok {
+			p.refuse("escalation %s has no owner team to take over its rules", escalation.Name)
+			continue
+		}
+
+		var rules []ogEscalation.RuleRequest
+		changed := false
+		for _, r := range escalation.Rules {
+			recipient := r.Recipient
+			if recipient.Type == og.User && recipient.Id == p.userID {
+				changed = true
+				if sub == nil {
+					continue
+				}
+				recipient = *sub
+			}
+
+			rules = append(rules, ogEscalation.RuleRequest{
+				Condition:  r.Condition,
+				NotifyType: r.NotifyType,
+				Recipient:  recipient,
+				Delay:      ogEscalation.EscalationDelayRequest{TimeAmount: uint32(r.Delay.TimeAmount)},
+			})
+		}
+		if !changed {
+			continue
+		}
+		if len(rules) == 0 {
+			p.refuse("escalation %s would be left without rules", escalation.Name)
+			continue
+		}
+
+		p.add(&offboardingChange{
+			objectType: resourceTypeEscalation.Id,
+			id:         escalation.Id,
+			name:       escalation.Name,
+			action:     "update_escalation",
+			detail:     detail,
+			request: &ogEscalation.UpdateRequest{
+				IdentifierType: ogEscalation.Id,
+				Identifier:     escalation.Id,
+				Name:           escalation.Name,
+				Rules:          rules,
+			},
+		})
+	}
+
+	return nil
+}
+
+// planForwardingRules redirects the rules forwarding alerts to the user to the replacement, and
+// deletes the others. Rules forwarding the alerts of the user away are deleted with the user.
+func (p *offboardingPlan) planForwardingRules(ctx context.Context, client *ogclient.OpsGenieClient) error {
+	res := &listForwardingRulesResult{}
+	if err := client.Exec(ctx, &listForwardingRulesRequest{}, res); err != nil {
+		return fmt.Errorf("opsgenie-connector: failed to list forwarding rules: %w", translateAPIError(p.failures, err))
+	}
+
+	for _, rule := range res.ForwardingRules {
+		name := fmt.Sprintf("%s to %s", rule.FromUser.Username, rule.ToUser.Username)
+		switch {
+		case rule.FromUser.Id == p.userID:
+			p.add(&offboardingChange{
+				objectType: resourceTypeForwardingRule.Id,
+				id:         rule.Id,
+				name:       name,
+				action:     "delete_forwarding_rule",
+				detail:     "forwards the alerts of the user",
+				request:    &deleteForwardingRuleRequest{Identifier: rule.Id},
+			})
+		case rule.ToUser.Id == p.userID && p.policy == offboardPolicyReplace && rule.FromUser.Id != p.replacement.Id:
+			update := &updateForwardingRuleRequest{
+				Identifier: rule.Id,
+				FromUser:   forwardingRuleUser{Id: rule.FromUser.Id},
+				ToUser:     forwardingRuleUser{Id: p.replacement.Id},
+				StartDate:  rule.StartDate,
+				Alias:      rule.Alias,
+			}
+			if !rule.EndDate.IsZero() {
+				update.EndDate = &rule.EndDate
+			}
+			p.add(&offboardingChange{
+				objectType: resourceTypeForwardingRule.Id,
+				id:         rule.Id,
+				name:       name,
+				action:     "redirect_forwarding_rule",
+				detail:     "redirected to user " + p.replacement.Username,
+				request:    update,
+			})
+		case rule.ToUser.Id == p.userID:
+			p.add(&offboardingChange{
+				objectType: resourceTypeForwardingRule.Id,
+				id:         rule.Id,
+				name:       name,
+				action:     "delete_forwarding_rule",
+				detail:     "forwards alerts to the user",
+				request:    &deleteForwardingRuleRequest{Identifier: rule.Id},
+			})
+		}
+	}
+
+	return nil
+}
+
+// planTeams removes the user from their teams. The replacement joins each team first, with the
+// role the user had.
+func (p *offboardingPlan) planTeams(ctx context.Context, cfg *ogclient.Config, userClient *user.Client) error {
+	teams, err := userClient.ListUserTeams(ctx, &user.ListUserTeamsRequest{Identifier: p.userID})
+	if err != nil {
+		return fmt.Errorf("opsgenie-connector: failed to list teams of user %s: %w", p.userID, translateAPIError(p.failures, err))
+	}
+	if len(teams.Teams) == 0 {
+		return nil
+	}
+
+	teamClient, err := oteam.NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range teams.Teams {
+		team, err := teamClient.Get(ctx, &oteam.GetTeamRequest{IdentifierType: oteam.Id, IdentifierValue: t.Id})
+		if err != nil {
+			return fmt.Errorf("opsgenie-connector: failed to get team %s: %w", t.Id, translateAPIError(p.failures, err))
+		}
+
+		role := teamRoleUser
+		replacementIsMember := false
+		for _, m := range team.Members {
+			switch m.User.ID {
+			case p.userID:
+				if m.Role != "" {
+					role = m.Role
+				}
+			case p.replacementID():
+				replacementIsMember = true
+			}
+		}
+
+		if p.policy == offboardPolicyReplace && !replacementIsMember {
+			p.add(&offboardingChange{
+				objectType: resourceTypeTeam.Id,
+				id:         team.Id,
+				name:       team.Name,
+				action:     "add_member",
+				detail:     fmt.Sprintf("added user %s as %s", p.replacement.Username, role),
+				request: &oteam.AddTeamMemberRequest{
+					TeamIdentifierType:  oteam.Id,
+					TeamIdentifierValue: team.Id,
+					User:                oteam.User{ID: p.replacement.Id},
+					Role:                role,
+				},
+			})
+		}
+
+		p.add(&offboardingChange{
+			objectType: resourceTypeTeam.Id,
+			id:         team.Id,
+			name:       team.Name,
+			action:     "remove_member",
+			detail:     "removed the user, who was " + role,
+			request: &oteam.RemoveTeamMemberRequest{
+				TeamIdentifierType:    oteam.Id,
+				TeamIdentifierValue:   team.Id,
+				MemberIdentifierType:  oteam.Id,
+				MemberIdentifierValue: p.userID,
+			},
+		})
+	}
+
+	return nil
+}
+
+func (p *offboardingPlan) replacementID() string {
+	if p.replacement == nil {
+		return ""
+	}
+
+	return p.replacement.Id
+}
+
+func hasUserParticipant(participants []og.Participant, userID string) bool {
+	return hasParticipant(participants, og.Participant{Type: og.User, Id: userID})
+}
+
+func hasParticipant(participants []og.Participant, participant og.Participant) bool {
+	for _, p := range participants {
+		if p.Type == participant.Type && p.Id == participant.Id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (o *userResourceType) offboardUser(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	userID, err := requireResourceIDArg(args, "resource_id", resourceTypeUser)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userClient, err := user.NewClient(o.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	plan := &offboardingPlan{userID: userID.Resource, failures: o.failures}
+	if _, ok := args.GetFields()["replacement"]; ok {
+		replacementID, err := requireResourceIDArg(args, "replacement", resourceTypeUser)
+		if err != nil {
+			return nil, nil, err
+		}
+		if replacementID.Resource == userID.Resource {
+			return nil, nil, status.Error(codes.InvalidArgument, "opsgenie-connector: a user can't replace themselves")
+		}
+
+		replacement, err := userClient.Get(ctx, &user.GetRequest{Identifier: replacementID.Resource})
+		if err != nil {
+			return nil, nil, fmt.Errorf("opsgenie-connector: failed to get replacement user %s: %w", replacementID.Resource, translateAPIError(o.failures, err))
+		}
+		if replacement.Blocked {
+			return nil, nil, status.Errorf(codes.FailedPrecondition, "opsgenie-connector: replacement user %s is blocked", replacement.Username)
+		}
+		plan.replacement = replacement
+	}
+
+	plan.policy, _ = actions.GetStringArg(args, "policy")
+	switch plan.policy {
+	case "":
+		plan.policy = offboardPolicyTeam
+		if plan.replacement != nil {
+			plan.policy = offboardPolicyReplace
+		}
+	case offboardPolicyReplace:
+		if plan.replacement == nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: the %s policy requires a replacement", offboardPolicyReplace)
+		}
+	case offboardPolicyTeam, offboardPolicyRemove:
+	default:
+		return nil, nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: policy must be %s, %s or %s, got %s",
+			offboardPolicyReplace, offboardPolicyTeam, offboardPolicyRemove, plan.policy)
+	}
+
+	finalStep, _ := actions.GetStringArg(args, "final_step")
+	switch finalStep {
+	case "":
+		finalStep = offboardFinalStepBlock
+	case offboardFinalStepBlock, offboardFinalStepDelete:
+	default:
+		return nil, nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: final_step must be %s or %s, got %s",
+			offboardFinalStepBlock, offboardFinalStepDelete, finalStep)
+	}
+
+	dryRun, _ := actions.GetBoolArg(args, "dry_run")
+	dryRun = dryRun || o.dryRun
+
+	u, err := userClient.Get(ctx, &user.GetRequest{Identifier: userID.Resource})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get user %s: %w", userID.Resource, translateAPIError(o.failures, err))
+	}
+
+	client, err := ogclient.NewOpsGenieClient(o.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Rotations and escalations are reassigned before the user leaves their teams, so that nothing
+	// pages a user who is no longer there.
+	if err := plan.planRotations(ctx, o.config, userClient); err != nil {
+		return nil, nil, err
+	}
+	if err := plan.planEscalations(ctx, userClient); err != nil {
+		return nil, nil, err
+	}
+	if err := plan.planForwardingRules(ctx, client); err != nil {
+		return nil, nil, err
+	}
+	if err := plan.planTeams(ctx, o.config, userClient); err != nil {
+		return nil, nil, err
+	}
+
+	if len(plan.unresolved) > 0 {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "opsgenie-connector: user %s can't be offboarded with the %s policy: %s",
+			u.Username, plan.policy, strings.Join(plan.unresolved, "; "))
+	}
+
+	final := &offboardingChange{
+		objectType: resourceTypeUser.Id,
+		id:         u.Id,
+		name:       u.Username,
+		action:     "block_user",
+		detail:     "blocked the user",
+		request:    &blockUserRequest{Identifier: u.Id, Blocked: true},
+	}
+	if finalStep == offboardFinalStepDelete {
+		final.action = "delete_user"
+		final.detail = "deleted the user"
+		final.request = &user.DeleteRequest{Identifier: u.Id}
+	}
+	plan.add(final)
+
+	l := ctxzap.Extract(ctx)
+	var annos annotations.Annotations
+	changes := make([]*structpb.Value, 0, len(plan.changes))
+	for _, change := range plan.changes {
+		if dryRun {
+			described, err := dryRunRequest(ctx, offboardUserAction, change.request)
+			if err != nil {
+				return nil, nil, err
+			}
+			annos = append(annos, described...)
+			changes = append(changes, change.value())
+			continue
+		}
+
+		res := &offboardingResult{}
+		if err := client.Exec(ctx, change.request, res); err != nil {
+			return nil, nil, fmt.Errorf("opsgenie-connector: failed to offboard user %s at %s %s (%s), %d of %d changes made: %w",
+				u.Username, change.action, change.name, change.id, len(changes), len(plan.changes), translateAPIError(o.failures, err))
+		}
+		change.requestID = res.RequestId
+		changes = append(changes, change.value())
+
+		l.Info("opsgenie-connector: offboarding change",
+			zap.String("user_id", u.Id),
+			zap.String("action", change.action),
+			zap.String("object_type", change.objectType),
+			zap.String("object_id", change.id),
+			zap.String("detail", change.detail),
+			zap.String("request_id", res.RequestId),
+		)
+	}
+
+	return actionResult(map[string]*structpb.Value{
+		"user_id":    structpb.NewStringValue(u.Id),
+		"policy":     structpb.NewStringValue(plan.policy),
+		"final_step": structpb.NewStringValue(finalStep),
+		"dry_run":    structpb.NewBoolValue(dryRun),
+		"changes":    structpb.NewListValue(&structpb.ListValue{Values: changes}),
+	}), annos, nil
+}
+
+// listForwardingRulesRequest lists the forwarding rules of the account. The SDK only lists the
+// rules forwarding the alerts of a user, not the rules forwarding alerts to them.
+type listForwardingRulesRequest struct {
+	ogclient.BaseRequest
+}
+
+func (r *listForwardingRulesRequest) Validate() error {
+	return nil
+}
+
+func (r *listForwardingRulesRequest) ResourcePath() string {
+	return "/v2/forwarding-rules"
+}
+
+func (r *listForwardingRulesRequest) Method() string {
+	return http.MethodGet
+}
+
+type listForwardingRulesResult struct {
+	ogclient.ResultMetadata
+	ForwardingRules []user.ForwardingRule `json:"data"`
+}
+
+type forwardingRuleUser struct {
+	Id       string `json:"id,omitempty"`
+	Username string `json:"username,omitempty"`
+}
+
+// updateForwardingRuleRequest replaces a forwarding rule. The SDK can't change forwarding rules.
+type updateForwardingRuleRequest struct {
+	ogclient.BaseRequest
+	Identifier string             `json:"-"`
+	FromUser   forwardingRuleUser `json:"fromUser"`
+	ToUser     forwardingRuleUser `json:"toUser"`
+	StartDate  time.Time          `json:"startDate"`
+	EndDate    *time.Time         `json:"endDate,omitempty"`
+	Alias      string             `json:"alias,omitempty"`
+}
+
+func (r *updateForwardingRuleRequest) Validate() error {
+	if r.Identifier == "" {
+		return fmt.Errorf("identifier can not be empty")
+	}
+	return nil
+}
+
+func (r *updateForwardingRuleRequest) ResourcePath() string {
+	return "/v2/forwarding-rules/" + r.Identifier
+}
+
+func (r *updateForwardingRuleRequest) Method() string {
+	return http.MethodPut
+}
+
+// deleteForwardingRuleRequest deletes a forwarding rule. The SDK can't change forwarding rules.
+type deleteForwardingRuleRequest struct {
+	ogclient.BaseRequest
+	Identifier string `json:"-"`
+}
+
+func (r *deleteForwardingRuleRequest) Validate() error {
+	if r.Identifier == "" {
+		return fmt.Errorf("identifier can not be empty")
+	}
+	return nil
+}
+
+func (r *deleteForwardingRuleRequest) ResourcePath() string {
+	return "/v2/forwarding-rules/" + r.Identifier
+}
+
+func (r *deleteForwardingRuleRequest) Method() string {
+	return http.MethodDelete
+}
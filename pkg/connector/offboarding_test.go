@@ -0,0 +1,229 @@
+package connector
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newOffboardingTenant serves user-1, who is on the rotation of a schedule, the rule of an
+// escalation and a team, and who has a forwarding rule to them and one from them. The schedule and
+// escalation are owned by the team when owned is set.
+func newOffboardingTenant(t *testing.T, owned bool) *opsgenietest.Server {
+	t.Helper()
+
+	ownerTeamID := ""
+	if owned {
+		ownerTeamID = "team-1"
+	}
+
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1", Username: "leaver@example.com"})
+	srv.AddUser(opsgenietest.User{ID: "user-2", Username: "stayer@example.com"})
+	srv.AddUser(opsgenietest.User{ID: "user-3", Username: "other@example.com"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "sre", Members: []opsgenietest.Member{{UserID: "user-1", Role: teamRoleAdmin}}})
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:          "schedule-1",
+		Name:        "primary",
+		OwnerTeamID: ownerTeamID,
+		Rotations: []opsgenietest.Rotation{
+			{ID: "rotation-1", Name: "weekly", Participants: []opsgenietest.Participant{
+				{Type: opsgenietest.UserParticipant, ID: "user-1"},
+				{Type: opsgenietest.UserParticipant, ID: "user-3"},
+			}},
+			{ID: "rotation-2", Name: "others", Participants: []opsgenietest.Participant{
+				{Type: opsgenietest.UserParticipant, ID: "user-3"},
+			}},
+		},
+	})
+	srv.AddEscalation(opsgenietest.Escalation{
+		ID:          "escalation-1",
+		Name:        "critical",
+		OwnerTeamID: ownerTeamID,
+		Rules: []opsgenietest.EscalationRule{
+			{Recipient: opsgenietest.Participant{Type: opsgenietest.UserParticipant, ID: "user-1"}, Delay: 5},
+		},
+	})
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv.AddForwardingRule(opsgenietest.ForwardingRule{ID: "forward-to", FromUserID: "user-3", ToUserID: "user-1", StartDate: start})
+	srv.AddForwardingRule(opsgenietest.ForwardingRule{ID: "forward-from", FromUserID: "user-1", ToUserID: "user-3", StartDate: start})
+
+	return srv
+}
+
+func offboardingArgs(fields map[string]*structpb.Value) *structpb.Struct {
+	fields["resource_id"] = resourceIDValue(resourceTypeUser.Id, "user-1")
+	return &structpb.Struct{Fields: fields}
+}
+
+func TestOffboardUserAction_Replace(t *testing.T) {
+	srv := newOffboardingTenant(t, true)
+
+	rv, _, err := userBuilder(srv.Config(), nil, nil, nil, "", false).offboardUser(context.Background(), offboardingArgs(map[string]*structpb.Value{
+		"replacement": resourceIDValue(resourceTypeUser.Id, "user-2"),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := rv.Fields["policy"].GetStringValue(); got != offboardPolicyReplace {
+		t.Errorf("expected the replace policy by default, got %s", got)
+	}
+
+	expected := []string{
+		"PATCH /v2/schedules/schedule-1/rotations/rotation-1",
+		"PATCH /v2/escalations/escalation-1",
+		"PUT /v2/forwarding-rules/forward-to",
+		"DELETE /v2/forwarding-rules/forward-from",
+		"POST /v2/teams/team-1/members",
+		"DELETE /v2/teams/team-1/members/user-1",
+		"PATCH /v2/users/user-1",
+	}
+	if writes := writeRequests(srv); !reflect.DeepEqual(writes, expected) {
+		t.Fatalf("unexpected changes %v", writes)
+	}
+	changes := rv.Fields["changes"].GetListValue().GetValues()
+	if len(changes) != len(expected) {
+		t.Fatalf("expected a report entry per change, got %d", len(changes))
+	}
+	if got := changes[0].GetStringValue(); !strings.HasPrefix(got, "update_rotation schedule primary/weekly (schedule-1): replaced by user stayer@example.com, request id request-") {
+		t.Errorf("unexpected report entry %q", got)
+	}
+
+	schedule, _ := srv.Schedule("schedule-1")
+	if participants := schedule.Rotations[0].Participants; len(participants) != 2 || participants[0].ID != "user-2" || participants[1].ID != "user-3" {
+		t.Errorf("unexpected rotation participants %v", participants)
+	}
+	if escalation, _ := srv.Escalation("escalation-1"); len(escalation.Rules) != 1 || escalation.Rules[0].Recipient.ID != "user-2" {
+		t.Errorf("expected the escalation rule to notify user-2, got %v", escalation.Rules)
+	}
+	if rule, _ := srv.ForwardingRule("forward-to"); rule.ToUserID != "user-2" {
+		t.Errorf("expected the forwarding rule to be redirected to user-2, got %s", rule.ToUserID)
+	}
+	if _, ok := srv.ForwardingRule("forward-from"); ok {
+		t.Error("expected the forwarding rule from the user to be deleted")
+	}
+	if team, _ := srv.Team("team-1"); !reflect.DeepEqual(team.Members, []opsgenietest.Member{{UserID: "user-2", Role: teamRoleAdmin}}) {
+		t.Errorf("expected the replacement to take the place of the user as admin, got %v", team.Members)
+	}
+	if u, _ := srv.User("user-1"); !u.Blocked {
+		t.Error("expected the user to be blocked")
+	}
+}
+
+func TestOffboardUserAction_FinalStep(t *testing.T) {
+	tests := map[string]struct {
+		finalStep string
+		write     string
+		action    string
+	}{
+		"default":               {finalStep: "", write: "PATCH /v2/users/user-1", action: "block_user"},
+		offboardFinalStepBlock:  {finalStep: offboardFinalStepBlock, write: "PATCH /v2/users/user-1", action: "block_user"},
+		offboardFinalStepDelete: {finalStep: offboardFinalStepDelete, write: "DELETE /v2/users/user-1", action: "delete_user"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv := newOffboardingTenant(t, true)
+
+			fields := map[string]*structpb.Value{}
+			if tt.finalStep != "" {
+				fields["final_step"] = structpb.NewStringValue(tt.finalStep)
+			}
+
+			rv, _, err := userBuilder(srv.Config(), nil, nil, nil, "", false).offboardUser(context.Background(), offboardingArgs(fields))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			writes := writeRequests(srv)
+			if len(writes) == 0 || writes[len(writes)-1] != tt.write {
+				t.Fatalf("expected the last change to be %s, got %v", tt.write, writes)
+			}
+			for _, write := range writes[:len(writes)-1] {
+				if strings.HasSuffix(write, "/v2/users/user-1") {
+					t.Errorf("expected the user to be changed last, got %v", writes)
+				}
+			}
+
+			changes := rv.Fields["changes"].GetListValue().GetValues()
+			if got := strings.Fields(changes[len(changes)-1].GetStringValue())[0]; got != tt.action {
+				t.Errorf("expected the last report entry to be %s, got %s", tt.action, got)
+			}
+			wantStep := tt.finalStep
+			if wantStep == "" {
+				wantStep = offboardFinalStepBlock
+			}
+			if got := rv.Fields["final_step"].GetStringValue(); got != wantStep {
+				t.Errorf("expected final step %s, got %s", wantStep, got)
+			}
+		})
+	}
+}
+
+func TestOffboardUserAction_Remove(t *testing.T) {
+	srv := newOffboardingTenant(t, false)
+
+	_, _, err := userBuilder(srv.Config(), nil, nil, nil, "", false).offboardUser(context.Background(), offboardingArgs(map[string]*structpb.Value{
+		"policy": structpb.NewStringValue(offboardPolicyRemove),
+	}))
+	if got := status.Code(err); got != codes.FailedPrecondition {
+		t.Fatalf("expected codes.FailedPrecondition for an escalation left without rules, got %v (err: %v)", got, err)
+	}
+	if writes := writeRequests(srv); len(writes) != 0 {
+		t.Errorf("expected nothing to change, got %v", writes)
+	}
+}
+
+func TestOffboardUserAction_TeamDryRun(t *testing.T) {
+	srv := newOffboardingTenant(t, true)
+
+	rv, annos, err := userBuilder(srv.Config(), nil, nil, nil, "", false).offboardUser(context.Background(), offboardingArgs(map[string]*structpb.Value{
+		"final_step": structpb.NewStringValue(offboardFinalStepDelete),
+		"dry_run":    structpb.NewBoolValue(true),
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if writes := writeRequests(srv); len(writes) != 0 {
+		t.Errorf("expected a dry run to change nothing, got %v", writes)
+	}
+
+	var actions []string
+	for _, v := range rv.Fields["changes"].GetListValue().GetValues() {
+		actions = append(actions, strings.Fields(v.GetStringValue())[0])
+	}
+	if !reflect.DeepEqual(actions, []string{
+		"update_rotation", "update_escalation", "delete_forwarding_rule", "delete_forwarding_rule", "remove_member", "delete_user",
+	}) {
+		t.Errorf("unexpected changes %v", actions)
+	}
+	if len(annos) != len(actions) {
+		t.Errorf("expected a dry run annotation per change, got %d", len(annos))
+	}
+}
+
+func TestOffboardUserAction_InvalidArguments(t *testing.T) {
+	for name, fields := range map[string]map[string]*structpb.Value{
+		"replace without replacement": {"policy": structpb.NewStringValue(offboardPolicyReplace)},
+		"unknown policy":              {"policy": structpb.NewStringValue("transfer")},
+		"unknown final step":          {"final_step": structpb.NewStringValue("archive")},
+		"self replacement":            {"replacement": resourceIDValue(resourceTypeUser.Id, "user-1")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			srv := newOffboardingTenant(t, false)
+
+			_, _, err := userBuilder(srv.Config(), nil, nil, nil, "", false).offboardUser(context.Background(), offboardingArgs(fields))
+			if got := status.Code(err); got != codes.InvalidArgument {
+				t.Errorf("expected codes.InvalidArgument, got %v (err: %v)", got, err)
+			}
+		})
+	}
+}
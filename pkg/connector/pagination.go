@@ -65,3 +65,29 @@ func handleNextPage(bag *pagination.Bag, nextLink string) (string, error) {
 
 	return pageToken, nil
 }
+
+// nextPageOffset returns the offset of the next page from the link to it, and false on the last
+// page. Pages can hold fewer items than asked for when the backend leaves some out, so the offset of
+// the next page can only be taken from the link.
+func nextPageOffset(nextLink string) (int, bool, error) {
+	if nextLink == "" {
+		return 0, false, nil
+	}
+
+	nextUrl, err := url.Parse(nextLink)
+	if err != nil {
+		return 0, false, err
+	}
+
+	offset := nextUrl.Query().Get("offset")
+	if offset == "" {
+		return 0, false, nil
+	}
+
+	page, err := convertPageToken(offset)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return page, true, nil
+}
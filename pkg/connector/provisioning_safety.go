@@ -0,0 +1,115 @@
+package connector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Two modes keep provisioning from changing Opsgenie. Dry-run provisioning describes the request a
+// provisioning operation would send instead of sending it. Read-only mode refuses every request that
+// could change Opsgenie in the HTTP client, whatever code path it comes from.
+
+// dryRunRequest logs an API request that dry-run provisioning doesn't send, and returns it as an
+// annotation: the method, the path with its query and the JSON body the SDK would send.
+func dryRunRequest(ctx context.Context, operation string, request ogclient.ApiRequest) (annotations.Annotations, error) {
+	path := request.ResourcePath()
+	if params := request.RequestParams(); len(params) > 0 {
+		query := url.Values{}
+		for k, v := range params {
+			query.Set(k, v)
+		}
+		path += "?" + query.Encode()
+	}
+
+	described := map[string]interface{}{
+		"dry_run":   true,
+		"operation": operation,
+		"method":    request.Method(),
+		"path":      path,
+	}
+
+	fields := []zap.Field{
+		zap.String("operation", operation),
+		zap.String("method", request.Method()),
+		zap.String("path", path),
+	}
+
+	// The SDK sends the request as JSON body for every method but GET and DELETE.
+	if request.Method() != http.MethodGet && request.Method() != http.MethodDelete {
+		encoded, err := json.Marshal(request)
+		if err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to encode dry run request: %w", err)
+		}
+
+		var body interface{}
+		if err := json.Unmarshal(encoded, &body); err != nil {
+			return nil, fmt.Errorf("opsgenie-connector: failed to encode dry run request: %w", err)
+		}
+		described["body"] = body
+		fields = append(fields, zap.ByteString("body", encoded))
+	}
+
+	ctxzap.Extract(ctx).Info("opsgenie-connector: dry run, request not sent", fields...)
+
+	s, err := structpb.NewStruct(described)
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to encode dry run request: %w", err)
+	}
+
+	return annotations.New(s), nil
+}
+
+// readOnlyTransport refuses every request that could change Opsgenie. Refused requests get a 403
+// response instead of an error, so that the SDK reports them like the API would and doesn't retry.
+type readOnlyTransport struct {
+	next http.RoundTripper
+}
+
+func newReadOnlyTransport(next http.RoundTripper) *readOnlyTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &readOnlyTransport{next: next}
+}
+
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.next.RoundTrip(req)
+	}
+
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"message": fmt.Sprintf("opsgenie-connector: read-only mode refused %s %s", req.Method, req.URL.Path),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", http.StatusForbidden, http.StatusText(http.StatusForbidden)),
+		StatusCode:    http.StatusForbidden,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(strings.NewReader(string(body))),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,97 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// newOwnedScheduleTenant serves schedule-1, owned by team-1, next to team-2.
+func newOwnedScheduleTenant(t *testing.T) *opsgenietest.Server {
+	t.Helper()
+
+	srv := opsgenietest.NewServer(t)
+	srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "sre"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-2", Name: "platform"})
+	srv.AddSchedule(opsgenietest.Schedule{ID: "schedule-1", Name: "primary", OwnerTeamID: "team-1"})
+
+	return srv
+}
+
+// grantScheduleOwner grants the owner entitlement of schedule-1 to team-2.
+func grantScheduleOwner(t *testing.T, s *scheduleResourceType) ([]*structpb.Struct, error) {
+	t.Helper()
+
+	sr, err := scheduleResource(&ogSchedule.Schedule{Id: "schedule-1", Name: "primary"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	team := &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: "team-2"}}
+	annos, err := s.Grant(context.Background(), team, ent.NewAssignmentEntitlement(sr, scheduleOwner))
+
+	var rv []*structpb.Struct
+	for _, a := range annos {
+		described := &structpb.Struct{}
+		if a.MessageIs(described) && a.UnmarshalTo(described) == nil {
+			rv = append(rv, described)
+		}
+	}
+
+	return rv, err
+}
+
+func TestScheduleGrant_DryRun(t *testing.T) {
+	srv := newOwnedScheduleTenant(t)
+	config := srv.Config()
+	requests, err := grantScheduleOwner(t, scheduleBuilder(config, nil, newTestOpsgenieBackend(t, config), nil, true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(requests) != 1 {
+		t.Fatalf("expected the request to be returned, got %v", requests)
+	}
+
+	fields := requests[0].GetFields()
+	if fields["method"].GetStringValue() != http.MethodPatch || fields["path"].GetStringValue() != "/v2/schedules/schedule-1?identifierType=id" {
+		t.Errorf("unexpected request %s %s", fields["method"].GetStringValue(), fields["path"].GetStringValue())
+	}
+
+	body := fields["body"].GetStructValue().GetFields()
+	if body["name"].GetStringValue() != "primary" || body["ownerTeam"].GetStructValue().GetFields()["id"].GetStringValue() != "team-2" {
+		t.Errorf("unexpected request body %v", body)
+	}
+
+	if writes := writeRequests(srv); len(writes) != 0 {
+		t.Errorf("expected a dry run to change nothing, got %v", writes)
+	}
+}
+
+func TestNew_ReadOnly(t *testing.T) {
+	srv := newOwnedScheduleTenant(t)
+	c, err := New(context.Background(), &cfg.Opsgenie{
+		ApiKey:   opsgenietest.APIKey,
+		BaseUrl:  srv.APIURL(),
+		ReadOnly: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Reads still go through, the write is refused before it reaches the server.
+	_, err = grantScheduleOwner(t, scheduleBuilder(c.config, nil, c.backend, c.cache, false))
+	if err == nil || !strings.Contains(err.Error(), "read-only mode refused PATCH /v2/schedules/schedule-1") {
+		t.Errorf("expected the update to be refused, got %v", err)
+	}
+	if writes := writeRequests(srv); len(writes) != 0 {
+		t.Errorf("expected nothing to reach the server, got %v", writes)
+	}
+}
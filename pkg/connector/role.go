@@ -5,14 +5,9 @@ import (
 	"fmt"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
-	"github.com/conductorone/baton-sdk/pkg/annotations"
-	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
 	res "github.com/conductorone/baton-sdk/pkg/types/resource"
-	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
-	custom_role "github.com/opsgenie/opsgenie-go-sdk-v2/custom_user_role"
-	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
 )
 
 var defaultRoles = map[string]string{
@@ -28,7 +23,8 @@ const (
 
 type roleResourceType struct {
 	resourceType *v2.ResourceType
-	config       *ogclient.Config
+	backend      backend
+	cache        *syncCache
 }
 
 func (o *roleResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -57,22 +53,17 @@ func roleResource(ctx context.Context, roleName, roleId string) (*v2.Resource, e
 	return resource, nil
 }
 
-func (o *roleResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	crClient, err := custom_role.NewClient(o.config)
+func (o *roleResourceType) List(ctx context.Context, _ *v2.ResourceId, _ res.SyncOpAttrs) ([]*v2.Resource, *res.SyncOpResults, error) {
+	roles, err := o.backend.ListCustomRoles(ctx)
 	if err != nil {
-		return nil, "", nil, err
-	}
-
-	roles, err := crClient.List(ctx, &custom_role.ListRequest{BaseRequest: ogclient.BaseRequest{}})
-	if err != nil {
-		return nil, "", nil, err
+		return nil, nil, err
 	}
 
 	rv := make([]*v2.Resource, 0)
-	for _, role := range roles.CustomUserRoles {
+	for _, role := range roles {
 		rr, err := roleResource(ctx, role.Name, role.Id)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, nil, err
 		}
 
 		rv = append(rv, rr)
@@ -82,16 +73,16 @@ func (o *roleResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagin
 	for roleName, id := range defaultRoles {
 		rr, err := roleResource(ctx, roleName, id)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, nil, err
 		}
 
 		rv = append(rv, rr)
 	}
 
-	return rv, "", nil, nil
+	return rv, &res.SyncOpResults{}, nil
 }
 
-func (o *roleResourceType) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+func (o *roleResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ res.SyncOpAttrs) ([]*v2.Entitlement, *res.SyncOpResults, error) {
 	var rv []*v2.Entitlement
 
 	assignmentOptions := []ent.EntitlementOption{
@@ -106,56 +97,60 @@ func (o *roleResourceType) Entitlements(ctx context.Context, resource *v2.Resour
 		assignmentOptions...,
 	))
 
-	return rv, "", nil, nil
+	return rv, &res.SyncOpResults{}, nil
 }
 
-func (o *roleResourceType) Grants(ctx context.Context, resource *v2.Resource, pt *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	bag, offset, err := parsePageToken(pt.Token, resource.Id)
-	if err != nil {
-		return nil, "", nil, err
-	}
+func (o *roleResourceType) Grants(ctx context.Context, resource *v2.Resource, opts res.SyncOpAttrs) ([]*v2.Grant, *res.SyncOpResults, error) {
+	o.cache.scope(opts)
 
-	userClient, err := user.NewClient(o.config)
-	if err != nil {
-		return nil, "", nil, err
+	// Every role needs the role of all users. The first role computes it from the cached user list
+	// and stores it in the session store for the others.
+	var (
+		userRoles map[string]string
+		ok        bool
+	)
+	ss := o.cache.session(opts)
+	if ss != nil {
+		userRoles, ok = loadUserRoles(ctx, ss)
 	}
+	if !ok {
+		users, err := o.cache.Users(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
 
-	users, err := userClient.List(
-		ctx,
-		&user.ListRequest{
-			Limit:  ResourcesPageSize,
-			Offset: offset,
-		},
-	)
-	if err != nil {
-		return nil, "", nil, err
+		userRoles = make(map[string]string, len(users))
+		for _, u := range users {
+			if u.Role != nil {
+				userRoles[u.Id] = u.Role.RoleName
+			}
+		}
+		if ss != nil {
+			storeUserRoles(ctx, ss, userRoles)
+		}
 	}
 
 	var rv []*v2.Grant
-	for _, user := range users.Users {
-		if user.Role.RoleName == resource.DisplayName {
+	for userID, roleName := range userRoles {
+		if roleName == resource.DisplayName {
 			rv = append(rv, grant.NewGrant(
 				resource,
 				roleMemberEntitlement,
 				&v2.ResourceId{
 					ResourceType: resourceTypeUser.Id,
-					Resource:     user.Id,
+					Resource:     userID,
 				},
 			))
 		}
 	}
 
-	nextPage, err := handleNextPage(bag, users.Paging.Next)
-	if err != nil {
-		return nil, "", nil, err
-	}
-
-	return rv, nextPage, nil, nil
+	return rv, &res.SyncOpResults{}, nil
 }
 
-func roleBuilder(config *ogclient.Config) *roleResourceType {
+func roleBuilder(b backend, cache *syncCache) *roleResourceType {
 	return &roleResourceType{
 		resourceType: resourceTypeRole,
-		config:       config,
+		backend:      b,
+		cache:        cache,
 	}
 }
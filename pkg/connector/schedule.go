@@ -2,13 +2,10 @@ package connector
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"net/http"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
-	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	"github.com/conductorone/baton-sdk/pkg/types/grant"
 	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
@@ -16,6 +13,7 @@ import (
 	ogClient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
 	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
 	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	"go.uber.org/zap"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -23,24 +21,31 @@ import (
 const (
 	scheduleMember = "member"
 	scheduleOnCall = "on-call"
+	scheduleOwner  = "owner"
 
 	userParticipantType       = "user"
 	teamParticipantType       = "team"
+	scheduleParticipantType   = "schedule"
 	escalationParticipantType = "escalation"
 )
 
 type scheduleResourceType struct {
 	resourceType *v2.ResourceType
 	config       *ogClient.Config
+	failures     *failureLog
+	backend      backend
+	cache        *syncCache
+	// dryRun makes provisioning describe the requests it would send instead of sending them.
+	dryRun bool
 }
 
 func (s *scheduleResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 	return s.resourceType
 }
 
-// parses array of rotations and returns all teams and users that participate in rotations.
-func parseRotations(rotation []og.Rotation) ([]string, []string) {
-	var teams, users []string
+// parses array of rotations and returns all teams, users and escalations that participate in rotations.
+func parseRotations(rotation []og.Rotation) ([]string, []string, []string) {
+	var teams, users, escalations []string
 
 	for _, r := range rotation {
 		for _, p := range r.Participants {
@@ -49,23 +54,26 @@ func parseRotations(rotation []og.Rotation) ([]string, []string) {
 				teams = append(teams, p.Id)
 			case userParticipantType:
 				users = append(users, p.Id)
+			case escalationParticipantType:
+				escalations = append(escalations, p.Id)
 			default:
-				// Other participant types (escalation, schedule, none) are not relevant here
+				// Other participant types (none) are not relevant here
 			}
 		}
 	}
 
-	return teams, users
+	return teams, users, escalations
 }
 
-// scheduleResource creates a new connector resource for a OpsGenie Schedule.
-func scheduleResource(schedule *ogSchedule.Schedule) (*v2.Resource, error) {
+// scheduleResource creates a new connector resource for a OpsGenie Schedule, with its risks if they
+// were assessed.
+func scheduleResource(schedule *ogSchedule.Schedule, risks *scheduleRisks) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"schedule_id":   schedule.Id,
 		"schedule_name": schedule.Name,
 	}
 
-	teams, users := parseRotations(schedule.Rotations)
+	teams, users, escalations := parseRotations(schedule.Rotations)
 
 	if len(teams) > 0 {
 		profile["schedule_teams"] = scheduleParticipantsToInterfaceSlice(teams)
@@ -75,12 +83,33 @@ func scheduleResource(schedule *ogSchedule.Schedule) (*v2.Resource, error) {
 		profile["schedule_users"] = scheduleParticipantsToInterfaceSlice(users)
 	}
 
+	if len(escalations) > 0 {
+		profile["schedule_escalations"] = scheduleParticipantsToInterfaceSlice(escalations)
+	}
+
+	if risks != nil {
+		risks.addToProfile(profile)
+	}
+
+	opts := []rs.ResourceOption{
+		rs.WithResourceProfile(profile),
+	}
+
+	if schedule.OwnerTeam != nil {
+		profile["owner_team_id"] = schedule.OwnerTeam.Id
+		profile["owner_team_name"] = schedule.OwnerTeam.Name
+
+		if parentID := ownerTeamParentResourceID(schedule.OwnerTeam.Id); parentID != nil {
+			opts = append(opts, rs.WithParentResourceID(parentID))
+		}
+	}
+
 	resource, err := rs.NewGroupResource(
 		schedule.Name,
 		resourceTypeSchedule,
 		schedule.Id,
 		[]rs.GroupTraitOption{},
-		rs.WithResourceProfile(profile),
+		opts...,
 	)
 	if err != nil {
 		return nil, err
@@ -89,170 +118,300 @@ func scheduleResource(schedule *ogSchedule.Schedule) (*v2.Resource, error) {
 	return resource, nil
 }
 
-func (s *scheduleResourceType) List(ctx context.Context, parentID *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	client, err := ogSchedule.NewClient(s.config)
-	if err != nil {
-		return nil, "", nil, err
+func (s *scheduleResourceType) List(ctx context.Context, parentID *v2.ResourceId, opts rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error) {
+	// Schedules are listed once at the top level, they carry their owner team as parent.
+	if parentID != nil {
+		return nil, nil, nil
 	}
+	s.cache.scope(opts)
 
-	expand := true
-	req := &ogSchedule.ListRequest{
-		BaseRequest: ogClient.BaseRequest{},
-		Expand:      &expand,
-	}
-	schedules, err := client.List(ctx, req)
+	// Schedules are listed without the filter, their risks are assessed on all of their participants.
+	schedules, err := withoutFilter(s.backend).ListSchedules(ctx)
 	if err != nil {
-		return nil, "", nil, fmt.Errorf("opsgenie-connector: failed to list schedules: %w", err)
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list schedules: %w", err)
 	}
 
 	var rv []*v2.Resource
-	for _, schedule := range schedules.Schedule {
-		scheduleCopy := schedule
+	for i := range schedules {
+		schedule, err := filterSchedule(ctx, s.backend, &schedules[i])
+		if err != nil {
+			return nil, nil, fmt.Errorf("opsgenie-connector: failed to list schedules: %w", err)
+		}
+		if schedule == nil {
+			continue
+		}
 
-		sr, err := scheduleResource(&scheduleCopy)
+		risks, err := assessScheduleRisks(ctx, s.cache, &schedules[i])
 		if err != nil {
-			return nil, "", nil, err
+			return nil, nil, err
+		}
+
+		sr, err := scheduleResource(schedule, risks)
+		if err != nil {
+			return nil, nil, err
 		}
 
 		rv = append(rv, sr)
 	}
 
-	return rv, "", nil, nil
+	return rv, &rs.SyncOpResults{}, nil
+}
+
+// Get fetches a single schedule by ID for targeted syncs.
+func (s *scheduleResourceType) Get(ctx context.Context, resourceID *v2.ResourceId, _ *v2.ResourceId) (*v2.Resource, annotations.Annotations, error) {
+	unfiltered, err := withoutFilter(s.backend).GetSchedule(ctx, resourceID.Resource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get schedule %s: %w", resourceID.Resource, err)
+	}
+
+	schedule, err := filterSchedule(ctx, s.backend, unfiltered)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get schedule %s: %w", resourceID.Resource, err)
+	}
+	if schedule == nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get schedule %s: %w", resourceID.Resource, filteredNotFound("schedule", resourceID.Resource))
+	}
+
+	// A targeted sync has no sync ID to scope the cache with, so the risks are assessed on fresh lookups.
+	risks, err := assessScheduleRisks(ctx, newSyncCache(s.backend), unfiltered)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sr, err := scheduleResource(schedule, risks)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return sr, nil, nil
 }
 
-func (s *scheduleResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+func (s *scheduleResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Entitlement, *rs.SyncOpResults, error) {
 	var rv []*v2.Entitlement
 
 	memberEntitlementOptions := []ent.EntitlementOption{
-		ent.WithGrantableTo(resourceTypeUser, resourceTypeTeam),
+		ent.WithGrantableTo(resourceTypeUser, resourceTypeTeam, resourceTypeEscalation, resourceTypeUnknownPrincipal),
 		ent.WithDisplayName(fmt.Sprintf("%s schedule %s", resource.DisplayName, scheduleMember)),
 		ent.WithDescription(fmt.Sprintf("%s OpsGenie schedule %s", resource.DisplayName, scheduleMember)),
 	}
 
 	oncallEntitlementOptions := []ent.EntitlementOption{
-		ent.WithGrantableTo(resourceTypeUser),
+		ent.WithGrantableTo(resourceTypeUser, resourceTypeTeam, resourceTypeEscalation, resourceTypeUnknownPrincipal),
 		ent.WithDisplayName(fmt.Sprintf("%s schedule %s", resource.DisplayName, scheduleOnCall)),
 		ent.WithDescription(fmt.Sprintf("%s OpsGenie schedule %s", resource.DisplayName, scheduleOnCall)),
 	}
 
+	ownerEntitlementOptions := []ent.EntitlementOption{
+		ent.WithGrantableTo(resourceTypeTeam),
+		ent.WithDisplayName(fmt.Sprintf("%s schedule %s", resource.DisplayName, scheduleOwner)),
+		ent.WithDescription(fmt.Sprintf("Team that owns and can edit the %s OpsGenie schedule", resource.DisplayName)),
+	}
+
 	rv = append(
 		rv,
 		ent.NewAssignmentEntitlement(resource, scheduleMember, memberEntitlementOptions...),
 		ent.NewAssignmentEntitlement(resource, scheduleOnCall, oncallEntitlementOptions...),
+		ent.NewAssignmentEntitlement(resource, scheduleOwner, ownerEntitlementOptions...),
 	)
 
-	return rv, "", nil, nil
+	return rv, &rs.SyncOpResults{}, nil
 }
 
-func (s *scheduleResourceType) Grants(ctx context.Context, resource *v2.Resource, pToken *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
+func (s *scheduleResourceType) Grants(ctx context.Context, resource *v2.Resource, opts rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error) {
 	l := ctxzap.Extract(ctx)
+	s.cache.scope(opts)
 
-	// parse resource profile to get schedule members (users or teams)
+	// parse resource profile to get schedule members (users, teams or escalations)
+	profile := rs.GetProfile(resource)
 
-	users, ok := getProfileStringArray(rs.GetProfile(resource), "schedule_users")
+	users, ok := getProfileStringArray(profile, "schedule_users")
 	if !ok {
 		l.Info("opsgenie-connector: no users found for schedule resource")
 	}
 
-	teams, ok := getProfileStringArray(rs.GetProfile(resource), "schedule_teams")
+	teams, ok := getProfileStringArray(profile, "schedule_teams")
 	if !ok {
 		l.Info("opsgenie-connector: no teams found for schedule resource")
 	}
 
+	escalations, _ := getProfileStringArray(profile, "schedule_escalations")
+
 	var rv []*v2.Grant
 
-	// grant users and teams under schedule the member entitlement
-	for _, u := range users {
-		rv = append(rv, grant.NewGrant(
-			resource,
-			scheduleMember,
-			&v2.ResourceId{
-				ResourceType: resourceTypeUser.Id,
-				Resource:     u,
-			},
-		))
-	}
-
-	for _, t := range teams {
-		rv = append(rv, grant.NewGrant(
-			resource,
-			scheduleMember,
-			&v2.ResourceId{
-				ResourceType: resourceTypeTeam.Id,
-				Resource:     t,
-			},
-			grant.WithAnnotation(
-				&v2.GrantExpandable{
-					EntitlementIds: []string{fmt.Sprintf("team:%s:%s", t, scheduleMember)},
-				},
-			),
-		))
-	}
-
-	// grant users and teams under schedule the on-call entitlement
-	client, err := ogSchedule.NewClient(s.config)
-	if err != nil {
-		return nil, "", nil, err
+	// users and teams missing from the account are granted through their unknown principal instead,
+	// the users and teams are only listed once a participant needs checking
+	var index *participantIndex
+	isDangling := func(participantType, id string) (bool, error) {
+		if participantType != userParticipantType && participantType != teamParticipantType {
+			return false, nil
+		}
+		if index == nil {
+			var err error
+			index, err = newParticipantIndex(ctx, s.cache)
+			if err != nil {
+				return false, err
+			}
+		}
+		return index.dangling(participantType, id), nil
+	}
+	dangling := make(map[string]bool)
+
+	// grant rotation participants the member entitlement, teams and escalations expand to their people
+	for _, members := range []struct {
+		participantType string
+		ids             []string
+	}{
+		{userParticipantType, users},
+		{teamParticipantType, teams},
+		{escalationParticipantType, escalations},
+	} {
+		for _, id := range members.ids {
+			unknown, err := isDangling(members.participantType, id)
+			if err != nil {
+				return nil, nil, err
+			}
+			if unknown {
+				l.Warn("opsgenie-connector: schedule rotation references an unknown participant",
+					zap.String("schedule_id", resource.Id.Resource),
+					zap.String("participant_type", members.participantType),
+					zap.String("participant_id", id),
+				)
+				dangling[members.participantType+"/"+id] = true
+				rv = append(rv, grant.NewGrant(resource, scheduleMember, unknownPrincipalResourceID(members.participantType, id)))
+				continue
+			}
+
+			g, err := participantGrant(resource, scheduleMember, members.participantType, id)
+			if err != nil {
+				return nil, nil, err
+			}
+			rv = append(rv, g)
+		}
 	}
 
-	flat := false
-	req := &ogSchedule.GetOnCallsRequest{
-		BaseRequest:        ogClient.BaseRequest{},
-		Flat:               &flat,
-		ScheduleIdentifier: resource.DisplayName,
+	// grant the owner team the owner entitlement, members of the team can edit the schedule
+	if ownerTeamID, ok := rs.GetProfileStringValue(profile, "owner_team_id"); ok && ownerTeamID != "" {
+		g, err := participantGrant(resource, scheduleOwner, teamParticipantType, ownerTeamID)
+		if err != nil {
+			return nil, nil, err
+		}
+		rv = append(rv, g)
 	}
 
-	oncalls, err := client.GetOnCalls(ctx, req)
+	// grant the current on-call participants the on-call entitlement
+	oncalls, err := s.cache.OnCalls(ctx, resource.Id.Resource, resource.DisplayName)
 	if err != nil {
-		// Check if the error is a 404 from OpsGenie API (schedule doesn't exist)
-		// Wrap with codes.NotFound so baton-sdk can handle this as a warning
-		var apiErr *ogClient.ApiError
-		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
-			return nil, "", nil, status.Error(codes.NotFound, fmt.Sprintf("opsgenie-connector: schedule not found: %s", err.Error()))
+		// A 404 means the schedule no longer exists, its codes.NotFound lets baton-sdk handle it as a warning.
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list on-calls: %w", err)
+	}
+
+	for _, p := range oncalls {
+		participantType := string(p.Type)
+		if dangling[participantType+"/"+p.Id] {
+			rv = append(rv, grant.NewGrant(resource, scheduleOnCall, unknownPrincipalResourceID(participantType, p.Id)))
+			continue
+		}
+
+		// overrides can put people on call that aren't in any rotation, and so have no unknown principal
+		unknown, err := isDangling(participantType, p.Id)
+		if err != nil {
+			return nil, nil, err
 		}
-		return nil, "", nil, fmt.Errorf("opsgenie-connector: failed to list on-calls: %w", err)
-	}
-
-	for _, p := range oncalls.OnCallParticipants {
-		var resourceType string
-		var grantOptions []grant.GrantOption
-
-		switch p.Type {
-		case userParticipantType:
-			resourceType = resourceTypeUser.Id
-		case teamParticipantType:
-			resourceType = resourceTypeTeam.Id
-			grantOptions = append(
-				grantOptions,
-				grant.WithAnnotation(
-					&v2.GrantExpandable{
-						EntitlementIds: []string{fmt.Sprintf("team:%s:%s", p.Id, teamMemberEntitlement)},
-					},
-				),
+		if unknown {
+			l.Warn("opsgenie-connector: dropping unknown on-call participant",
+				zap.String("schedule_id", resource.Id.Resource),
+				zap.String("participant_type", participantType),
+				zap.String("participant_id", p.Id),
 			)
-		case escalationParticipantType:
 			continue
-		default:
-			return nil, "", nil, fmt.Errorf("opsgenie-connector: unknown participant type: %s", p.Type)
 		}
 
-		rv = append(rv, grant.NewGrant(
-			resource,
-			scheduleOnCall,
-			&v2.ResourceId{
-				ResourceType: resourceType,
-				Resource:     p.Id,
-			},
-			grantOptions...,
-		))
+		g, err := participantGrant(resource, scheduleOnCall, participantType, p.Id)
+		if err != nil {
+			return nil, nil, err
+		}
+		rv = append(rv, g)
+	}
+
+	return rv, &rs.SyncOpResults{}, nil
+}
+
+// Grant reassigns the ownership of a schedule to a team. Only the owner entitlement can be provisioned,
+// membership and on-call follow the rotations of the schedule.
+func (s *scheduleResourceType) Grant(ctx context.Context, principal *v2.Resource, entitlement *v2.Entitlement) (annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if entitlementSlug(entitlement) != scheduleOwner {
+		return nil, status.Errorf(codes.Unimplemented, "opsgenie-connector: only the %s entitlement of schedules can be granted", scheduleOwner)
+	}
+
+	if principal.GetId().GetResourceType() != resourceTypeTeam.Id {
+		return nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: schedules can only be owned by teams, got %s", principal.GetId().GetResourceType())
+	}
+
+	// Ownership is changed through the classic API, whatever the filter applied to the backend.
+	ob, ok := withoutFilter(s.backend).(*opsgenieBackend)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "opsgenie-connector: schedule ownership can only be granted with the %s backend", backendOpsgenie)
+	}
+
+	scheduleID := entitlement.GetResource().GetId().GetResource()
+	teamID := principal.GetId().GetResource()
+
+	current, err := ob.schedules.Get(ctx, &ogSchedule.GetRequest{
+		IdentifierType:  ogSchedule.Id,
+		IdentifierValue: scheduleID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to get schedule %s: %w", scheduleID, translateAPIError(s.failures, err))
+	}
+
+	if current.Schedule.OwnerTeam != nil && current.Schedule.OwnerTeam.Id == teamID {
+		return annotations.New(&v2.GrantAlreadyExists{}), nil
+	}
+
+	// The SDK always sends the name, so the current name is passed along to keep it unchanged.
+	update := &ogSchedule.UpdateRequest{
+		IdentifierType:  ogSchedule.Id,
+		IdentifierValue: scheduleID,
+		Name:            current.Schedule.Name,
+		OwnerTeam:       &og.OwnerTeam{Id: teamID},
+	}
+	if s.dryRun {
+		return dryRunRequest(ctx, "grant", update)
+	}
+
+	result, err := ob.schedules.Update(ctx, update)
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to reassign owner of schedule %s: %w", scheduleID, translateAPIError(s.failures, err))
+	}
+
+	l.Info("opsgenie-connector: reassigned schedule owner",
+		zap.String("schedule_id", scheduleID),
+		zap.String("team_id", teamID),
+		zap.String("request_id", result.RequestId),
+	)
+
+	return nil, nil
+}
+
+// Revoke is not supported, a schedule keeps its owner team until ownership is granted to another team.
+// It never sends a request, so dry-run provisioning doesn't change it.
+func (s *scheduleResourceType) Revoke(_ context.Context, grant *v2.Grant) (annotations.Annotations, error) {
+	if entitlementSlug(grant.GetEntitlement()) != scheduleOwner {
+		return nil, status.Errorf(codes.Unimplemented, "opsgenie-connector: only the %s entitlement of schedules can be revoked", scheduleOwner)
 	}
 
-	return rv, "", nil, nil
+	return nil, status.Error(codes.FailedPrecondition, "opsgenie-connector: schedule ownership can't be removed, grant it to another team instead")
 }
 
-func scheduleBuilder(config *ogClient.Config) *scheduleResourceType {
+func scheduleBuilder(config *ogClient.Config, failures *failureLog, b backend, cache *syncCache, dryRun bool) *scheduleResourceType {
 	return &scheduleResourceType{
 		resourceType: resourceTypeSchedule,
 		config:       config,
+		failures:     failures,
+		backend:      b,
+		cache:        cache,
+		dryRun:       dryRun,
 	}
 }
@@ -0,0 +1,284 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	config "github.com/conductorone/baton-sdk/pb/c1/config/v1"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/actions"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	getCurrentOnCallAction      = "get_current_on_call"
+	getNextOnCallAction         = "get_next_on_call"
+	exportOnCallCalendarAction  = "export_on_call_calendar"
+	scheduleActionResourceIDArg = "resource_id"
+)
+
+func listReturnType(name string) *config.Field {
+	return &config.Field{Name: name, Field: &config.Field_StringSliceField{StringSliceField: &config.StringSliceField{}}}
+}
+
+func mapReturnType(name string) *config.Field {
+	return &config.Field{Name: name, Field: &config.Field_StringMapField{StringMapField: &config.StringMapField{}}}
+}
+
+var (
+	scheduleResourceIDArgument = resourceIDArgument(scheduleActionResourceIDArg, "Schedule", "The schedule to query", resourceTypeSchedule)
+	scheduleDateArgument       = stringArgument("date", "Date", "Point in time to evaluate in RFC3339 format (defaults to now)", false)
+
+	getCurrentOnCallActionSchema = &v2.BatonActionSchema{
+		Name:        getCurrentOnCallAction,
+		DisplayName: "Get Current On-Call",
+		Description: "List who is on call for the schedule right now",
+		Arguments:   []*config.Field{scheduleResourceIDArgument, scheduleDateArgument},
+		ReturnTypes: []*config.Field{
+			boolReturnType("success"),
+			stringReturnType("schedule_id"),
+			stringReturnType("schedule_name"),
+			listReturnType("on_call_participants"),
+			stringReturnType("request_id"),
+		},
+	}
+
+	getNextOnCallActionSchema = &v2.BatonActionSchema{
+		Name:        getNextOnCallAction,
+		DisplayName: "Get Next On-Call",
+		Description: "List who is on call next for the schedule",
+		Arguments:   []*config.Field{scheduleResourceIDArgument, scheduleDateArgument},
+		ReturnTypes: []*config.Field{
+			boolReturnType("success"),
+			stringReturnType("schedule_id"),
+			stringReturnType("schedule_name"),
+			listReturnType("next_on_call_recipients"),
+			listReturnType("exact_next_on_call_recipients"),
+			stringReturnType("request_id"),
+		},
+	}
+
+	exportOnCallCalendarActionSchema = &v2.BatonActionSchema{
+		Name:        exportOnCallCalendarAction,
+		DisplayName: "Export On-Call Calendar",
+		Description: "Export the on-call calendar (ICS) of a user, or of everyone currently on call for the schedule",
+		Arguments: []*config.Field{
+			scheduleResourceIDArgument,
+			{
+				Name:        "user",
+				DisplayName: "User",
+				Description: "The user whose calendar to export (defaults to the users currently on call)",
+				Field: &config.Field_ResourceIdField{ResourceIdField: &config.ResourceIdField{
+					Rules: &config.ResourceIDRules{AllowedResourceTypeIds: []string{resourceTypeUser.Id}},
+				}},
+			},
+		},
+		ReturnTypes: []*config.Field{
+			boolReturnType("success"),
+			stringReturnType("schedule_id"),
+			mapReturnType("calendars"),
+		},
+	}
+)
+
+func (s *scheduleResourceType) ResourceActions(ctx context.Context, registry actions.ActionRegistry) error {
+	if err := registry.Register(ctx, getCurrentOnCallActionSchema, s.getCurrentOnCall); err != nil {
+		return err
+	}
+
+	if err := registry.Register(ctx, getNextOnCallActionSchema, s.getNextOnCall); err != nil {
+		return err
+	}
+
+	return registry.Register(ctx, exportOnCallCalendarActionSchema, s.exportOnCallCalendar)
+}
+
+// optionalTimeArg extracts an optional RFC3339 timestamp argument, returning nil when it is not set.
+func optionalTimeArg(args *structpb.Struct, key string) (*time.Time, error) {
+	if v, ok := actions.GetStringArg(args, key); !ok || v == "" {
+		return nil, nil
+	}
+
+	t, err := requireTimeArg(args, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// getCurrentOnCall lists the participants on call by name, the username of a user or the name of a
+// team, escalation or schedule, as Opsgenie lists on-call recipients.
+func (s *scheduleResourceType) getCurrentOnCall(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	scheduleID, err := requireResourceIDArg(args, scheduleActionResourceIDArg, resourceTypeSchedule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	date, err := optionalTimeArg(args, "date")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := ogSchedule.NewClient(s.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flat := false
+	oncalls, err := client.GetOnCalls(ctx, &ogSchedule.GetOnCallsRequest{
+		Flat:                   &flat,
+		Date:                   date,
+		ScheduleIdentifierType: ogSchedule.Id,
+		ScheduleIdentifier:     scheduleID.Resource,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list on-calls: %w", translateAPIError(s.failures, err))
+	}
+
+	var participants []*structpb.Value
+	for _, p := range oncalls.OnCallParticipants {
+		participants = append(participants, structpb.NewStringValue(p.Name))
+		for _, nested := range p.OnCallParticipants {
+			participants = append(participants, structpb.NewStringValue(nested.Name))
+		}
+	}
+
+	return actionResult(map[string]*structpb.Value{
+		"schedule_id":          structpb.NewStringValue(scheduleID.Resource),
+		"schedule_name":        structpb.NewStringValue(oncalls.Parent.Name),
+		"on_call_participants": structpb.NewListValue(&structpb.ListValue{Values: participants}),
+		"request_id":           structpb.NewStringValue(oncalls.RequestId),
+	}), nil, nil
+}
+
+func nextOnCallRecipientValues(recipients []ogSchedule.NextOnCallRecipients) *structpb.Value {
+	var values []*structpb.Value
+	for _, r := range recipients {
+		values = append(values, structpb.NewStringValue(r.Name))
+	}
+
+	return structpb.NewListValue(&structpb.ListValue{Values: values})
+}
+
+func (s *scheduleResourceType) getNextOnCall(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	scheduleID, err := requireResourceIDArg(args, scheduleActionResourceIDArg, resourceTypeSchedule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	date, err := optionalTimeArg(args, "date")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := ogSchedule.NewClient(s.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	flat := false
+	next, err := client.GetNextOnCall(ctx, &ogSchedule.GetNextOnCallsRequest{
+		Flat:                   &flat,
+		Date:                   date,
+		ScheduleIdentifierType: ogSchedule.Id,
+		ScheduleIdentifier:     scheduleID.Resource,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get next on-calls: %w", translateAPIError(s.failures, err))
+	}
+
+	return actionResult(map[string]*structpb.Value{
+		"schedule_id":                   structpb.NewStringValue(scheduleID.Resource),
+		"schedule_name":                 structpb.NewStringValue(next.Parent.Name),
+		"next_on_call_recipients":       nextOnCallRecipientValues(next.NextOnCallRecipients),
+		"exact_next_on_call_recipients": nextOnCallRecipientValues(next.ExactNextOnCallRecipients),
+		"request_id":                    structpb.NewStringValue(next.RequestId),
+	}), nil, nil
+}
+
+// exportCalendar exports the on-call calendar of a user. The Opsgenie SDK writes the ICS file to disk,
+// so it is exported into a temporary directory and read back.
+func (s *scheduleResourceType) exportCalendar(ctx context.Context, client *ogSchedule.Client, userIdentifier string) (string, error) {
+	dir, err := os.MkdirTemp("", "baton-opsgenie-ics")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	req := &ogSchedule.ExportOnCallUserRequest{
+		UserIdentifier:   userIdentifier,
+		ExportedFilePath: dir + string(filepath.Separator),
+	}
+
+	f, err := client.ExportOnCallUser(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("opsgenie-connector: failed to export on-call calendar of %s: %w", userIdentifier, translateAPIError(s.failures, err))
+	}
+
+	content, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return string(content), nil
+}
+
+func (s *scheduleResourceType) exportOnCallCalendar(ctx context.Context, args *structpb.Struct) (*structpb.Struct, annotations.Annotations, error) {
+	scheduleID, err := requireResourceIDArg(args, scheduleActionResourceIDArg, resourceTypeSchedule)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	client, err := ogSchedule.NewClient(s.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var users []string
+	if _, ok := args.GetFields()["user"]; ok {
+		userID, err := requireResourceIDArg(args, "user", resourceTypeUser)
+		if err != nil {
+			return nil, nil, err
+		}
+		users = append(users, userID.Resource)
+	} else {
+		flat := true
+		oncalls, err := client.GetOnCalls(ctx, &ogSchedule.GetOnCallsRequest{
+			Flat:                   &flat,
+			ScheduleIdentifierType: ogSchedule.Id,
+			ScheduleIdentifier:     scheduleID.Resource,
+		})
+		if err != nil {
+			return nil, nil, fmt.Errorf("opsgenie-connector: failed to list on-calls: %w", translateAPIError(s.failures, err))
+		}
+		users = oncalls.OnCallRecipients
+	}
+
+	if len(users) == 0 {
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "opsgenie-connector: nobody is on call for schedule %s", scheduleID.Resource)
+	}
+
+	// Calendars maps each user to their ICS calendar.
+	calendars := make(map[string]*structpb.Value, len(users))
+	for _, u := range users {
+		ics, err := s.exportCalendar(ctx, client, u)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		calendars[u] = structpb.NewStringValue(ics)
+	}
+
+	return actionResult(map[string]*structpb.Value{
+		"schedule_id": structpb.NewStringValue(scheduleID.Resource),
+		"calendars":   structpb.NewStructValue(&structpb.Struct{Fields: calendars}),
+	}), nil, nil
+}
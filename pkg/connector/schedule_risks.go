@@ -0,0 +1,144 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+	"go.uber.org/zap"
+)
+
+// Schedules are flagged with the coverage gaps found while listing them, so that C1 policies can
+// alert on them. The flags are profile keys: risks lists the flags that apply, and each flag has its
+// own key with the details.
+const (
+	// riskNoOnCall flags a schedule with nobody on call right now.
+	riskNoOnCall = "no_on_call"
+	// riskInactiveRotation flags a schedule with a rotation made up only of blocked or unverified
+	// users, or of users that no longer exist.
+	riskInactiveRotation = "inactive_rotation"
+	// riskSinglePersonRotation flags a schedule with a rotation of a single user.
+	riskSinglePersonRotation = "single_person_rotation"
+	// riskEmptyOwnerTeam flags a schedule whose owner team has no members.
+	riskEmptyOwnerTeam = "empty_owner_team"
+)
+
+// scheduleRisks are the coverage gaps of a schedule. Rotations are named by their name, or their ID
+// when they have none.
+type scheduleRisks struct {
+	noOnCall              bool
+	inactiveRotations     []string
+	singlePersonRotations []string
+	emptyOwnerTeam        bool
+}
+
+// flags returns the risk flags that apply, in a stable order.
+func (r *scheduleRisks) flags() []string {
+	var rv []string
+	if r.noOnCall {
+		rv = append(rv, riskNoOnCall)
+	}
+	if len(r.inactiveRotations) > 0 {
+		rv = append(rv, riskInactiveRotation)
+	}
+	if len(r.singlePersonRotations) > 0 {
+		rv = append(rv, riskSinglePersonRotation)
+	}
+	if r.emptyOwnerTeam {
+		rv = append(rv, riskEmptyOwnerTeam)
+	}
+
+	return rv
+}
+
+// addToProfile sets the risk keys of a schedule profile.
+func (r *scheduleRisks) addToProfile(profile map[string]interface{}) {
+	profile["risks"] = scheduleParticipantsToInterfaceSlice(r.flags())
+	profile["risk_"+riskNoOnCall] = r.noOnCall
+	profile["risk_"+riskEmptyOwnerTeam] = r.emptyOwnerTeam
+	if len(r.inactiveRotations) > 0 {
+		profile["risk_"+riskInactiveRotation] = scheduleParticipantsToInterfaceSlice(r.inactiveRotations)
+	}
+	if len(r.singlePersonRotations) > 0 {
+		profile["risk_"+riskSinglePersonRotation] = scheduleParticipantsToInterfaceSlice(r.singlePersonRotations)
+	}
+}
+
+// assessScheduleRisks finds the coverage gaps of a schedule. The on-calls, users and teams it reads
+// are cached for the grants of the sync. The on-call risk is left out for a schedule that no longer
+// exists, listing its grants reports it.
+//
+// Risks are about who Opsgenie pages, so filters don't apply to them: the schedule is the unfiltered
+// one, and filtered out users still take their turns and count as on call or as owner team members.
+func assessScheduleRisks(ctx context.Context, cache *syncCache, schedule *ogSchedule.Schedule) (*scheduleRisks, error) {
+	rv := &scheduleRisks{}
+	cache = cache.unfiltered
+
+	oncalls, err := cache.OnCalls(ctx, schedule.Id, schedule.Name)
+	switch {
+	case isNotFound(err):
+		ctxzap.Extract(ctx).Debug("opsgenie-connector: schedule not found while listing its on-calls", zap.String("schedule_id", schedule.Id))
+	case err != nil:
+		return nil, fmt.Errorf("opsgenie-connector: failed to list on-calls of schedule %s: %w", schedule.Id, err)
+	default:
+		rv.noOnCall = len(oncalls) == 0
+	}
+
+	if len(schedule.Rotations) > 0 {
+		users, err := cache.Users(ctx)
+		if err != nil {
+			return nil, err
+		}
+		active := make(map[string]bool, len(users))
+		for _, u := range users {
+			active[u.Id] = !u.Blocked && u.Verified
+		}
+
+		for _, rotation := range schedule.Rotations {
+			name := rotation.Name
+			if name == "" {
+				name = rotation.Id
+			}
+
+			// Teams and escalations stand for several people, whose activity isn't checked.
+			var people, inactive int
+			groups := false
+			for _, p := range rotation.Participants {
+				switch p.Type {
+				case userParticipantType:
+					people++
+					if !active[p.Id] {
+						inactive++
+					}
+				case teamParticipantType, escalationParticipantType:
+					groups = true
+				}
+			}
+			if groups {
+				continue
+			}
+
+			if people == 1 {
+				rv.singlePersonRotations = append(rv.singlePersonRotations, name)
+			}
+			if people > 0 && inactive == people {
+				rv.inactiveRotations = append(rv.inactiveRotations, name)
+			}
+		}
+	}
+
+	if schedule.OwnerTeam != nil && schedule.OwnerTeam.Id != "" {
+		team, err := cache.Team(ctx, schedule.OwnerTeam.Id)
+		switch {
+		case isNotFound(err):
+			// The owner team is gone, the schedule then has no owner grant.
+		case err != nil:
+			return nil, err
+		default:
+			rv.emptyOwnerTeam = len(team.Members) == 0
+		}
+	}
+
+	return rv, nil
+}
@@ -0,0 +1,140 @@
+package connector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	cfg "github.com/conductorone/baton-opsgenie/pkg/config"
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+)
+
+// newRiskyScheduleTenant serves a quiet schedule owned by an empty team, with a single person
+// rotation, a rotation of inactive users and a team rotation, next to a healthy schedule.
+func newRiskyScheduleTenant(t *testing.T) *opsgenietest.Server {
+	t.Helper()
+
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1", Verified: true})
+	srv.AddUser(opsgenietest.User{ID: "user-2", Verified: true})
+	srv.AddUser(opsgenietest.User{ID: "user-blocked", Verified: true, Blocked: true})
+	srv.AddUser(opsgenietest.User{ID: "user-unverified"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-empty", Name: "empty"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "sre", Members: []opsgenietest.Member{{UserID: "user-1"}}})
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:          "schedule-quiet",
+		Name:        "quiet",
+		OwnerTeamID: "team-empty",
+		Rotations: []opsgenietest.Rotation{
+			{Name: "solo", Participants: []opsgenietest.Participant{
+				{Type: opsgenietest.UserParticipant, ID: "user-1"},
+			}},
+			{ID: "rotation-2", Participants: []opsgenietest.Participant{
+				{Type: opsgenietest.UserParticipant, ID: "user-blocked"},
+				{Type: opsgenietest.UserParticipant, ID: "user-unverified"},
+				{Type: opsgenietest.UserParticipant, ID: "user-deleted"},
+			}},
+			{Name: "teams", Participants: []opsgenietest.Participant{
+				{Type: opsgenietest.TeamParticipant, ID: "team-1"},
+			}},
+		},
+	})
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:          "schedule-healthy",
+		Name:        "healthy",
+		OwnerTeamID: "team-1",
+		Rotations: []opsgenietest.Rotation{{Name: "pair", Participants: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-1"},
+			{Type: opsgenietest.UserParticipant, ID: "user-2"},
+		}}},
+		OnCall: []opsgenietest.Participant{{Type: opsgenietest.UserParticipant, ID: "user-2"}},
+	})
+
+	return srv
+}
+
+func TestScheduleList_Risks(t *testing.T) {
+	b := newTestOpsgenieBackend(t, newRiskyScheduleTenant(t).Config())
+	schedules, _, err := scheduleBuilder(nil, nil, b, newSyncCache(b), false).List(context.Background(), nil, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(schedules) != 2 {
+		t.Fatalf("expected 2 schedules, got %d", len(schedules))
+	}
+
+	quiet := rs.GetProfile(schedules[0])
+	if risks, _ := getProfileStringArray(quiet, "risks"); !reflect.DeepEqual(risks, []string{
+		riskNoOnCall, riskInactiveRotation, riskSinglePersonRotation, riskEmptyOwnerTeam,
+	}) {
+		t.Errorf("unexpected risks of the quiet schedule %v", risks)
+	}
+	if inactive, _ := getProfileStringArray(quiet, "risk_inactive_rotation"); !reflect.DeepEqual(inactive, []string{"rotation-2"}) {
+		t.Errorf("unexpected inactive rotations %v", inactive)
+	}
+	if single, _ := getProfileStringArray(quiet, "risk_single_person_rotation"); !reflect.DeepEqual(single, []string{"solo"}) {
+		t.Errorf("unexpected single person rotations %v", single)
+	}
+
+	healthy := rs.GetProfile(schedules[1])
+	if risks, _ := getProfileStringArray(healthy, "risks"); len(risks) != 0 {
+		t.Errorf("unexpected risks of the healthy schedule %v", risks)
+	}
+	for _, key := range []string{"risk_no_on_call", "risk_empty_owner_team"} {
+		if v, ok := healthy.GetFields()[key]; !ok || v.GetBoolValue() {
+			t.Errorf("expected %s to be false, got %v", key, v)
+		}
+	}
+}
+
+// Filters hide users from the sync, not from Opsgenie: a filtered out user still takes turns, is on
+// call and belongs to the owner team, so no risk is flagged because of the filter.
+func TestScheduleList_RisksIgnoreFilters(t *testing.T) {
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1", Username: "jane@example.com", Verified: true})
+	srv.AddUser(opsgenietest.User{ID: "user-bot", Username: "bot@example.com", Verified: true, Tags: []string{"bot"}})
+	srv.AddUser(opsgenietest.User{ID: "user-stakeholder", Username: "boss@example.com", Verified: true, Role: stakeholderRole})
+	srv.AddTeam(opsgenietest.Team{ID: "team-1", Name: "leads", Members: []opsgenietest.Member{{UserID: "user-stakeholder"}}})
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:          "schedule-1",
+		Name:        "primary",
+		OwnerTeamID: "team-1",
+		Rotations: []opsgenietest.Rotation{{ID: "rotation-1", Name: "pair", Participants: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-1"},
+			{Type: opsgenietest.UserParticipant, ID: "user-bot"},
+		}}},
+		OnCall: []opsgenietest.Participant{{Type: opsgenietest.UserParticipant, ID: "user-bot"}},
+	})
+
+	inner := newTestOpsgenieBackend(t, srv.Config())
+	filter, err := newResourceFilter(&cfg.Opsgenie{SkipUserTags: []string{"bot"}, SkipStakeholders: true}, inner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := newFilteredBackend(inner, filter)
+	builder := scheduleBuilder(nil, nil, b, newSyncCache(b), false)
+
+	schedules, _, err := builder.List(context.Background(), nil, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(schedules) != 1 {
+		t.Fatalf("expected 1 schedule, got %d", len(schedules))
+	}
+	got, _, err := builder.Get(context.Background(), &v2.ResourceId{ResourceType: resourceTypeSchedule.Id, Resource: "schedule-1"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, schedule := range []*v2.Resource{schedules[0], got} {
+		profile := rs.GetProfile(schedule)
+		if risks, _ := getProfileStringArray(profile, "risks"); len(risks) != 0 {
+			t.Errorf("expected no risks, got %v", risks)
+		}
+		if users, _ := getProfileStringArray(profile, "schedule_users"); !reflect.DeepEqual(users, []string{"user-1"}) {
+			t.Errorf("expected the bot to be filtered out of the schedule, got %v", users)
+		}
+	}
+}
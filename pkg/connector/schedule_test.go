@@ -2,69 +2,297 @@ package connector
 
 import (
 	"context"
-	"encoding/json"
 	"net/http"
 	"net/http/httptest"
-	"strings"
+	"reflect"
 	"testing"
 
-	ogClient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
 	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-// mockOpsGenieError is the JSON body the OpsGenie API returns for error responses.
-type mockOpsGenieError struct {
-	Message   string  `json:"message"`
-	Took      float32 `json:"took"`
-	RequestId string  `json:"requestId"`
-}
-
 func TestScheduleGrants_404ReturnsNotFound(t *testing.T) {
 	scheduleName := "IC - IT 911 Only_test Schedule"
 
+	// The fake has no schedules, so it answers the on-call request with a 404.
+	config := opsgenietest.NewServer(t).Config()
+
+	b := newTestOpsgenieBackend(t, config)
+	builder := scheduleBuilder(config, nil, b, newSyncCache(b), false)
+
+	resource, err := scheduleResource(&ogSchedule.Schedule{
+		Id:   "test-schedule-id",
+		Name: scheduleName,
+	}, nil)
+	if err != nil {
+		t.Fatalf("failed to build schedule resource: %v", err)
+	}
+
+	_, _, err = builder.Grants(context.Background(), resource, rs.SyncOpAttrs{})
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+
+	if got := status.Code(err); got != codes.NotFound {
+		t.Errorf("expected codes.NotFound, got %v (err: %v)", got, err)
+	}
+}
+
+func TestScheduleGetCurrentOnCallAction(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if strings.Contains(r.URL.Path, "/on-calls") {
-			w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/v2/schedules/test-schedule-id/on-calls" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
 			w.WriteHeader(http.StatusNotFound)
-			_ = json.NewEncoder(w).Encode(mockOpsGenieError{
-				Message:   "No schedule exists with name [" + scheduleName + "]",
-				Took:      0.0,
-				RequestId: "test-request-id",
-			})
 			return
 		}
-		w.WriteHeader(http.StatusInternalServerError)
+
+		if got := r.URL.Query().Get("scheduleIdentifierType"); got != "id" {
+			t.Errorf("expected schedule identifier type id, got %q", got)
+		}
+
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"_parent": map[string]interface{}{"id": "test-schedule-id", "name": "Primary"},
+			"onCallParticipants": []interface{}{
+				map[string]interface{}{"type": "user", "id": "user-1", "name": "jane@example.com"},
+				map[string]interface{}{
+					"type": "escalation",
+					"id":   "escalation-1",
+					"name": "Fallback",
+					"onCallParticipants": []interface{}{
+						map[string]interface{}{"type": "user", "id": "user-2", "name": "john@example.com"},
+					},
+				},
+			},
+		}})
 	}))
 	defer srv.Close()
 
-	// The OpsGenie SDK uses HTTP (not HTTPS) when the apiUrl doesn't contain "api".
-	// Stripping the scheme gives us a host:port that satisfies that condition.
-	host := strings.TrimPrefix(srv.URL, "http://")
+	config := newActionTestConnector(srv).config
+	b := newTestOpsgenieBackend(t, config)
+	builder := scheduleBuilder(config, nil, b, newSyncCache(b), false)
 
-	config := &ogClient.Config{
-		ApiKey:         "test-key",
-		OpsGenieAPIURL: ogClient.ApiUrl(host),
-		RetryCount:     1,
+	rv, _, err := builder.getCurrentOnCall(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		scheduleActionResourceIDArg: resourceIDValue(resourceTypeSchedule.Id, "test-schedule-id"),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
 	}
 
-	builder := scheduleBuilder(config)
+	if got := rv.Fields["schedule_name"].GetStringValue(); got != "Primary" {
+		t.Errorf("expected schedule name Primary, got %q", got)
+	}
 
-	resource, err := scheduleResource(&ogSchedule.Schedule{
-		Id:   "test-schedule-id",
-		Name: scheduleName,
-	})
+	participants := rv.Fields["on_call_participants"].GetListValue().GetValues()
+	if len(participants) != 3 {
+		t.Fatalf("expected 3 participants including nested ones, got %d", len(participants))
+	}
+
+	if got := participants[2].GetStringValue(); got != "john@example.com" {
+		t.Errorf("expected nested participant john@example.com, got %q", got)
+	}
+}
+
+func TestScheduleGetNextOnCallAction(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/schedules/test-schedule-id/next-on-calls" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if got := r.URL.Query().Get("date"); got != "2026-03-01T09:00:00.000Z" {
+			t.Errorf("expected date 2026-03-01T09:00:00.000Z, got %q", got)
+		}
+
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"_parent": map[string]interface{}{"id": "test-schedule-id", "name": "Primary"},
+			"nextOnCallRecipients": []interface{}{
+				map[string]interface{}{"type": "user", "id": "user-1", "name": "jane@example.com"},
+				map[string]interface{}{"type": "team", "id": "team-1", "name": "sre"},
+			},
+			"exactNextOnCallRecipients": []interface{}{
+				map[string]interface{}{"type": "user", "id": "user-1", "name": "jane@example.com"},
+			},
+		}})
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	b := newTestOpsgenieBackend(t, config)
+	builder := scheduleBuilder(config, nil, b, newSyncCache(b), false)
+
+	rv, _, err := builder.getNextOnCall(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		scheduleActionResourceIDArg: resourceIDValue(resourceTypeSchedule.Id, "test-schedule-id"),
+		"date":                      structpb.NewStringValue("2026-03-01T09:00:00Z"),
+	}})
 	if err != nil {
-		t.Fatalf("failed to build schedule resource: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
 
-	_, _, _, err = builder.Grants(context.Background(), resource, nil)
-	if err == nil {
-		t.Fatal("expected error, got nil")
+	if got := rv.Fields["schedule_name"].GetStringValue(); got != "Primary" {
+		t.Errorf("expected schedule name Primary, got %q", got)
 	}
 
-	if got := status.Code(err); got != codes.NotFound {
-		t.Errorf("expected codes.NotFound, got %v (err: %v)", got, err)
+	for field, expected := range map[string][]interface{}{
+		"next_on_call_recipients":       {"jane@example.com", "sre"},
+		"exact_next_on_call_recipients": {"jane@example.com"},
+	} {
+		if got := rv.Fields[field].GetListValue().AsSlice(); !reflect.DeepEqual(got, expected) {
+			t.Errorf("expected %s to be %v, got %v", field, expected, got)
+		}
+	}
+}
+
+func TestScheduleExportOnCallCalendarAction(t *testing.T) {
+	const ics = "BEGIN:VCALENDAR\nEND:VCALENDAR\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/schedules/test-schedule-id/on-calls":
+			if got := r.URL.Query().Get("flat"); got != "true" {
+				t.Errorf("expected flat on-call request, got flat=%q", got)
+			}
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"onCallRecipients": []string{"jane@example.com"},
+			}})
+		case "/v2/schedules/on-calls/jane@example.com.ics":
+			w.Header().Set("Content-Type", "text/calendar")
+			_, _ = w.Write([]byte(ics))
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	b := newTestOpsgenieBackend(t, config)
+	builder := scheduleBuilder(config, nil, b, newSyncCache(b), false)
+
+	rv, _, err := builder.exportOnCallCalendar(context.Background(), &structpb.Struct{Fields: map[string]*structpb.Value{
+		scheduleActionResourceIDArg: resourceIDValue(resourceTypeSchedule.Id, "test-schedule-id"),
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	calendars := rv.Fields["calendars"].GetStructValue().AsMap()
+	if !reflect.DeepEqual(calendars, map[string]interface{}{"jane@example.com": ics}) {
+		t.Errorf("unexpected calendars %v", calendars)
+	}
+}
+
+func TestScheduleResource_ParentedToOwnerTeam(t *testing.T) {
+	sr, err := scheduleResource(&ogSchedule.Schedule{
+		Id:        "schedule-1",
+		Name:      "primary",
+		OwnerTeam: &og.OwnerTeam{Id: "team-1", Name: "sre"},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if sr.GetParentResourceId().GetResourceType() != resourceTypeTeam.Id || sr.GetParentResourceId().GetResource() != "team-1" {
+		t.Errorf("expected schedule to be parented to team-1, got %v", sr.GetParentResourceId())
+	}
+
+	orphan, err := scheduleResource(&ogSchedule.Schedule{Id: "schedule-2", Name: "orphan"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if orphan.GetParentResourceId() != nil {
+		t.Errorf("expected schedule without owner team to have no parent, got %v", orphan.GetParentResourceId())
+	}
+}
+
+func TestScheduleGrant_ReassignsOwner(t *testing.T) {
+	var update map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/schedules/schedule-1":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{
+					"id":        "schedule-1",
+					"name":      "primary",
+					"ownerTeam": map[string]interface{}{"id": "team-1", "name": "sre"},
+				},
+			})
+		case r.Method == http.MethodPatch && r.URL.Path == "/v2/schedules/schedule-1":
+			update = decodeBody(t, r)
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{"id": "schedule-1", "name": "primary"},
+			})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	b := newTestOpsgenieBackend(t, config)
+	s := scheduleBuilder(config, nil, b, newSyncCache(b), false)
+	sr, err := scheduleResource(&ogSchedule.Schedule{Id: "schedule-1", Name: "primary"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ents, _, err := s.Entitlements(context.Background(), sr, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var owner *v2.Entitlement
+	for _, e := range ents {
+		if e.GetSlug() == scheduleOwner {
+			owner = e
+		}
+	}
+	if owner == nil {
+		t.Fatalf("expected an owner entitlement")
+	}
+
+	team := &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: "team-2"}}
+	if _, err := s.Grant(context.Background(), team, owner); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if update["name"] != "primary" {
+		t.Errorf("expected the schedule name to be kept, got %v", update["name"])
+	}
+	if ownerTeam, _ := update["ownerTeam"].(map[string]interface{}); ownerTeam["id"] != "team-2" {
+		t.Errorf("expected owner team team-2, got %v", update["ownerTeam"])
+	}
+
+	// Granting to the current owner is a no-op.
+	update = nil
+	annos, err := s.Grant(context.Background(), &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: "team-1"}}, owner)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if update != nil || !annos.Contains(&v2.GrantAlreadyExists{}) {
+		t.Errorf("expected GrantAlreadyExists without an update, got %v", annos)
+	}
+
+	user := &v2.Resource{Id: &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "user-1"}}
+	if _, err := s.Grant(context.Background(), user, owner); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a user principal, got %v", err)
+	}
+
+	if _, err := s.Revoke(context.Background(), &v2.Grant{Entitlement: owner, Principal: team}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition on revoke, got %v", err)
+	}
+
+	// Other backends can't change the owner of a schedule.
+	eb := newExportBackend(t.TempDir())
+	exported := scheduleBuilder(config, nil, eb, newSyncCache(eb), false)
+	if _, err := exported.Grant(context.Background(), team, owner); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented without the opsgenie backend, got %v", err)
 	}
 }
@@ -0,0 +1,114 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	ogService "github.com/opsgenie/opsgenie-go-sdk-v2/service"
+)
+
+type serviceResourceType struct {
+	resourceType *v2.ResourceType
+	backend      *opsgenieBackend
+	filter       *resourceFilter
+}
+
+func (s *serviceResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return s.resourceType
+}
+
+// serviceResource creates a new connector resource for an OpsGenie service, parented to the team owning it.
+func serviceResource(service *ogService.Service) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"service_id":   service.Id,
+		"service_name": service.Name,
+		"description":  service.Description,
+		"visibility":   string(service.Visibility),
+		"team_id":      service.TeamId,
+	}
+
+	if len(service.Tags) > 0 {
+		profile["tags"] = scheduleParticipantsToInterfaceSlice(service.Tags)
+	}
+
+	opts := []rs.ResourceOption{
+		rs.WithResourceProfile(profile),
+		rs.WithDescription(service.Description),
+	}
+
+	if parentID := ownerTeamParentResourceID(service.TeamId); parentID != nil {
+		opts = append(opts, rs.WithParentResourceID(parentID))
+	}
+
+	resource, err := rs.NewResource(
+		service.Name,
+		resourceTypeService,
+		service.Id,
+		opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return resource, nil
+}
+
+func (s *serviceResourceType) List(ctx context.Context, parentID *v2.ResourceId, opts rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error) {
+	// Services are listed once at the top level, they carry their team as parent.
+	if parentID != nil {
+		return nil, nil, nil
+	}
+
+	bag, offset, err := parsePageToken(opts.PageToken.Token, &v2.ResourceId{ResourceType: s.resourceType.Id})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	services, err := s.backend.services.List(ctx, &ogService.ListRequest{
+		Limit:  ResourcesPageSize,
+		Offset: offset,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list services: %w", translateAPIError(s.backend.failures, err))
+	}
+
+	var rv []*v2.Resource
+	for _, service := range services.Services {
+		serviceCopy := service
+		if serviceCopy.TeamId, err = s.filter.ownerTeamID(ctx, serviceCopy.TeamId); err != nil {
+			return nil, nil, err
+		}
+
+		sr, err := serviceResource(&serviceCopy)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		rv = append(rv, sr)
+	}
+
+	nextPage, err := handleNextPage(bag, services.Paging.Next)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rv, &rs.SyncOpResults{NextPageToken: nextPage}, nil
+}
+
+func (s *serviceResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Entitlement, *rs.SyncOpResults, error) {
+	return nil, nil, nil
+}
+
+func (s *serviceResourceType) Grants(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error) {
+	return nil, nil, nil
+}
+
+func serviceBuilder(b *opsgenieBackend, filter *resourceFilter) *serviceResourceType {
+	return &serviceResourceType{
+		resourceType: resourceTypeService,
+		backend:      b,
+		filter:       filter,
+	}
+}
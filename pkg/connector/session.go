@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"context"
+
+	"github.com/conductorone/baton-sdk/pkg/session"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sdk/pkg/types/sessions"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Lookups shared between resource syncers through the SDK session store. The store lives as long as
+// the sync, so the maps survive the connector being restarted between syncers. Callers skip the store
+// when there is none, and fall back to the per-sync cache when it fails.
+const (
+	userRolesSessionKey      = "user-roles"
+	teamMembersSessionPrefix = "team-members"
+)
+
+// session returns the session store of a sync operation, or nil when the connector runs without one.
+func (c *syncCache) session(opts rs.SyncOpAttrs) sessions.SessionStore {
+	if !c.sessionStore {
+		return nil
+	}
+
+	return opts.Session
+}
+
+// loadUserRoles returns the role name of every user, keyed by user ID.
+func loadUserRoles(ctx context.Context, ss sessions.SessionStore) (map[string]string, bool) {
+	roles, found, err := session.GetJSON[map[string]string](ctx, ss, userRolesSessionKey)
+	if err != nil {
+		ctxzap.Extract(ctx).Debug("opsgenie-connector: failed to load user roles from session store", zap.Error(err))
+		return nil, false
+	}
+
+	return roles, found
+}
+
+func storeUserRoles(ctx context.Context, ss sessions.SessionStore, roles map[string]string) {
+	if err := session.SetJSON(ctx, ss, userRolesSessionKey, roles); err != nil {
+		ctxzap.Extract(ctx).Debug("opsgenie-connector: failed to store user roles in session store", zap.Error(err))
+	}
+}
+
+// loadTeamMembers returns the user IDs of the members of a team.
+func loadTeamMembers(ctx context.Context, ss sessions.SessionStore, teamID string) ([]string, bool) {
+	members, found, err := session.GetJSON[[]string](ctx, ss, teamID, sessions.WithPrefix(teamMembersSessionPrefix))
+	if err != nil {
+		ctxzap.Extract(ctx).Debug("opsgenie-connector: failed to load team members from session store", zap.String("team_id", teamID), zap.Error(err))
+		return nil, false
+	}
+
+	return members, found
+}
+
+// storeTeamMembers saves the user IDs of the members of each team, keyed by team ID.
+func storeTeamMembers(ctx context.Context, ss sessions.SessionStore, members map[string][]string) {
+	if len(members) == 0 {
+		return
+	}
+
+	if err := session.SetManyJSON(ctx, ss, members, sessions.WithPrefix(teamMembersSessionPrefix)); err != nil {
+		ctxzap.Extract(ctx).Debug("opsgenie-connector: failed to store team members in session store", zap.Error(err))
+	}
+}
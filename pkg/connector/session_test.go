@@ -0,0 +1,204 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/conductorone/baton-sdk/pkg/connectorbuilder"
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/conductorone/baton-sdk/pkg/types/sessions"
+)
+
+// memorySessionStore is a minimal session store keeping values in a map, namespaced by sync ID and prefix.
+type memorySessionStore struct {
+	mtx    sync.Mutex
+	values map[string][]byte
+}
+
+func newMemorySessionStore() *memorySessionStore {
+	return &memorySessionStore{values: make(map[string][]byte)}
+}
+
+func (m *memorySessionStore) key(ctx context.Context, key string, opt []sessions.SessionStoreOption) string {
+	bag := &sessions.SessionStoreBag{}
+	for _, o := range opt {
+		_ = o(ctx, bag)
+	}
+	return bag.SyncID + "/" + bag.Prefix + "/" + key
+}
+
+func (m *memorySessionStore) Get(ctx context.Context, key string, opt ...sessions.SessionStoreOption) ([]byte, bool, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	v, ok := m.values[m.key(ctx, key, opt)]
+	return v, ok, nil
+}
+
+func (m *memorySessionStore) GetMany(ctx context.Context, keys []string, opt ...sessions.SessionStoreOption) (map[string][]byte, []string, error) {
+	rv := make(map[string][]byte)
+	for _, k := range keys {
+		if v, ok, _ := m.Get(ctx, k, opt...); ok {
+			rv[k] = v
+		}
+	}
+	return rv, nil, nil
+}
+
+func (m *memorySessionStore) Set(ctx context.Context, key string, value []byte, opt ...sessions.SessionStoreOption) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.values[m.key(ctx, key, opt)] = value
+	return nil
+}
+
+func (m *memorySessionStore) SetMany(ctx context.Context, values map[string][]byte, opt ...sessions.SessionStoreOption) error {
+	for k, v := range values {
+		_ = m.Set(ctx, k, v, opt...)
+	}
+	return nil
+}
+
+func (m *memorySessionStore) Delete(ctx context.Context, key string, opt ...sessions.SessionStoreOption) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	delete(m.values, m.key(ctx, key, opt))
+	return nil
+}
+
+func (m *memorySessionStore) Clear(_ context.Context, _ ...sessions.SessionStoreOption) error {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.values = make(map[string][]byte)
+	return nil
+}
+
+func (m *memorySessionStore) GetAll(_ context.Context, _ string, _ ...sessions.SessionStoreOption) (map[string][]byte, string, error) {
+	return nil, "", nil
+}
+
+// newSessionSyncCache returns a sync cache for a connector that runs with a session store.
+func newSessionSyncCache(b backend) *syncCache {
+	c := newSyncCache(b)
+	c.sessionStore = true
+	return c
+}
+
+func TestTeamGrants_ReuseSessionMembers(t *testing.T) {
+	srv := newTeamsTenant(t, 10)
+	config := srv.Config()
+	opts := res.SyncOpAttrs{Session: connectorbuilder.WithSyncId(newMemorySessionStore(), "sync-1")}
+	ctx := context.Background()
+
+	ob := newTestOpsgenieBackend(t, config)
+	teams, _, err := teamBuilder(ob, newSessionSyncCache(ob)).List(ctx, nil, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// A fresh cache stands in for a connector process that didn't list the teams itself.
+	listed := teamGets(srv)
+	b := teamBuilder(ob, newSessionSyncCache(ob))
+	for _, team := range teams {
+		grants, _, err := b.Grants(ctx, team, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(grants) != 1 || grants[0].GetPrincipal().GetId().GetResource() != "user-"+team.GetId().GetResource() {
+			t.Errorf("unexpected grants for %s: %v", team.GetId().GetResource(), grants)
+		}
+	}
+
+	if got := teamGets(srv) - listed; got != 0 {
+		t.Errorf("expected team members to come from the session store, got %d team requests", got)
+	}
+}
+
+func TestRoleGrants_ReuseSessionRoles(t *testing.T) {
+	var userLists atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userLists.Add(1)
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"id": "user-1", "username": "a@example.com", "role": map[string]interface{}{"id": "Admin", "name": "Admin"}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	opts := res.SyncOpAttrs{Session: connectorbuilder.WithSyncId(newMemorySessionStore(), "sync-1")}
+	ctx := context.Background()
+
+	admin, err := roleResource(ctx, "Admin", defaultRoles["Admin"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Each builder gets its own cache, so only the session store can spare the second listing.
+	b := newTestOpsgenieBackend(t, config)
+	for i := 0; i < 2; i++ {
+		grants, _, err := roleBuilder(b, newSessionSyncCache(b)).Grants(ctx, admin, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(grants) != 1 {
+			t.Errorf("expected one grant, got %v", grants)
+		}
+	}
+
+	if userLists.Load() != 1 {
+		t.Errorf("expected users to be listed once, got %d requests", userLists.Load())
+	}
+}
+
+func TestRoleGrants_WithoutSessionStore(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"id": "user-1", "username": "a@example.com", "role": map[string]interface{}{"id": "Admin", "name": "Admin"}},
+			},
+		})
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	ctx := context.Background()
+
+	admin, err := roleResource(ctx, "Admin", defaultRoles["Admin"])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The SDK wraps the configured store with the sync ID even when there is none.
+	opts := res.SyncOpAttrs{Session: connectorbuilder.WithSyncId(nil, "sync-1")}
+	b := newTestOpsgenieBackend(t, config)
+	grants, _, err := roleBuilder(b, newSyncCache(b)).Grants(ctx, admin, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(grants) != 1 {
+		t.Errorf("expected one grant, got %v", grants)
+	}
+}
+
+func TestSetSessionStore(t *testing.T) {
+	first := &Opsgenie{cache: newSyncCache(nil)}
+	second := &Opsgenie{cache: newSyncCache(nil)}
+	c := newAccountsConnector([]*opsgenieAccount{{name: "eu", conn: first}, {name: "us", conn: second}})
+
+	ss := connectorbuilder.WithSyncId(newMemorySessionStore(), "sync-1")
+	if first.cache.session(res.SyncOpAttrs{Session: ss}) != nil {
+		t.Error("expected no session store before one is set")
+	}
+
+	c.SetSessionStore(context.Background(), newMemorySessionStore())
+	for _, conn := range []*Opsgenie{c, first, second} {
+		if conn.cache.session(res.SyncOpAttrs{Session: ss}) != ss {
+			t.Error("expected every account to use the session store of the sync")
+		}
+	}
+}
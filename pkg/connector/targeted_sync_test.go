@@ -0,0 +1,79 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestTargetedGet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/users/user-1":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{
+					"id":       "user-1",
+					"username": "jane@example.com",
+					"fullName": "Jane Doe",
+					"role":     map[string]interface{}{"id": "User", "name": "User"},
+				},
+			})
+		case "/v2/teams/team-1":
+			if it := r.URL.Query().Get("identifierType"); it != "id" {
+				t.Errorf("expected identifierType id, got %q", it)
+			}
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{"id": "team-1", "name": "platform"},
+			})
+		case "/v2/schedules/schedule-1":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": map[string]interface{}{
+					"id":        "schedule-1",
+					"name":      "primary",
+					"ownerTeam": map[string]interface{}{"id": "team-1", "name": "platform"},
+				},
+			})
+		default:
+			writeOpsgenieJSON(t, w, http.StatusNotFound, map[string]interface{}{"message": "Not found"})
+		}
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	b := newTestOpsgenieBackend(t, config)
+	ctx := context.Background()
+
+	u, _, err := userBuilder(config, nil, b, nil, "", false).Get(ctx, &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "user-1"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error getting user: %v", err)
+	}
+	if u.GetId().GetResource() != "user-1" || u.GetDisplayName() != "Jane Doe" {
+		t.Errorf("unexpected user %v", u)
+	}
+
+	tm, _, err := teamBuilder(b, newSyncCache(b)).Get(ctx, &v2.ResourceId{ResourceType: resourceTypeTeam.Id, Resource: "team-1"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error getting team: %v", err)
+	}
+	if tm.GetId().GetResource() != "team-1" || tm.GetDisplayName() != "platform" {
+		t.Errorf("unexpected team %v", tm)
+	}
+
+	s, _, err := scheduleBuilder(config, nil, b, newSyncCache(b), false).Get(ctx, &v2.ResourceId{ResourceType: resourceTypeSchedule.Id, Resource: "schedule-1"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error getting schedule: %v", err)
+	}
+	if s.GetId().GetResource() != "schedule-1" || s.GetParentResourceId().GetResource() != "team-1" {
+		t.Errorf("unexpected schedule %v", s)
+	}
+
+	_, _, err = userBuilder(config, nil, b, nil, "", false).Get(ctx, &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "missing"}, nil)
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
@@ -6,12 +6,12 @@ import (
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
-	"github.com/conductorone/baton-sdk/pkg/pagination"
 	ent "github.com/conductorone/baton-sdk/pkg/types/entitlement"
 	grant "github.com/conductorone/baton-sdk/pkg/types/grant"
 	res "github.com/conductorone/baton-sdk/pkg/types/resource"
-	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
 	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	"go.uber.org/zap"
 )
 
 const (
@@ -21,7 +21,8 @@ const (
 
 type teamResourceType struct {
 	resourceType *v2.ResourceType
-	config       *ogclient.Config
+	backend      backend
+	cache        *syncCache
 }
 
 func (o *teamResourceType) ResourceType(_ context.Context) *v2.ResourceType {
@@ -43,6 +44,12 @@ func teamResource(ctx context.Context, team oteam.ListedTeams) (*v2.Resource, er
 		team.Id,
 		groupTraitOptions,
 		res.WithResourceProfile(profile),
+		res.WithAnnotation(
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeSchedule.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeEscalation.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeService.Id},
+			&v2.ChildResourceType{ResourceTypeId: resourceTypeHeartbeat.Id},
+		),
 	)
 	if err != nil {
 		return nil, err
@@ -51,31 +58,62 @@ func teamResource(ctx context.Context, team oteam.ListedTeams) (*v2.Resource, er
 	return resource, nil
 }
 
-func (o *teamResourceType) List(ctx context.Context, resourceId *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	teamClient, err := oteam.NewClient(o.config)
+func (o *teamResourceType) List(ctx context.Context, _ *v2.ResourceId, opts res.SyncOpAttrs) ([]*v2.Resource, *res.SyncOpResults, error) {
+	teams, err := o.backend.ListTeams(ctx)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, nil, err
 	}
 
-	teams, err := teamClient.List(ctx, &oteam.ListTeamRequest{BaseRequest: ogclient.BaseRequest{}})
-	if err != nil {
-		return nil, "", nil, err
+	// Without a sync ID, teams being listed before any grants of a sync is what marks a new sync.
+	if opts.SyncID == "" {
+		o.cache.Reset()
 	}
+	o.cache.scope(opts)
 
 	rv := make([]*v2.Resource, 0)
-	for _, t := range teams.Teams {
+	teamIDs := make([]string, 0, len(teams))
+	for _, t := range teams {
 		tr, err := teamResource(ctx, t)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, nil, err
 		}
 
 		rv = append(rv, tr)
+		teamIDs = append(teamIDs, t.Id)
+	}
+
+	o.cache.SetTeamIDs(teamIDs)
+
+	// Team members are needed for the grants of every team, fetch them up front in parallel.
+	// Teams that failed to prefetch are fetched again when their grants are listed.
+	if err := o.cache.PrefetchTeams(ctx, teamIDs); err != nil {
+		ctxzap.Extract(ctx).Warn("opsgenie-connector: failed to prefetch team details", zap.Error(err))
+	}
+
+	// Share the members with the syncers that run later, possibly in another connector process.
+	if ss := o.cache.session(opts); ss != nil {
+		storeTeamMembers(ctx, ss, o.cache.TeamMembers())
 	}
 
-	return rv, "", nil, nil
+	return rv, &res.SyncOpResults{}, nil
 }
 
-func (o *teamResourceType) Entitlements(ctx context.Context, resource *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
+// Get fetches a single team by ID for targeted syncs.
+func (o *teamResourceType) Get(ctx context.Context, resourceID *v2.ResourceId, _ *v2.ResourceId) (*v2.Resource, annotations.Annotations, error) {
+	t, err := o.backend.GetTeam(ctx, resourceID.Resource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get team %s: %w", resourceID.Resource, err)
+	}
+
+	tr, err := teamResource(ctx, oteam.ListedTeams{TeamMeta: t.TeamMeta, Description: t.Description})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return tr, nil, nil
+}
+
+func (o *teamResourceType) Entitlements(_ context.Context, resource *v2.Resource, _ res.SyncOpAttrs) ([]*v2.Entitlement, *res.SyncOpResults, error) {
 	var rv []*v2.Entitlement
 
 	assignmentOptions := []ent.EntitlementOption{
@@ -90,44 +128,46 @@ func (o *teamResourceType) Entitlements(ctx context.Context, resource *v2.Resour
 		assignmentOptions...,
 	))
 
-	return rv, "", nil, nil
+	return rv, &res.SyncOpResults{}, nil
 }
 
-func (o *teamResourceType) Grants(ctx context.Context, resource *v2.Resource, pt *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	var rv []*v2.Grant
-	teamClient, err := oteam.NewClient(o.config)
-	if err != nil {
-		return nil, "", nil, err
-	}
+func (o *teamResourceType) Grants(ctx context.Context, resource *v2.Resource, opts res.SyncOpAttrs) ([]*v2.Grant, *res.SyncOpResults, error) {
+	o.cache.scope(opts)
 
-	getTeamRequest := &oteam.GetTeamRequest{
-		BaseRequest:     ogclient.BaseRequest{},
-		IdentifierValue: resource.Id.Resource,
-		IdentifierType:  oteam.Identifier(idIdentifierType),
+	var (
+		members []string
+		ok      bool
+	)
+	if ss := o.cache.session(opts); ss != nil {
+		members, ok = loadTeamMembers(ctx, ss, resource.Id.Resource)
 	}
-
-	t, err := teamClient.Get(ctx, getTeamRequest)
-	if err != nil {
-		return nil, "", nil, err
+	if !ok {
+		t, err := o.cache.Team(ctx, resource.Id.Resource)
+		if err != nil {
+			return nil, nil, err
+		}
+		members = teamMemberIDs(t)
 	}
 
-	for _, member := range t.Members {
+	var rv []*v2.Grant
+	for _, userID := range members {
 		rv = append(rv, grant.NewGrant(
 			resource,
 			teamMemberEntitlement,
 			&v2.ResourceId{
 				ResourceType: resourceTypeUser.Id,
-				Resource:     member.User.ID,
+				Resource:     userID,
 			},
 		))
 	}
 
-	return rv, "", nil, nil
+	return rv, &res.SyncOpResults{}, nil
 }
 
-func teamBuilder(config *ogclient.Config) *teamResourceType {
+func teamBuilder(b backend, cache *syncCache) *teamResourceType {
 	return &teamResourceType{
 		resourceType: resourceTypeTeam,
-		config:       config,
+		backend:      b,
+		cache:        cache,
 	}
 }
@@ -0,0 +1,196 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/metrics"
+	"github.com/conductorone/baton-sdk/pkg/ratelimit"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Every request the connector sends to Opsgenie produces a span and metrics, named by the endpoint
+// template so that requests to the same endpoint add up. The SDK retries rate limited and failed
+// requests without telling the caller, and doesn't pass the caller's context to the HTTP request,
+// so each attempt gets its own span and retries are recognized by the transport.
+
+const (
+	telemetryName = "baton-opsgenie"
+
+	metricAPICalls            = "baton_opsgenie.api_calls"
+	metricAPILatency          = "baton_opsgenie.api_latency"
+	metricAPIRetries          = "baton_opsgenie.api_retries"
+	metricAPIRateLimited      = "baton_opsgenie.api_rate_limited"
+	metricSDKRetriesExhausted = "baton_opsgenie.sdk_retries_exhausted"
+)
+
+// telemetryTransport traces and measures every attempt of an API request.
+type telemetryTransport struct {
+	next       http.RoundTripper
+	tracer     trace.Tracer
+	maxRetries int
+
+	calls       metrics.Int64Counter
+	latency     metrics.Int64Histogram
+	retries     metrics.Int64Counter
+	rateLimited metrics.Int64Counter
+
+	mu sync.Mutex
+	// failures counts the consecutive failed attempts the SDK retries, by method and URL.
+	failures map[string]int
+}
+
+func newTelemetryTransport(next http.RoundTripper, tp trace.TracerProvider, h metrics.Handler, maxRetries int) *telemetryTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &telemetryTransport{
+		next:        next,
+		tracer:      tp.Tracer(telemetryName),
+		maxRetries:  maxRetries,
+		calls:       h.Int64Counter(metricAPICalls, "Opsgenie API requests, by endpoint and status", metrics.Dimensionless),
+		latency:     h.Int64Histogram(metricAPILatency, "Latency of Opsgenie API requests, by endpoint", metrics.Milliseconds),
+		retries:     h.Int64Counter(metricAPIRetries, "Opsgenie API requests retried by the SDK, by endpoint", metrics.Dimensionless),
+		rateLimited: h.Int64Counter(metricAPIRateLimited, "Opsgenie API requests rate limited with a 429, by endpoint", metrics.Dimensionless),
+		failures:    make(map[string]int),
+	}
+}
+
+// resendCount returns how many times the SDK already sent a request. An attempt following failed
+// attempts the SDK retries is a resend, unless more attempts failed than the SDK makes.
+func (t *telemetryTransport) resendCount(key string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := t.failures[key]
+	if n > t.maxRetries {
+		delete(t.failures, key)
+		return 0
+	}
+
+	return n
+}
+
+func (t *telemetryTransport) recordOutcome(key string, resp *http.Response, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if isRetriedOutcome(resp, err) {
+		t.failures[key]++
+	} else {
+		delete(t.failures, key)
+	}
+}
+
+// isRetriedOutcome reports whether the SDK retries an attempt, following its default retry policy.
+func isRetriedOutcome(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	return resp.StatusCode == 0 || resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented)
+}
+
+func (t *telemetryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	endpoint := endpointTemplate(req.Method, req.URL.Path)
+	key := req.Method + " " + req.URL.String()
+	resendCount := t.resendCount(key)
+
+	ctx, span := t.tracer.Start(req.Context(), endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("http.request.method", req.Method),
+			attribute.String("url.template", endpoint),
+			attribute.String("server.address", req.URL.Hostname()),
+			attribute.Int("http.request.resend_count", resendCount),
+		),
+	)
+	defer span.End()
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	elapsed := time.Since(start)
+	t.recordOutcome(key, resp, err)
+
+	tags := map[string]string{"endpoint": endpoint}
+	bg := context.Background()
+	t.latency.Record(bg, elapsed.Milliseconds(), tags)
+	if resendCount > 0 {
+		t.retries.Add(bg, 1, tags)
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, err.Error())
+		t.calls.Add(bg, 1, map[string]string{"endpoint": endpoint, "status": "error"})
+		return resp, err
+	}
+
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if requestID := resp.Header.Get("X-Request-Id"); requestID != "" {
+		span.SetAttributes(attribute.String("opsgenie.request_id", requestID))
+	}
+	if state := resp.Header.Get("X-RateLimit-State"); state != "" {
+		span.SetAttributes(attribute.String("opsgenie.rate_limit.state", state))
+	}
+	if remaining, ok := rateLimitRemaining(resp); ok {
+		span.SetAttributes(attribute.Int64("opsgenie.rate_limit.remaining", remaining))
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		span.SetStatus(otelcodes.Error, resp.Status)
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.rateLimited.Add(bg, 1, tags)
+	}
+	t.calls.Add(bg, 1, map[string]string{"endpoint": endpoint, "status": strconv.Itoa(resp.StatusCode)})
+
+	return resp, nil
+}
+
+// rateLimitRemaining returns the requests left in the rate limit window, when the response says.
+// Rate limited responses have none left.
+func rateLimitRemaining(resp *http.Response) (int64, bool) {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return 0, true
+	}
+
+	description, err := ratelimit.ExtractRateLimitData(resp.StatusCode, &resp.Header)
+	if err != nil || description == nil || description.GetRemaining() == 0 {
+		return 0, false
+	}
+
+	return description.GetRemaining(), true
+}
+
+// sdkTelemetryHook measures what the Opsgenie SDK only reports in its logs, next to the hook that
+// forwards them to zap: requests that still failed after every retry.
+type sdkTelemetryHook struct {
+	retriesExhausted metrics.Int64Counter
+}
+
+func newSDKTelemetryHook(h metrics.Handler) *sdkTelemetryHook {
+	return &sdkTelemetryHook{
+		retriesExhausted: h.Int64Counter(metricSDKRetriesExhausted, "Opsgenie API requests that failed after every SDK retry", metrics.Dimensionless),
+	}
+}
+
+func (h *sdkTelemetryHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.ErrorLevel}
+}
+
+func (h *sdkTelemetryHook) Fire(entry *logrus.Entry) error {
+	if strings.HasPrefix(entry.Message, "Failed to process request after") {
+		h.retriesExhausted.Add(context.Background(), 1, nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,203 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/metrics"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// recordedMetrics is a metrics handler keeping the sum of every counter and the number of
+// histogram records, by name and endpoint.
+type recordedMetrics struct {
+	mu     sync.Mutex
+	values map[string]int64
+}
+
+func newRecordedMetrics() *recordedMetrics {
+	return &recordedMetrics{values: make(map[string]int64)}
+}
+
+func (m *recordedMetrics) add(name string, value int64, tags map[string]string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.values[name+" "+tags["endpoint"]] += value
+}
+
+func (m *recordedMetrics) get(name, endpoint string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.values[name+" "+endpoint]
+}
+
+type recordedInstrument struct {
+	m    *recordedMetrics
+	name string
+}
+
+func (i *recordedInstrument) Add(_ context.Context, value int64, tags map[string]string) {
+	i.m.add(i.name, value, tags)
+}
+
+func (i *recordedInstrument) Record(_ context.Context, _ int64, tags map[string]string) {
+	i.m.add(i.name, 1, tags)
+}
+
+func (i *recordedInstrument) Observe(_ context.Context, value int64, tags map[string]string) {
+	i.m.add(i.name, value, tags)
+}
+
+func (m *recordedMetrics) Int64Counter(name string, _ string, _ metrics.Unit) metrics.Int64Counter {
+	return &recordedInstrument{m: m, name: name}
+}
+
+func (m *recordedMetrics) Int64Gauge(name string, _ string, _ metrics.Unit) metrics.Int64Gauge {
+	return &recordedInstrument{m: m, name: name}
+}
+
+func (m *recordedMetrics) Int64Histogram(name string, _ string, _ metrics.Unit) metrics.Int64Histogram {
+	return &recordedInstrument{m: m, name: name}
+}
+
+func (m *recordedMetrics) WithTags(_ map[string]string) metrics.Handler {
+	return m
+}
+
+// recordedSpans keeps the spans that ended.
+type recordedSpans struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+func (r *recordedSpans) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+func (r *recordedSpans) OnEnd(s sdktrace.ReadOnlySpan) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *recordedSpans) Shutdown(context.Context) error   { return nil }
+func (r *recordedSpans) ForceFlush(context.Context) error { return nil }
+
+func spanAttribute(s sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+
+	return attribute.Value{}, false
+}
+
+func TestTelemetryTransport(t *testing.T) {
+	// The team list is rate limited once, then served.
+	var mu sync.Mutex
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+
+		if first {
+			w.Header().Set("X-RateLimit-State", "THROTTLED")
+			writeOpsgenieJSON(t, w, http.StatusTooManyRequests, map[string]interface{}{"message": "rate limited"})
+			return
+		}
+
+		w.Header().Set("X-RateLimit-Remaining", "41")
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": []interface{}{
+			map[string]interface{}{"id": "team-1", "name": "sre"},
+		}})
+	}))
+	defer srv.Close()
+
+	spans := &recordedSpans{}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	m := newRecordedMetrics()
+
+	logger := logrus.New()
+	logger.Hooks.Add(newSDKTelemetryHook(m))
+
+	config := newActionTestConnector(srv).config
+	config.HttpClient = &http.Client{Transport: newTelemetryTransport(nil, tp, m, config.RetryCount)}
+	config.Backoff = func(_, _ time.Duration, _ int, _ *http.Response) time.Duration { return 0 }
+	config.Logger = logger
+
+	client, err := oteam.NewClient(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.List(context.Background(), &oteam.ListTeamRequest{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(spans.spans) != 2 {
+		t.Fatalf("expected a span per attempt, got %d", len(spans.spans))
+	}
+	for i, expected := range []struct {
+		status    int64
+		resend    int64
+		remaining int64
+	}{
+		{status: http.StatusTooManyRequests, resend: 0, remaining: 0},
+		{status: http.StatusOK, resend: 1, remaining: 41},
+	} {
+		s := spans.spans[i]
+		if s.Name() != "GET /v2/teams" {
+			t.Errorf("unexpected span name %s", s.Name())
+		}
+		if v, _ := spanAttribute(s, "http.response.status_code"); v.AsInt64() != expected.status {
+			t.Errorf("expected status %d for attempt %d, got %v", expected.status, i, v.AsInt64())
+		}
+		if v, _ := spanAttribute(s, "http.request.resend_count"); v.AsInt64() != expected.resend {
+			t.Errorf("expected resend count %d for attempt %d, got %v", expected.resend, i, v.AsInt64())
+		}
+		if v, ok := spanAttribute(s, "opsgenie.rate_limit.remaining"); !ok || v.AsInt64() != expected.remaining {
+			t.Errorf("expected %d requests remaining for attempt %d, got %v", expected.remaining, i, v.AsInt64())
+		}
+	}
+
+	for name, expected := range map[string]int64{
+		metricAPICalls:       2,
+		metricAPILatency:     2,
+		metricAPIRetries:     1,
+		metricAPIRateLimited: 1,
+	} {
+		if got := m.get(name, "GET /v2/teams"); got != expected {
+			t.Errorf("expected %s to be %d, got %d", name, expected, got)
+		}
+	}
+	if got := m.get(metricSDKRetriesExhausted, ""); got != 0 {
+		t.Errorf("expected no exhausted retries, got %d", got)
+	}
+
+	// A request rate limited on every attempt is reported by the SDK log hook.
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeOpsgenieJSON(t, w, http.StatusTooManyRequests, map[string]interface{}{"message": "rate limited"})
+	}))
+	defer limited.Close()
+
+	config.OpsGenieAPIURL = newActionTestConnector(limited).config.OpsGenieAPIURL
+	client, err = oteam.NewClient(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := client.List(context.Background(), &oteam.ListTeamRequest{}); err == nil {
+		t.Fatal("expected the rate limited request to fail")
+	}
+	if got := m.get(metricSDKRetriesExhausted, ""); got != 1 {
+		t.Errorf("expected the exhausted retries to be counted, got %d", got)
+	}
+}
@@ -0,0 +1,383 @@
+package connector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"time"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	"github.com/conductorone/baton-sdk/pkg/annotations"
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	sdkTicket "github.com/conductorone/baton-sdk/pkg/types/ticket"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	ogAlert "github.com/opsgenie/opsgenie-go-sdk-v2/alert"
+	oteam "github.com/opsgenie/opsgenie-go-sdk-v2/team"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	ticketSchemaID = "opsgenie-alert"
+
+	ticketStatusOpen   = "open"
+	ticketStatusAcked  = "acked"
+	ticketStatusClosed = "closed"
+
+	ticketPriorityField   = "priority"
+	ticketRespondersField = "responders"
+
+	ticketAliasPrefix = "baton-"
+	ticketSource      = "baton-opsgenie"
+)
+
+var (
+	ticketPriorities = []string{
+		string(ogAlert.P1),
+		string(ogAlert.P2),
+		string(ogAlert.P3),
+		string(ogAlert.P4),
+		string(ogAlert.P5),
+	}
+
+	// opsgenieIDPattern matches the UUIDs Opsgenie uses as entity IDs.
+	opsgenieIDPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+	ticketStatuses = []*v2.TicketStatus{
+		{Id: ticketStatusOpen, DisplayName: "Open"},
+		{Id: ticketStatusAcked, DisplayName: "Acknowledged"},
+		{Id: ticketStatusClosed, DisplayName: "Closed"},
+	}
+)
+
+// newTicketAlias returns a unique alert alias used as the ticket ID. Alert creation in Opsgenie is
+// asynchronous, so the alias is the only identifier known when the ticket is returned.
+func newTicketAlias() (string, error) {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return ticketAliasPrefix + hex.EncodeToString(b), nil
+}
+
+// alertTicketStatus maps the state of an Opsgenie alert onto a ticket status.
+func alertTicketStatus(alertStatus string, acknowledged bool) *v2.TicketStatus {
+	switch {
+	case alertStatus == ticketStatusClosed:
+		return ticketStatuses[2]
+	case acknowledged:
+		return ticketStatuses[1]
+	default:
+		return ticketStatuses[0]
+	}
+}
+
+func (c *Opsgenie) ticketSchema(ctx context.Context) (*v2.TicketSchema, error) {
+	teamClient, err := oteam.NewClient(c.config)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := teamClient.List(ctx, &oteam.ListTeamRequest{})
+	if err != nil {
+		return nil, fmt.Errorf("opsgenie-connector: failed to list teams: %w", translateAPIError(c.failures, err))
+	}
+
+	var responders []*v2.TicketCustomFieldObjectValue
+	for _, t := range teams.Teams {
+		responders = append(responders, &v2.TicketCustomFieldObjectValue{
+			Id:          t.Id,
+			DisplayName: t.Name,
+		})
+	}
+
+	return &v2.TicketSchema{
+		Id:          ticketSchemaID,
+		DisplayName: "Opsgenie Alert",
+		Statuses:    ticketStatuses,
+		CustomFields: map[string]*v2.TicketCustomField{
+			ticketPriorityField:   sdkTicket.PickStringFieldSchema(ticketPriorityField, "Priority", false, ticketPriorities),
+			ticketRespondersField: sdkTicket.PickMultipleObjectValuesFieldSchema(ticketRespondersField, "Responders", false, responders),
+		},
+	}, nil
+}
+
+func (c *Opsgenie) ListTicketSchemas(ctx context.Context, _ *pagination.Token) ([]*v2.TicketSchema, string, annotations.Annotations, error) {
+	schema, err := c.ticketSchema(ctx)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	return []*v2.TicketSchema{schema}, "", nil, nil
+}
+
+func (c *Opsgenie) GetTicketSchema(ctx context.Context, schemaID string) (*v2.TicketSchema, annotations.Annotations, error) {
+	if schemaID != ticketSchemaID {
+		return nil, nil, status.Errorf(codes.NotFound, "opsgenie-connector: unknown ticket schema %s", schemaID)
+	}
+
+	schema, err := c.ticketSchema(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return schema, nil, nil
+}
+
+// ticketResponders routes the alert to the configured ticket team, the teams picked in the
+// responders field and the users assigned to the ticket.
+func (c *Opsgenie) ticketResponders(ticket *v2.Ticket) ([]ogAlert.Responder, error) {
+	responders := []ogAlert.Responder{}
+	seen := map[string]bool{}
+
+	addTeam := func(identifier string) {
+		if identifier == "" || seen[identifier] {
+			return
+		}
+		seen[identifier] = true
+		responders = append(responders, ogAlert.Responder{Type: ogAlert.TeamResponder, Id: identifier})
+	}
+
+	// The configured team may be given by name or by ID.
+	if c.ticketTeam != "" {
+		seen[c.ticketTeam] = true
+		if opsgenieIDPattern.MatchString(c.ticketTeam) {
+			responders = append(responders, ogAlert.Responder{Type: ogAlert.TeamResponder, Id: c.ticketTeam})
+		} else {
+			responders = append(responders, ogAlert.Responder{Type: ogAlert.TeamResponder, Name: c.ticketTeam})
+		}
+	}
+
+	if field, ok := ticket.GetCustomFields()[ticketRespondersField]; ok {
+		picked, err := sdkTicket.GetPickMultipleObjectValues(field)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: invalid responders: %s", err)
+		}
+		for _, p := range picked {
+			addTeam(p.GetId())
+		}
+	}
+
+	for _, assignee := range ticket.GetAssignees() {
+		if assignee.GetId().GetResourceType() != resourceTypeUser.Id {
+			continue
+		}
+
+		userID := assignee.GetId().GetResource()
+		// With several accounts, alerts are created in the first one, which only knows its own users.
+		if len(c.accounts) > 0 {
+			account, rawID, err := splitAccountScopedID(userID)
+			if err != nil {
+				return nil, err
+			}
+			if string(account) != c.accounts[0].name {
+				return nil, status.Errorf(codes.InvalidArgument, "opsgenie-connector: assignee %s belongs to account %s, tickets are filed in account %s",
+					userID, account, c.accounts[0].name)
+			}
+			userID = rawID
+		}
+		responders = append(responders, ogAlert.Responder{Type: ogAlert.UserResponder, Id: userID})
+	}
+
+	return responders, nil
+}
+
+// alertPriority returns the priority picked on the ticket, falling back to the configured default.
+func (c *Opsgenie) alertPriority(ticket *v2.Ticket) (ogAlert.Priority, error) {
+	priority := c.ticketPriority
+	if field, ok := ticket.GetCustomFields()[ticketPriorityField]; ok {
+		v, err := sdkTicket.GetPickStringValue(field)
+		if err != nil {
+			return "", status.Errorf(codes.InvalidArgument, "opsgenie-connector: invalid priority: %s", err)
+		}
+		if v != "" {
+			priority = v
+		}
+	}
+
+	if priority == "" {
+		return ogAlert.P3, nil
+	}
+
+	for _, p := range ticketPriorities {
+		if p == priority {
+			return ogAlert.Priority(priority), nil
+		}
+	}
+
+	return "", status.Errorf(codes.InvalidArgument, "opsgenie-connector: invalid priority %s", priority)
+}
+
+func (c *Opsgenie) CreateTicket(ctx context.Context, ticket *v2.Ticket, schema *v2.TicketSchema) (*v2.Ticket, annotations.Annotations, error) {
+	l := ctxzap.Extract(ctx)
+
+	if ticket.GetDisplayName() == "" {
+		return nil, nil, status.Error(codes.InvalidArgument, "opsgenie-connector: ticket display name is required")
+	}
+
+	priority, err := c.alertPriority(ticket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	responders, err := c.ticketResponders(ticket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	alias, err := newTicketAlias()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tags := append([]string{}, c.ticketTags...)
+	tags = append(tags, ticket.GetLabels()...)
+
+	details := map[string]string{}
+	if requestedFor := ticket.GetRequestedFor(); requestedFor != nil {
+		details["requested_for"] = requestedFor.GetDisplayName()
+		details["requested_for_id"] = requestedFor.GetId().GetResource()
+	}
+
+	alertClient, err := ogAlert.NewClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := alertClient.Create(ctx, &ogAlert.CreateAlertRequest{
+		Message:     ticket.GetDisplayName(),
+		Alias:       alias,
+		Description: ticket.GetDescription(),
+		Responders:  responders,
+		Tags:        tags,
+		Details:     details,
+		Source:      ticketSource,
+		Priority:    priority,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to create alert: %w", translateAPIError(c.failures, err))
+	}
+
+	l.Info("opsgenie-connector: created alert for ticket",
+		zap.String("alias", alias),
+		zap.String("priority", string(priority)),
+		zap.String("request_id", result.RequestId),
+	)
+
+	now := timestamppb.Now()
+	rv := &v2.Ticket{
+		Id:           alias,
+		DisplayName:  ticket.GetDisplayName(),
+		Description:  ticket.GetDescription(),
+		Assignees:    ticket.GetAssignees(),
+		Status:       ticketStatuses[0],
+		Labels:       tags,
+		CustomFields: ticket.GetCustomFields(),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+		RequestedFor: ticket.GetRequestedFor(),
+	}
+
+	return rv, nil, nil
+}
+
+// GetTicket looks up the alert created for a ticket. Alerts can only be fetched by alias while
+// they are open, so the alert is first searched by alias and then fetched by its ID.
+func (c *Opsgenie) GetTicket(ctx context.Context, ticketID string) (*v2.Ticket, annotations.Annotations, error) {
+	alertClient, err := ogAlert.NewClient(c.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	alerts, err := alertClient.List(ctx, &ogAlert.ListAlertRequest{
+		Limit: 1,
+		Query: fmt.Sprintf("alias=%s", ticketID),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list alerts: %w", translateAPIError(c.failures, err))
+	}
+
+	if len(alerts.Alerts) == 0 {
+		return nil, nil, status.Errorf(codes.NotFound, "opsgenie-connector: no alert found for ticket %s", ticketID)
+	}
+
+	a, err := alertClient.Get(ctx, &ogAlert.GetAlertRequest{
+		IdentifierType:  ogAlert.ALERTID,
+		IdentifierValue: alerts.Alerts[0].Id,
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get alert %s: %w", alerts.Alerts[0].Id, translateAPIError(c.failures, err))
+	}
+
+	rv := &v2.Ticket{
+		Id:          ticketID,
+		DisplayName: a.Message,
+		Description: a.Description,
+		Status:      alertTicketStatus(a.Status, a.Acknowledged),
+		Labels:      a.Tags,
+		CustomFields: map[string]*v2.TicketCustomField{
+			ticketPriorityField: sdkTicket.PickStringField(ticketPriorityField, string(a.Priority)),
+		},
+	}
+
+	if !a.CreatedAt.IsZero() {
+		rv.CreatedAt = timestamppb.New(a.CreatedAt)
+	}
+	if !a.UpdatedAt.IsZero() {
+		rv.UpdatedAt = timestamppb.New(a.UpdatedAt)
+	}
+	if a.Status == ticketStatusClosed && a.Report.CloseTime > 0 {
+		rv.CompletedAt = timestamppb.New(a.CreatedAt.Add(time.Duration(a.Report.CloseTime) * time.Millisecond))
+	}
+
+	return rv, nil, nil
+}
+
+func (c *Opsgenie) BulkCreateTickets(ctx context.Context, request *v2.TicketsServiceBulkCreateTicketsRequest) (*v2.TicketsServiceBulkCreateTicketsResponse, error) {
+	var rv []*v2.TicketsServiceCreateTicketResponse
+	for _, req := range request.GetTicketRequests() {
+		r := req.GetRequest()
+		ticket := &v2.Ticket{
+			DisplayName:  r.GetDisplayName(),
+			Description:  r.GetDescription(),
+			Status:       r.GetStatus(),
+			Labels:       r.GetLabels(),
+			CustomFields: r.GetCustomFields(),
+			RequestedFor: r.GetRequestedFor(),
+		}
+
+		resp := &v2.TicketsServiceCreateTicketResponse{}
+		created, annos, err := c.CreateTicket(ctx, ticket, req.GetSchema())
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Ticket = created
+			resp.Annotations = annos
+		}
+		rv = append(rv, resp)
+	}
+
+	return &v2.TicketsServiceBulkCreateTicketsResponse{Tickets: rv}, nil
+}
+
+func (c *Opsgenie) BulkGetTickets(ctx context.Context, request *v2.TicketsServiceBulkGetTicketsRequest) (*v2.TicketsServiceBulkGetTicketsResponse, error) {
+	var rv []*v2.TicketsServiceGetTicketResponse
+	for _, req := range request.GetTicketRequests() {
+		resp := &v2.TicketsServiceGetTicketResponse{}
+		ticket, annos, err := c.GetTicket(ctx, req.GetId())
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Ticket = ticket
+			resp.Annotations = annos
+		}
+		rv = append(rv, resp)
+	}
+
+	return &v2.TicketsServiceBulkGetTicketsResponse{Tickets: rv}, nil
+}
@@ -0,0 +1,166 @@
+package connector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	sdkTicket "github.com/conductorone/baton-sdk/pkg/types/ticket"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCreateTicket(t *testing.T) {
+	var created map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v2/alerts" {
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		created = decodeBody(t, r)
+		writeOpsgenieJSON(t, w, http.StatusAccepted, map[string]interface{}{"result": "Request will be processed"})
+	}))
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+	c.ticketTeam = "platform"
+	c.ticketPriority = "P3"
+	c.ticketTags = []string{"baton"}
+
+	ticket, _, err := c.CreateTicket(context.Background(), &v2.Ticket{
+		DisplayName: "Grant access to prod",
+		Description: "Approved access request",
+		Labels:      []string{"access-request"},
+		Assignees: []*v2.Resource{
+			{Id: &v2.ResourceId{ResourceType: resourceTypeUser.Id, Resource: "user-1"}},
+		},
+		CustomFields: map[string]*v2.TicketCustomField{
+			ticketPriorityField: sdkTicket.PickStringField(ticketPriorityField, "P2"),
+			ticketRespondersField: sdkTicket.PickMultipleObjectValuesField(ticketRespondersField, []*v2.TicketCustomFieldObjectValue{
+				{Id: "team-2", DisplayName: "sre"},
+			}),
+		},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.HasPrefix(ticket.GetId(), ticketAliasPrefix) {
+		t.Errorf("expected ticket ID to be an alias, got %q", ticket.GetId())
+	}
+	if ticket.GetStatus().GetId() != ticketStatusOpen {
+		t.Errorf("expected open ticket, got %q", ticket.GetStatus().GetId())
+	}
+
+	if created["alias"] != ticket.GetId() {
+		t.Errorf("expected alias %q, got %v", ticket.GetId(), created["alias"])
+	}
+	if created["priority"] != "P2" {
+		t.Errorf("expected priority P2, got %v", created["priority"])
+	}
+	if tags, _ := created["tags"].([]interface{}); len(tags) != 2 || tags[0] != "baton" || tags[1] != "access-request" {
+		t.Errorf("unexpected tags %v", created["tags"])
+	}
+
+	responders, _ := created["responders"].([]interface{})
+	if len(responders) != 3 {
+		t.Fatalf("expected 3 responders, got %v", created["responders"])
+	}
+	if r, _ := responders[0].(map[string]interface{}); r["name"] != "platform" || r["type"] != "team" {
+		t.Errorf("expected configured team first, got %v", r)
+	}
+	if r, _ := responders[1].(map[string]interface{}); r["id"] != "team-2" || r["type"] != "team" {
+		t.Errorf("expected picked team, got %v", r)
+	}
+	if r, _ := responders[2].(map[string]interface{}); r["id"] != "user-1" || r["type"] != "user" {
+		t.Errorf("expected assignee, got %v", r)
+	}
+}
+
+func TestCreateTicket_InvalidPriority(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	c := newActionTestConnector(srv)
+
+	_, _, err := c.CreateTicket(context.Background(), &v2.Ticket{
+		DisplayName: "Grant access to prod",
+		CustomFields: map[string]*v2.TicketCustomField{
+			ticketPriorityField: sdkTicket.PickStringField(ticketPriorityField, "P9"),
+		},
+	}, nil)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestGetTicket(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		alertStatus  string
+		acknowledged bool
+		expected     string
+	}{
+		{"open", "open", false, ticketStatusOpen},
+		{"acked", "open", true, ticketStatusAcked},
+		{"closed", "closed", true, ticketStatusClosed},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/v2/alerts":
+					if q := r.URL.Query().Get("query"); q != "alias=baton-abc" {
+						t.Errorf("unexpected query %q", q)
+					}
+					writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+						"data": []map[string]interface{}{{"id": "alert-1", "alias": "baton-abc"}},
+					})
+				case "/v2/alerts/alert-1":
+					writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+						"data": map[string]interface{}{
+							"id":           "alert-1",
+							"alias":        "baton-abc",
+							"message":      "Grant access to prod",
+							"status":       tc.alertStatus,
+							"acknowledged": tc.acknowledged,
+							"priority":     "P2",
+							"createdAt":    "2024-01-01T00:00:00Z",
+						},
+					})
+				default:
+					t.Errorf("unexpected request %s", r.URL.Path)
+					w.WriteHeader(http.StatusNotFound)
+				}
+			}))
+			defer srv.Close()
+
+			ticket, _, err := newActionTestConnector(srv).GetTicket(context.Background(), "baton-abc")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if ticket.GetStatus().GetId() != tc.expected {
+				t.Errorf("expected status %q, got %q", tc.expected, ticket.GetStatus().GetId())
+			}
+			if ticket.GetDisplayName() != "Grant access to prod" {
+				t.Errorf("unexpected display name %q", ticket.GetDisplayName())
+			}
+		})
+	}
+}
+
+func TestGetTicket_NotFound(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": []interface{}{}})
+	}))
+	defer srv.Close()
+
+	_, _, err := newActionTestConnector(srv).GetTicket(context.Background(), "baton-missing")
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+}
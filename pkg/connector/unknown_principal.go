@@ -0,0 +1,171 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	"go.uber.org/zap"
+)
+
+// Rotations can reference users and teams that aren't part of the account anymore, or never were
+// (participants of another tenant). Those participants are synced as unknown principals, so the
+// on-call slots they hold show up instead of grants to resources that don't exist.
+
+// participantIndex tells whether rotation participants are among the synced users and teams.
+type participantIndex struct {
+	users map[string]bool
+	teams map[string]bool
+}
+
+func newParticipantIndex(ctx context.Context, cache *syncCache) (*participantIndex, error) {
+	users, err := cache.UserIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	teams, err := cache.TeamIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &participantIndex{users: users, teams: teams}, nil
+}
+
+// dangling reports whether a participant references a user or team that isn't synced. Other
+// participant types are resolved by their own syncers and never dangle here.
+func (p *participantIndex) dangling(participantType, participantID string) bool {
+	switch participantType {
+	case userParticipantType:
+		return !p.users[participantID]
+	case teamParticipantType:
+		return !p.teams[participantID]
+	default:
+		return false
+	}
+}
+
+// unknownPrincipalResourceID returns the ID of the unknown principal standing in for a participant.
+func unknownPrincipalResourceID(participantType, participantID string) *v2.ResourceId {
+	return &v2.ResourceId{
+		ResourceType: resourceTypeUnknownPrincipal.Id,
+		Resource:     participantType + "/" + participantID,
+	}
+}
+
+type unknownPrincipalResourceType struct {
+	resourceType *v2.ResourceType
+	backend      backend
+	cache        *syncCache
+}
+
+func (u *unknownPrincipalResourceType) ResourceType(_ context.Context) *v2.ResourceType {
+	return u.resourceType
+}
+
+// unknownPrincipalResource creates a new connector resource for a dangling rotation participant.
+func unknownPrincipalResource(participantType, participantID string, scheduleIDs []string) (*v2.Resource, error) {
+	profile := map[string]interface{}{
+		"participant_type": participantType,
+		"participant_id":   participantID,
+		"schedule_ids":     scheduleParticipantsToInterfaceSlice(scheduleIDs),
+	}
+
+	return rs.NewResource(
+		fmt.Sprintf("Unknown %s %s", participantType, participantID),
+		resourceTypeUnknownPrincipal,
+		participantType+"/"+participantID,
+		rs.WithResourceProfile(profile),
+		rs.WithDescription(fmt.Sprintf("Rotation participant not found among the synced %ss", participantType)),
+	)
+}
+
+// List scans the rotations of every schedule for participants that aren't synced users or teams.
+func (u *unknownPrincipalResourceType) List(ctx context.Context, parentID *v2.ResourceId, opts rs.SyncOpAttrs) ([]*v2.Resource, *rs.SyncOpResults, error) {
+	if parentID != nil {
+		return nil, nil, nil
+	}
+	u.cache.scope(opts)
+
+	l := ctxzap.Extract(ctx)
+
+	schedules, err := u.backend.ListSchedules(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to list schedules: %w", err)
+	}
+
+	var index *participantIndex
+	referencedBy := make(map[string][]string)
+	for _, schedule := range schedules {
+		for _, r := range schedule.Rotations {
+			for _, p := range r.Participants {
+				participantType := string(p.Type)
+				if participantType != userParticipantType && participantType != teamParticipantType {
+					continue
+				}
+
+				// The users and teams are only listed once a schedule has people in its rotations.
+				if index == nil {
+					index, err = newParticipantIndex(ctx, u.cache)
+					if err != nil {
+						return nil, nil, err
+					}
+				}
+
+				if !index.dangling(participantType, p.Id) {
+					continue
+				}
+
+				key := participantType + "/" + p.Id
+				if ids := referencedBy[key]; len(ids) == 0 || ids[len(ids)-1] != schedule.Id {
+					referencedBy[key] = append(ids, schedule.Id)
+				}
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(referencedBy))
+	for key := range referencedBy {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rv := make([]*v2.Resource, 0, len(keys))
+	for _, key := range keys {
+		participantType, participantID, _ := strings.Cut(key, "/")
+
+		l.Warn("opsgenie-connector: rotation participant not found",
+			zap.String("participant_type", participantType),
+			zap.String("participant_id", participantID),
+			zap.Strings("schedule_ids", referencedBy[key]),
+		)
+
+		r, err := unknownPrincipalResource(participantType, participantID, referencedBy[key])
+		if err != nil {
+			return nil, nil, err
+		}
+		rv = append(rv, r)
+	}
+
+	return rv, &rs.SyncOpResults{}, nil
+}
+
+func (u *unknownPrincipalResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Entitlement, *rs.SyncOpResults, error) {
+	return nil, &rs.SyncOpResults{}, nil
+}
+
+func (u *unknownPrincipalResourceType) Grants(_ context.Context, _ *v2.Resource, _ rs.SyncOpAttrs) ([]*v2.Grant, *rs.SyncOpResults, error) {
+	return nil, &rs.SyncOpResults{}, nil
+}
+
+func unknownPrincipalBuilder(b backend, cache *syncCache) *unknownPrincipalResourceType {
+	return &unknownPrincipalResourceType{
+		resourceType: resourceTypeUnknownPrincipal,
+		backend:      b,
+		cache:        cache,
+	}
+}
@@ -0,0 +1,123 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	"github.com/conductorone/baton-opsgenie/pkg/opsgenietest"
+	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
+	rs "github.com/conductorone/baton-sdk/pkg/types/resource"
+	"github.com/opsgenie/opsgenie-go-sdk-v2/og"
+	ogSchedule "github.com/opsgenie/opsgenie-go-sdk-v2/schedule"
+)
+
+// newDanglingParticipantsTenant serves an account with user-1 and team-1, and a schedule whose
+// rotation also references a deleted user and a team of another tenant. The deleted user is on
+// call, with a user of an override that doesn't exist either.
+func newDanglingParticipantsTenant(t *testing.T) *opsgenietest.Server {
+	t.Helper()
+
+	srv := opsgenietest.NewServer(t)
+	srv.AddUser(opsgenietest.User{ID: "user-1"})
+	srv.AddTeam(opsgenietest.Team{ID: "team-1"})
+	srv.AddSchedule(opsgenietest.Schedule{
+		ID:   "schedule-1",
+		Name: "primary",
+		Rotations: []opsgenietest.Rotation{{Participants: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-1"},
+			{Type: opsgenietest.UserParticipant, ID: "user-deleted"},
+			{Type: opsgenietest.TeamParticipant, ID: "team-1"},
+			{Type: opsgenietest.TeamParticipant, ID: "team-foreign"},
+		}}},
+		OnCall: []opsgenietest.Participant{
+			{Type: opsgenietest.UserParticipant, ID: "user-deleted"},
+			{Type: opsgenietest.UserParticipant, ID: "user-override"},
+		},
+	})
+
+	return srv
+}
+
+func TestUnknownPrincipalList(t *testing.T) {
+	config := newDanglingParticipantsTenant(t).Config()
+
+	b := newTestOpsgenieBackend(t, config)
+	resources, _, err := unknownPrincipalBuilder(b, newSyncCache(b)).List(context.Background(), nil, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []string
+	for _, r := range resources {
+		got = append(got, r.GetId().GetResource())
+	}
+	if len(got) != 2 || got[0] != "team/team-foreign" || got[1] != "user/user-deleted" {
+		t.Fatalf("unexpected unknown principals %v", got)
+	}
+
+	scheduleIDs, _ := getProfileStringArray(rs.GetProfile(resources[1]), "schedule_ids")
+	if len(scheduleIDs) != 1 || scheduleIDs[0] != "schedule-1" {
+		t.Errorf("unexpected referencing schedules %v", scheduleIDs)
+	}
+}
+
+func TestScheduleGrants_DanglingParticipants(t *testing.T) {
+	config := newDanglingParticipantsTenant(t).Config()
+
+	schedule, err := scheduleResource(&ogSchedule.Schedule{
+		Id:   "schedule-1",
+		Name: "primary",
+		Rotations: []og.Rotation{{Participants: []og.Participant{
+			{Type: og.User, Id: "user-1"},
+			{Type: og.User, Id: "user-deleted"},
+			{Type: og.Team, Id: "team-1"},
+			{Type: og.Team, Id: "team-foreign"},
+		}}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	b := newTestOpsgenieBackend(t, config)
+	grants, _, err := scheduleBuilder(config, nil, b, newSyncCache(b), false).Grants(context.Background(), schedule, rs.SyncOpAttrs{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := make(map[string]bool)
+	for _, g := range grants {
+		got[g.GetEntitlement().GetId()+" "+g.GetPrincipal().GetId().GetResourceType()+":"+g.GetPrincipal().GetId().GetResource()] = true
+	}
+
+	member := entitlementID(resourceTypeSchedule, "schedule-1", scheduleMember)
+	onCall := entitlementID(resourceTypeSchedule, "schedule-1", scheduleOnCall)
+	expected := []string{
+		member + " user:user-1",
+		member + " team:team-1",
+		member + " unknown-principal:user/user-deleted",
+		member + " unknown-principal:team/team-foreign",
+		onCall + " unknown-principal:user/user-deleted",
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %d grants, got %v", len(expected), got)
+	}
+	for _, e := range expected {
+		if !got[e] {
+			t.Errorf("missing grant %s, got %v", e, got)
+		}
+	}
+
+	// The override participant has no unknown principal, its grant is dropped.
+	for _, g := range grants {
+		if g.GetPrincipal().GetId().GetResource() == "user-override" {
+			t.Errorf("unexpected grant to unknown on-call participant: %v", g)
+		}
+	}
+}
+
+func TestUnknownPrincipalResourceID(t *testing.T) {
+	id := unknownPrincipalResourceID(userParticipantType, "user-1")
+	if id.GetResourceType() != resourceTypeUnknownPrincipal.Id || id.GetResource() != "user/user-1" {
+		t.Errorf("unexpected resource ID %v", &v2.ResourceId{ResourceType: id.GetResourceType(), Resource: id.GetResource()})
+	}
+}
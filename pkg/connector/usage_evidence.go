@@ -0,0 +1,245 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/logging/zap/ctxzap"
+	ogAlert "github.com/opsgenie/opsgenie-go-sdk-v2/alert"
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+	"go.uber.org/zap"
+)
+
+const (
+	// Opsgenie refuses alert list requests where offset + limit exceeds this value.
+	maxAlertListWindow = 20000
+
+	alertLogsPageSize = 100
+
+	defaultUsageEvidenceLookback = 30 * 24 * time.Hour
+)
+
+// userActivity holds the usage evidence collected for a single user.
+type userActivity struct {
+	LastAcknowledgedAt time.Time
+	LastClosedAt       time.Time
+	// LastActivityAt is the most recent audit log entry or alert action of the user.
+	// It is only tracked when the audit logs are scanned.
+	LastActivityAt time.Time
+}
+
+// usageEvidence scans recent alerts to find out when users last acknowledged or closed an alert.
+// When auditLogLookback is set it also scans the account audit logs to derive each user's last activity.
+// The scan runs once per sync, when the evidence is first asked for, and the result is keyed by username.
+//
+// A nil usageEvidence has no evidence.
+type usageEvidence struct {
+	config           *ogclient.Config
+	failures         *failureLog
+	lookback         time.Duration
+	auditLogLookback time.Duration
+	now              func() time.Time
+
+	mtx            sync.Mutex
+	loaded         bool
+	activities     map[string]*userActivity
+	activityCutoff time.Time
+}
+
+func newUsageEvidence(config *ogclient.Config, failures *failureLog, lookback time.Duration) *usageEvidence {
+	if lookback <= 0 {
+		lookback = defaultUsageEvidenceLookback
+	}
+
+	return &usageEvidence{
+		config:   config,
+		failures: failures,
+		lookback: lookback,
+		now:      time.Now,
+	}
+}
+
+// detached returns usage evidence with the same settings and none of the evidence collected so far.
+func (u *usageEvidence) detached() *usageEvidence {
+	if u == nil {
+		return nil
+	}
+
+	return &usageEvidence{
+		config:           u.config,
+		failures:         u.failures,
+		lookback:         u.lookback,
+		auditLogLookback: u.auditLogLookback,
+		now:              u.now,
+	}
+}
+
+func (u *usageEvidence) activity(username string) *userActivity {
+	a, ok := u.activities[username]
+	if !ok {
+		a = &userActivity{}
+		u.activities[username] = a
+	}
+
+	return a
+}
+
+// recordActivity updates the last activity of a user, ignoring anything older than the audit log lookback.
+func (u *usageEvidence) recordActivity(username string, at time.Time) {
+	if u.auditLogLookback <= 0 || username == "" || at.Before(u.activityCutoff) {
+		return
+	}
+
+	if a := u.activity(username); at.After(a.LastActivityAt) {
+		a.LastActivityAt = at
+	}
+}
+
+func (u *usageEvidence) recordAcknowledged(username string, at time.Time, cutoff time.Time) {
+	if username == "" || at.Before(cutoff) {
+		return
+	}
+
+	if a := u.activity(username); at.After(a.LastAcknowledgedAt) {
+		a.LastAcknowledgedAt = at
+	}
+	u.recordActivity(username, at)
+}
+
+func (u *usageEvidence) recordClosed(username string, at time.Time, cutoff time.Time) {
+	if username == "" || at.Before(cutoff) {
+		return
+	}
+
+	if a := u.activity(username); at.After(a.LastClosedAt) {
+		a.LastClosedAt = at
+	}
+	u.recordActivity(username, at)
+}
+
+// Reset drops the evidence of the previous sync. It is collected again when it is next asked for.
+func (u *usageEvidence) Reset() {
+	if u == nil {
+		return
+	}
+
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	u.loaded = false
+	u.activities = nil
+}
+
+// Refresh rescans the alerts updated within the lookback window.
+func (u *usageEvidence) Refresh(ctx context.Context) error {
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	return u.refresh(ctx)
+}
+
+func (u *usageEvidence) refresh(ctx context.Context) error {
+	l := ctxzap.Extract(ctx)
+
+	client, err := ogAlert.NewClient(u.config)
+	if err != nil {
+		return err
+	}
+
+	u.activities = make(map[string]*userActivity)
+	now := u.now()
+	cutoff := now.Add(-u.lookback)
+	u.activityCutoff = now.Add(-u.auditLogLookback)
+
+	var (
+		scanned    int
+		oldestSeen time.Time
+		complete   bool
+	)
+	for offset := 0; offset+ResourcesPageSize <= maxAlertListWindow; offset += ResourcesPageSize {
+		alerts, err := client.List(ctx, &ogAlert.ListAlertRequest{
+			Limit:  ResourcesPageSize,
+			Offset: offset,
+			Sort:   ogAlert.UpdatedAt,
+			Order:  ogAlert.Desc,
+			Query:  fmt.Sprintf("updatedAt>=%d", cutoff.UnixMilli()),
+		})
+		if err != nil {
+			return fmt.Errorf("opsgenie-connector: failed to list alerts: %w", translateAPIError(u.failures, err))
+		}
+
+		for _, alert := range alerts.Alerts {
+			u.scanAlert(alert, cutoff)
+			oldestSeen = alert.UpdatedAt
+		}
+
+		scanned += len(alerts.Alerts)
+		if len(alerts.Alerts) < ResourcesPageSize {
+			complete = true
+			break
+		}
+	}
+
+	// Alerts past the list window can't be paged to, so evidence older than the last alert scanned is missing.
+	if !complete {
+		l.Warn("opsgenie-connector: usage evidence stopped at the alert list window, older alerts were not scanned",
+			zap.Int("alerts_scanned", scanned),
+			zap.Time("scanned_back_to", oldestSeen),
+			zap.Duration("lookback", u.lookback),
+		)
+	}
+
+	if u.auditLogLookback > 0 {
+		if err := u.scanAuditLogs(ctx); err != nil {
+			return err
+		}
+	}
+
+	u.loaded = true
+
+	l.Debug("opsgenie-connector: collected usage evidence",
+		zap.Int("alerts_scanned", scanned),
+		zap.Int("users_with_activity", len(u.activities)),
+		zap.Duration("lookback", u.lookback),
+	)
+
+	return nil
+}
+
+// scanAlert records who last acknowledged and closed an alert, from the report of the alert.
+func (u *usageEvidence) scanAlert(alert ogAlert.Alert, cutoff time.Time) {
+	if alert.Report.AcknowledgedBy != "" {
+		u.recordAcknowledged(alert.Report.AcknowledgedBy, alert.CreatedAt.Add(time.Duration(alert.Report.AckTime)*time.Millisecond), cutoff)
+	}
+	if alert.Report.ClosedBy != "" {
+		u.recordClosed(alert.Report.ClosedBy, alert.CreatedAt.Add(time.Duration(alert.Report.CloseTime)*time.Millisecond), cutoff)
+	}
+}
+
+// Activity returns the usage evidence collected for the given username, or nil if there is none.
+// The first call of a sync collects the evidence, so that a sync resumed past its first page of
+// users has it too.
+func (u *usageEvidence) Activity(ctx context.Context, username string) (*userActivity, error) {
+	if u == nil {
+		return nil, nil
+	}
+
+	u.mtx.Lock()
+	defer u.mtx.Unlock()
+
+	if !u.loaded {
+		if err := u.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	a, ok := u.activities[username]
+	if !ok {
+		return nil, nil
+	}
+
+	rv := *a
+	return &rv, nil
+}
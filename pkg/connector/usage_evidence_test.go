@@ -0,0 +1,274 @@
+package connector
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/conductorone/baton-sdk/pkg/pagination"
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+func TestUsageEvidenceRefresh(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/alerts":
+			if q := r.URL.Query().Get("query"); q != "updatedAt>=1717156800000" {
+				t.Errorf("unexpected query %q", q)
+			}
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": []map[string]interface{}{
+					{
+						"id":        "alert-1",
+						"createdAt": "2024-06-20T10:00:00Z",
+						"report": map[string]interface{}{
+							"ackTime":        60000,
+							"closeTime":      120000,
+							"acknowledgedBy": "bob@example.com",
+							"closedBy":       "bob@example.com",
+						},
+					},
+					{
+						"id":        "alert-2",
+						"createdAt": "2024-06-20T10:00:00Z",
+						"report": map[string]interface{}{
+							"ackTime":        30000,
+							"acknowledgedBy": "alice@example.com",
+						},
+					},
+					{
+						"id":        "alert-3",
+						"createdAt": "2024-06-21T10:00:00Z",
+					},
+				},
+			})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	usage := newUsageEvidence(newActionTestConnector(srv).config, nil, 30*24*time.Hour)
+	usage.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if err := usage.Refresh(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	alice, _ := usage.Activity(ctx, "alice@example.com")
+	if alice == nil || !alice.LastAcknowledgedAt.Equal(time.Date(2024, 6, 20, 10, 0, 30, 0, time.UTC)) {
+		t.Errorf("unexpected activity for alice: %+v", alice)
+	}
+	if !alice.LastClosedAt.IsZero() {
+		t.Errorf("expected alice to have closed nothing, got %v", alice.LastClosedAt)
+	}
+
+	bob, _ := usage.Activity(ctx, "bob@example.com")
+	if bob == nil || !bob.LastAcknowledgedAt.Equal(time.Date(2024, 6, 20, 10, 1, 0, 0, time.UTC)) ||
+		!bob.LastClosedAt.Equal(time.Date(2024, 6, 20, 10, 2, 0, 0, time.UTC)) {
+		t.Errorf("unexpected activity for bob: %+v", bob)
+	}
+
+	if carol, _ := usage.Activity(ctx, "carol@example.com"); carol != nil {
+		t.Errorf("expected no activity for carol")
+	}
+
+	ur, err := userResource(context.Background(), user.User{Id: "u-bob", Username: "bob@example.com", FullName: "Bob"}, bob, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	profile := res.GetProfile(ur)
+	if v, _ := res.GetProfileStringValue(profile, "last_alert_acknowledged_at"); v != "2024-06-20T10:01:00Z" {
+		t.Errorf("unexpected last_alert_acknowledged_at %q", v)
+	}
+	if v, _ := res.GetProfileStringValue(profile, "last_alert_closed_at"); v != "2024-06-20T10:02:00Z" {
+		t.Errorf("unexpected last_alert_closed_at %q", v)
+	}
+}
+
+func TestUsageEvidenceLastActivity(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/alerts":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": []map[string]interface{}{
+					{
+						"id":        "alert-1",
+						"createdAt": "2024-06-29T10:00:00Z",
+						"report":    map[string]interface{}{"ackTime": 60000, "acknowledgedBy": "bob@example.com"},
+					},
+				},
+			})
+		case "/v2/logs/list/2024-04-01-12-00-00":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data":   []map[string]interface{}{{"filename": "2024-06-01-00-00-00"}},
+				"marker": "2024-06-01-00-00-00",
+			})
+		case "/v2/logs/list/2024-06-01-00-00-00":
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": []interface{}{}, "marker": ""})
+		case "/v2/logs/download/2024-06-01-00-00-00":
+			_, _ = w.Write([]byte(srv.URL + "/files/2024-06-01-00-00-00"))
+		case "/files/2024-06-01-00-00-00":
+			_, _ = w.Write([]byte(
+				`{"owner":"alice@example.com","date":"2024-06-01T00:10:00Z","log":"Logged in"}` + "\n" +
+					`{"owner":"bob@example.com","date":"2024-06-01T00:00:00.000Z","log":"Updated team"}` + "\n" +
+					`{"owner":"System","date":"2024-06-02T00:00:00Z"}` + "\n" +
+					"not json\n",
+			))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	usage := newUsageEvidence(newActionTestConnector(srv).config, nil, 7*24*time.Hour)
+	usage.auditLogLookback = lastActivityLookback(90)
+	usage.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	if err := usage.Refresh(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	alice, _ := usage.Activity(ctx, "alice@example.com")
+	if alice == nil || !alice.LastActivityAt.Equal(time.Date(2024, 6, 1, 0, 10, 0, 0, time.UTC)) {
+		t.Errorf("unexpected activity for alice: %+v", alice)
+	}
+
+	// Bob's alert acknowledgement is more recent than his audit log entry.
+	bob, _ := usage.Activity(ctx, "bob@example.com")
+	if bob == nil || !bob.LastActivityAt.Equal(time.Date(2024, 6, 29, 10, 1, 0, 0, time.UTC)) {
+		t.Errorf("unexpected activity for bob: %+v", bob)
+	}
+
+	ur, err := userResource(context.Background(), user.User{Id: "u-alice", Username: "alice@example.com", FullName: "Alice"}, alice, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	userTrait, err := res.GetUserTrait(ur)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !userTrait.GetLastLogin().AsTime().Equal(alice.LastActivityAt) {
+		t.Errorf("expected last login %v, got %v", alice.LastActivityAt, userTrait.GetLastLogin().AsTime())
+	}
+	if v, _ := res.GetProfileStringValue(res.GetProfile(ur), "last_activity_at"); v != "2024-06-01T00:10:00Z" {
+		t.Errorf("unexpected last_activity_at %q", v)
+	}
+}
+
+// A sync resumed past its first page of users collects the usage evidence on first use, and a new
+// sync collects it again once the cache is reset.
+func TestUserList_UsageEvidenceOnResumedSync(t *testing.T) {
+	var scans atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/alerts":
+			scans.Add(1)
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": []map[string]interface{}{{
+					"id":        "alert-1",
+					"createdAt": time.Now().Add(-time.Hour).UTC().Format(time.RFC3339),
+					"report":    map[string]interface{}{"ackTime": 60000, "acknowledgedBy": "bob@example.com"},
+				}},
+			})
+		case "/v2/users/":
+			if got := r.URL.Query().Get("offset"); got != "100" {
+				t.Errorf("expected the resumed page at offset 100, got %q", got)
+			}
+			writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{
+				"data": []map[string]interface{}{{"id": "u-bob", "username": "bob@example.com"}},
+			})
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	config := newActionTestConnector(srv).config
+	b := newTestOpsgenieBackend(t, config)
+	usage := newUsageEvidence(config, nil, 7*24*time.Hour)
+	cache := newSyncCache(b)
+	cache.usage = usage
+	builder := userBuilder(config, nil, b, usage, "", false)
+
+	bag := &pagination.Bag{}
+	bag.Push(pagination.PageState{ResourceTypeID: resourceTypeUser.Id, Token: "100"})
+	token, err := bag.Marshal()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for sync := 1; sync <= 2; sync++ {
+		cache.Reset()
+
+		users, _, err := builder.List(context.Background(), nil, res.SyncOpAttrs{PageToken: pagination.Token{Token: token}})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(users) != 1 {
+			t.Fatalf("expected 1 user, got %d", len(users))
+		}
+		if _, ok := res.GetProfileStringValue(res.GetProfile(users[0]), "last_alert_acknowledged_at"); !ok {
+			t.Errorf("sync %d: expected usage evidence on a resumed page", sync)
+		}
+		if got := int(scans.Load()); got != sync {
+			t.Errorf("sync %d: expected %d alert scans, got %d", sync, sync, got)
+		}
+	}
+}
+
+func TestUsageEvidenceRefresh_AlertListWindow(t *testing.T) {
+	var lastOffset atomic.Int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/alerts" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		// The first page is requested without an offset.
+		var offset int
+		if q := r.URL.Query().Get("offset"); q != "" {
+			var err error
+			if offset, err = strconv.Atoi(q); err != nil {
+				t.Errorf("unexpected offset %q", q)
+			}
+		}
+		lastOffset.Store(int64(offset))
+
+		// Every page is full, as if far more alerts were updated within the lookback.
+		alerts := make([]map[string]interface{}, ResourcesPageSize)
+		for i := range alerts {
+			alerts[i] = map[string]interface{}{"id": fmt.Sprintf("alert-%d", offset+i), "createdAt": "2024-06-20T10:00:00Z"}
+		}
+		writeOpsgenieJSON(t, w, http.StatusOK, map[string]interface{}{"data": alerts})
+	}))
+	defer srv.Close()
+
+	usage := newUsageEvidence(newActionTestConnector(srv).config, nil, 30*24*time.Hour)
+	if err := usage.Refresh(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got := lastOffset.Load(); got != maxAlertListWindow-ResourcesPageSize {
+		t.Errorf("expected the scan to stop at offset %d, got %d", maxAlertListWindow-ResourcesPageSize, got)
+	}
+}
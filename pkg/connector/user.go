@@ -2,25 +2,96 @@ package connector
 
 import (
 	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	v2 "github.com/conductorone/baton-sdk/pb/c1/connector/v2"
 	"github.com/conductorone/baton-sdk/pkg/annotations"
-	"github.com/conductorone/baton-sdk/pkg/pagination"
 	resource "github.com/conductorone/baton-sdk/pkg/types/resource"
 	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
 	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
 )
 
 type userResourceType struct {
-	resourceType *v2.ResourceType
-	config       *ogclient.Config
+	resourceType        *v2.ResourceType
+	config              *ogclient.Config
+	failures            *failureLog
+	backend             backend
+	usage               *usageEvidence
+	employeeIDDetailKey string
+	// dryRun makes offboarding describe the requests it would send instead of sending them.
+	dryRun bool
 }
 
 func (o *userResourceType) ResourceType(_ context.Context) *v2.ResourceType {
 	return o.resourceType
 }
 
-func userResource(ctx context.Context, user user.User) (*v2.Resource, error) {
+// profileKeyPattern matches the characters that are replaced when a user detail key is used in a profile key.
+var profileKeyPattern = regexp.MustCompile(`[^a-z0-9]+`)
+
+// detailProfileKey returns the profile key of a user detail. Details are prefixed so they can't
+// clash with the other profile keys.
+func detailProfileKey(key string) string {
+	return "detail_" + strings.Trim(profileKeyPattern.ReplaceAllString(strings.ToLower(key), "_"), "_")
+}
+
+// sortedDetailKeys returns the keys of user details in a stable order.
+func sortedDetailKeys(details map[string][]string) []string {
+	keys := make([]string, 0, len(details))
+	for k := range details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// detailProfile returns the profile keys and values of user details. Keys such as "Employee ID" and
+// "employee_id" have the same profile key: the first one in sorted order keeps it, the next ones get
+// a _2, _3... suffix.
+func detailProfile(details map[string][]string) map[string]string {
+	rv := make(map[string]string, len(details))
+	for _, k := range sortedDetailKeys(details) {
+		v := details[k]
+		if len(v) == 0 {
+			continue
+		}
+
+		key := detailProfileKey(k)
+		for i := 2; rv[key] != ""; i++ {
+			key = fmt.Sprintf("%s_%d", detailProfileKey(k), i)
+		}
+		rv[key] = strings.Join(v, ", ")
+	}
+
+	return rv
+}
+
+// userDetailValues returns the values of a user detail. An exact match of the key wins, otherwise the
+// first key in sorted order that matches case-insensitively.
+func userDetailValues(details map[string][]string, key string) []string {
+	if key == "" {
+		return nil
+	}
+
+	if v, ok := details[key]; ok {
+		return v
+	}
+
+	for _, k := range sortedDetailKeys(details) {
+		if strings.EqualFold(k, key) {
+			return details[k]
+		}
+	}
+
+	return nil
+}
+
+func userResource(ctx context.Context, user user.User, activity *userActivity, employeeIDDetailKey string) (*v2.Resource, error) {
 	profile := map[string]interface{}{
 		"full_name": user.FullName,
 		"time_zone": user.TimeZone,
@@ -29,10 +100,60 @@ func userResource(ctx context.Context, user user.User) (*v2.Resource, error) {
 		"email":     user.Username,
 	}
 
+	if user.Locale != "" {
+		profile["locale"] = user.Locale
+	}
+
+	if len(user.Tags) > 0 {
+		tags := make([]interface{}, 0, len(user.Tags))
+		for _, t := range user.Tags {
+			tags = append(tags, t)
+		}
+		profile["tags"] = tags
+	}
+
+	for k, v := range detailProfile(user.Details) {
+		profile[k] = v
+	}
+
+	if address := user.UserAddress; address != nil {
+		for k, v := range map[string]string{
+			"address_country":  address.Country,
+			"address_state":    address.State,
+			"address_city":     address.City,
+			"address_line":     address.Line,
+			"address_zip_code": address.ZipCode,
+		} {
+			if v != "" {
+				profile[k] = v
+			}
+		}
+	}
+
+	if activity != nil {
+		if !activity.LastAcknowledgedAt.IsZero() {
+			profile["last_alert_acknowledged_at"] = activity.LastAcknowledgedAt.UTC().Format(time.RFC3339)
+		}
+		if !activity.LastClosedAt.IsZero() {
+			profile["last_alert_closed_at"] = activity.LastClosedAt.UTC().Format(time.RFC3339)
+		}
+		if !activity.LastActivityAt.IsZero() {
+			profile["last_activity_at"] = activity.LastActivityAt.UTC().Format(time.RFC3339)
+		}
+	}
+
 	userTraitOptions := []resource.UserTraitOption{
 		resource.WithEmail(user.Username, true),
 	}
 
+	if employeeIDs := userDetailValues(user.Details, employeeIDDetailKey); len(employeeIDs) > 0 {
+		userTraitOptions = append(userTraitOptions, resource.WithEmployeeID(employeeIDs...))
+	}
+
+	if activity != nil && !activity.LastActivityAt.IsZero() {
+		userTraitOptions = append(userTraitOptions, resource.WithLastLogin(activity.LastActivityAt))
+	}
+
 	resource, err := resource.NewUserResource(
 		user.FullName,
 		resourceTypeUser,
@@ -40,6 +161,7 @@ func userResource(ctx context.Context, user user.User) (*v2.Resource, error) {
 		userTraitOptions,
 		resource.WithResourceProfile(profile),
 		resource.WithResourceStatus(v2.Status_RESOURCE_STATUS_ENABLED, ""),
+		resource.WithAnnotation(&v2.ChildResourceType{ResourceTypeId: resourceTypeForwardingRule.Id}),
 	)
 	if err != nil {
 		return nil, err
@@ -48,59 +170,79 @@ func userResource(ctx context.Context, user user.User) (*v2.Resource, error) {
 	return resource, nil
 }
 
-func (o *userResourceType) List(ctx context.Context, _ *v2.ResourceId, pt *pagination.Token) ([]*v2.Resource, string, annotations.Annotations, error) {
-	bag, offset, err := parsePageToken(pt.Token, &v2.ResourceId{ResourceType: o.resourceType.Id})
-	if err != nil {
-		return nil, "", nil, err
-	}
-
-	userClient, err := user.NewClient(o.config)
+func (o *userResourceType) List(ctx context.Context, _ *v2.ResourceId, opts resource.SyncOpAttrs) ([]*v2.Resource, *resource.SyncOpResults, error) {
+	bag, offset, err := parsePageToken(opts.PageToken.Token, &v2.ResourceId{ResourceType: o.resourceType.Id})
 	if err != nil {
-		return nil, "", nil, err
+		return nil, nil, err
 	}
 
-	users, err := userClient.List(
-		ctx,
-		&user.ListRequest{
-			Limit:  ResourcesPageSize,
-			Offset: offset,
-		},
-	)
+	users, next, err := o.backend.ListUsers(ctx, offset)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, nil, err
 	}
 
 	rv := make([]*v2.Resource, 0)
-	for _, user := range users.Users {
+	for _, user := range users {
 		userCopy := user
 
-		ur, err := userResource(ctx, userCopy)
+		activity, err := o.usage.Activity(ctx, userCopy.Username)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ur, err := userResource(ctx, userCopy, activity, o.employeeIDDetailKey)
 		if err != nil {
-			return nil, "", nil, err
+			return nil, nil, err
 		}
 
 		rv = append(rv, ur)
 	}
 
-	nextPage, err := handleNextPage(bag, users.Paging.Next)
+	nextPage, err := handleNextPage(bag, next)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rv, &resource.SyncOpResults{NextPageToken: nextPage}, nil
+}
+
+// Get fetches a single user by ID for targeted syncs.
+func (o *userResourceType) Get(ctx context.Context, resourceID *v2.ResourceId, _ *v2.ResourceId) (*v2.Resource, annotations.Annotations, error) {
+	u, err := o.backend.GetUser(ctx, resourceID.Resource)
+	if err != nil {
+		return nil, nil, fmt.Errorf("opsgenie-connector: failed to get user %s: %w", resourceID.Resource, err)
+	}
+
+	// A targeted sync has no sync ID to tell whether the evidence of the last sync is current, so it is collected again.
+	activity, err := o.usage.detached().Activity(ctx, u.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ur, err := userResource(ctx, *u, activity, o.employeeIDDetailKey)
 	if err != nil {
-		return nil, "", nil, err
+		return nil, nil, err
 	}
 
-	return rv, nextPage, nil, nil
+	return ur, nil, nil
 }
 
-func (o *userResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Entitlement, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+func (o *userResourceType) Entitlements(_ context.Context, _ *v2.Resource, _ resource.SyncOpAttrs) ([]*v2.Entitlement, *resource.SyncOpResults, error) {
+	return nil, nil, nil
 }
 
-func (o *userResourceType) Grants(_ context.Context, _ *v2.Resource, _ *pagination.Token) ([]*v2.Grant, string, annotations.Annotations, error) {
-	return nil, "", nil, nil
+func (o *userResourceType) Grants(_ context.Context, _ *v2.Resource, _ resource.SyncOpAttrs) ([]*v2.Grant, *resource.SyncOpResults, error) {
+	return nil, nil, nil
 }
 
-func userBuilder(config *ogclient.Config) *userResourceType {
+func userBuilder(config *ogclient.Config, failures *failureLog, b backend, usage *usageEvidence, employeeIDDetailKey string, dryRun bool) *userResourceType {
 	return &userResourceType{
-		resourceType: resourceTypeUser,
-		config:       config,
+		resourceType:        resourceTypeUser,
+		config:              config,
+		failures:            failures,
+		backend:             b,
+		usage:               usage,
+		employeeIDDetailKey: employeeIDDetailKey,
+		dryRun:              dryRun,
 	}
 }
@@ -0,0 +1,122 @@
+package connector
+
+import (
+	"context"
+	"testing"
+
+	res "github.com/conductorone/baton-sdk/pkg/types/resource"
+	user "github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+func TestUserResourceProfile(t *testing.T) {
+	u := user.User{
+		Id:       "u-1",
+		Username: "alice@example.com",
+		FullName: "Alice",
+		TimeZone: "Europe/Berlin",
+		Locale:   "de_DE",
+		Tags:     []string{"sre", "oncall"},
+		Details: map[string][]string{
+			"Employee ID": {"E-1234"},
+			"cost-center": {"CC1", "CC2"},
+		},
+		UserAddress: &user.UserAddress{Country: "DE", City: "Berlin"},
+	}
+
+	ur, err := userResource(context.Background(), u, nil, "employee id")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	profile := res.GetProfile(ur)
+	for k, expected := range map[string]string{
+		"full_name":          "Alice",
+		"email":              "alice@example.com",
+		"time_zone":          "Europe/Berlin",
+		"locale":             "de_DE",
+		"detail_employee_id": "E-1234",
+		"detail_cost_center": "CC1, CC2",
+		"address_country":    "DE",
+		"address_city":       "Berlin",
+	} {
+		if v, _ := res.GetProfileStringValue(profile, k); v != expected {
+			t.Errorf("expected %s to be %q, got %q", k, expected, v)
+		}
+	}
+
+	if _, ok := profile.GetFields()["address_zip_code"]; ok {
+		t.Errorf("expected empty address fields to be omitted")
+	}
+
+	if tags, _ := getProfileStringArray(profile, "tags"); len(tags) != 2 || tags[0] != "sre" || tags[1] != "oncall" {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	userTrait, err := res.GetUserTrait(ur)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := userTrait.GetEmployeeIds(); len(ids) != 1 || ids[0] != "E-1234" {
+		t.Errorf("unexpected employee IDs %v", ids)
+	}
+}
+
+func TestUserResourceProfile_CollidingDetailKeys(t *testing.T) {
+	details := map[string][]string{
+		"employee_id": {"E-3"},
+		"Employee ID": {"E-1"},
+		"employee-id": {"E-2"},
+		"EMPLOYEE_ID": {"E-4"},
+	}
+
+	// Map iteration order changes from run to run, the profile must not.
+	for i := 0; i < 20; i++ {
+		ur, err := userResource(context.Background(), user.User{Id: "u-1", Username: "alice@example.com", Details: details}, nil, "Employee_Id")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		profile := res.GetProfile(ur)
+		for k, expected := range map[string]string{
+			"detail_employee_id":   "E-4",
+			"detail_employee_id_2": "E-1",
+			"detail_employee_id_3": "E-2",
+			"detail_employee_id_4": "E-3",
+		} {
+			if v, _ := res.GetProfileStringValue(profile, k); v != expected {
+				t.Fatalf("expected %s to be %q, got %q", k, expected, v)
+			}
+		}
+
+		userTrait, err := res.GetUserTrait(ur)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if ids := userTrait.GetEmployeeIds(); len(ids) != 1 || ids[0] != "E-4" {
+			t.Fatalf("expected the first case-insensitive match in sorted order, got %v", ids)
+		}
+	}
+
+	if got := userDetailValues(details, "employee_id"); len(got) != 1 || got[0] != "E-3" {
+		t.Errorf("expected the exact match to win, got %v", got)
+	}
+}
+
+func TestUserResourceWithoutEmployeeIDKey(t *testing.T) {
+	ur, err := userResource(context.Background(), user.User{
+		Id:       "u-1",
+		Username: "alice@example.com",
+		Details:  map[string][]string{"employee_id": {"E-1234"}},
+	}, nil, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	userTrait, err := res.GetUserTrait(ur)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ids := userTrait.GetEmployeeIds(); len(ids) != 0 {
+		t.Errorf("expected no employee IDs, got %v", ids)
+	}
+}
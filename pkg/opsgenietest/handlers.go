@@ -0,0 +1,1195 @@
+package opsgenietest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// defaultRoles are the roles every Opsgenie account has.
+var defaultRoles = []string{"Owner", "Admin", "User", "Stakeholder"}
+
+const (
+	teamRoleUser  = "user"
+	teamRoleAdmin = "admin"
+
+	defaultPageSize = 20
+)
+
+func (s *Server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /v2/users", s.listUsers)
+	mux.HandleFunc("GET /v2/users/{$}", s.listUsers)
+	mux.HandleFunc("GET /v2/users/{user}", s.getUser)
+	mux.HandleFunc("PATCH /v2/users/{user}", s.updateUser)
+	mux.HandleFunc("DELETE /v2/users/{user}", s.deleteUser)
+	mux.HandleFunc("GET /v2/users/{user}/teams", s.listUserTeams)
+	mux.HandleFunc("GET /v2/users/{user}/schedules", s.listUserSchedules)
+	mux.HandleFunc("GET /v2/users/{user}/escalations", s.listUserEscalations)
+	mux.HandleFunc("GET /v2/users/{user}/forwarding-rules", s.listUserForwardingRules)
+
+	mux.HandleFunc("GET /v2/teams", s.listTeams)
+	mux.HandleFunc("GET /v2/teams/{team}", s.getTeam)
+	mux.HandleFunc("POST /v2/teams/{team}/members", s.addTeamMember)
+	mux.HandleFunc("DELETE /v2/teams/{team}/members/{member}", s.removeTeamMember)
+
+	mux.HandleFunc("GET /v2/roles", s.listRoles)
+	mux.HandleFunc("GET /v2/roles/{$}", s.listRoles)
+	mux.HandleFunc("GET /v2/roles/{role}", s.getRole)
+
+	mux.HandleFunc("GET /v2/schedules", s.listSchedules)
+	mux.HandleFunc("GET /v2/schedules/{schedule}", s.getSchedule)
+	mux.HandleFunc("PATCH /v2/schedules/{schedule}", s.updateSchedule)
+	mux.HandleFunc("PATCH /v2/schedules/{schedule}/rotations/{rotation}", s.updateRotation)
+	mux.HandleFunc("GET /v2/schedules/{schedule}/on-calls", s.getOnCalls)
+	mux.HandleFunc("GET /v2/schedules/{schedule}/overrides", s.listOverrides)
+	mux.HandleFunc("POST /v2/schedules/{schedule}/overrides", s.createOverride)
+
+	mux.HandleFunc("GET /v2/forwarding-rules", s.listForwardingRules)
+	mux.HandleFunc("PUT /v2/forwarding-rules/{rule}", s.updateForwardingRule)
+	mux.HandleFunc("DELETE /v2/forwarding-rules/{rule}", s.deleteForwardingRule)
+
+	mux.HandleFunc("GET /v2/escalations", s.listEscalations)
+	mux.HandleFunc("PATCH /v2/escalations/{escalation}", s.updateEscalation)
+
+	// The other endpoints a sync reads.
+	mux.HandleFunc("GET /v2/heartbeats", func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, r, map[string]interface{}{"heartbeats": []interface{}{}})
+	})
+	mux.HandleFunc("GET /v1/services", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, r, http.StatusOK, map[string]interface{}{"data": []interface{}{}, "paging": map[string]interface{}{}})
+	})
+
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, http.StatusNotFound, fmt.Sprintf("No endpoint %s %s", r.Method, r.URL.Path))
+	})
+
+	return mux
+}
+
+// decode reads a JSON request body, and answers with a 400 when it can't.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Could not parse request body: "+err.Error())
+		return false
+	}
+
+	return true
+}
+
+// page returns the offset and limit of a list request, the limit capped by the page size of the
+// server, and the link to the next page, empty on the last page.
+func (s *Server) page(r *http.Request, total int) (int, int, string) {
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+	if s.pageSize > 0 && limit > s.pageSize {
+		limit = s.pageSize
+	}
+	if offset > total {
+		offset = total
+	}
+
+	end := offset + limit
+	if end >= total {
+		return offset, total, ""
+	}
+
+	return offset, end, fmt.Sprintf("http://%s%s?limit=%d&offset=%d", r.Host, r.URL.Path, limit, end)
+}
+
+// The lookups below are called with the lock held.
+
+// findUser finds a user by ID or username.
+func (s *Server) findUser(identifier string) *User {
+	for _, u := range s.users {
+		if u.ID == identifier || u.Username == identifier {
+			return u
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findTeam(identifier, identifierType string) *Team {
+	for _, t := range s.teams {
+		if (identifierType == "name" && t.Name == identifier) || (identifierType != "name" && t.ID == identifier) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) scheduleByID(id string) *Schedule {
+	for _, schedule := range s.schedules {
+		if schedule.ID == id {
+			return schedule
+		}
+	}
+
+	return nil
+}
+
+// findSchedule finds a schedule by name, or by ID and then by name, since the connector looks
+// on-calls up by schedule name.
+func (s *Server) findSchedule(identifier, identifierType string) *Schedule {
+	if identifierType != "name" {
+		if schedule := s.scheduleByID(identifier); schedule != nil {
+			return schedule
+		}
+	}
+
+	for _, schedule := range s.schedules {
+		if schedule.Name == identifier {
+			return schedule
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findForwardingRule(id string) *ForwardingRule {
+	for _, rule := range s.forwardingRules {
+		if rule.ID == id {
+			return rule
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) findEscalation(identifier, identifierType string) *Escalation {
+	for _, escalation := range s.escalations {
+		if (identifierType == "name" && escalation.Name == identifier) || (identifierType != "name" && escalation.ID == identifier) {
+			return escalation
+		}
+	}
+
+	return nil
+}
+
+// findParticipant resolves a participant of a request, named by ID, username or name, to a
+// participant by ID. It returns false when the participant doesn't exist.
+func (s *Server) findParticipant(participantType, id, username, name string) (Participant, bool) {
+	rv := Participant{Type: participantType, ID: id}
+	switch {
+	case participantType == NoneParticipant:
+		return rv, true
+	case participantType == UserParticipant && id == "":
+		identifier := username
+		if identifier == "" {
+			identifier = name
+		}
+		if u := s.findUser(identifier); u != nil {
+			rv.ID = u.ID
+		}
+	case participantType == TeamParticipant && id == "":
+		if t := s.findTeam(name, "name"); t != nil {
+			rv.ID = t.ID
+		}
+	case participantType == ScheduleParticipant && id == "":
+		if schedule := s.findSchedule(name, "name"); schedule != nil {
+			rv.ID = schedule.ID
+		}
+	}
+
+	return rv, rv.ID != ""
+}
+
+func (s *Server) roleExists(name string) bool {
+	for _, role := range defaultRoles {
+		if role == name {
+			return true
+		}
+	}
+	for _, role := range s.roles {
+		if role.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func userRole(u *User) string {
+	if u.Role == "" {
+		return "User"
+	}
+
+	return u.Role
+}
+
+func memberRole(m Member) string {
+	if m.Role == "" {
+		return teamRoleUser
+	}
+
+	return m.Role
+}
+
+func userJSON(u *User) map[string]interface{} {
+	return map[string]interface{}{
+		"id":       u.ID,
+		"username": u.Username,
+		"fullName": u.FullName,
+		"role":     map[string]interface{}{"name": userRole(u)},
+		"blocked":  u.Blocked,
+		"verified": u.Verified,
+		"timeZone": u.TimeZone,
+		"tags":     u.Tags,
+		"details":  u.Details,
+	}
+}
+
+func (s *Server) teamJSON(t *Team, members bool) map[string]interface{} {
+	rv := map[string]interface{}{
+		"id":          t.ID,
+		"name":        t.Name,
+		"description": t.Description,
+	}
+	if !members {
+		return rv
+	}
+
+	list := []interface{}{}
+	for _, m := range t.Members {
+		user := map[string]interface{}{"id": m.UserID}
+		if u := s.findUser(m.UserID); u != nil {
+			user["username"] = u.Username
+		}
+		list = append(list, map[string]interface{}{"user": user, "role": memberRole(m)})
+	}
+	rv["members"] = list
+
+	return rv
+}
+
+// participantJSON names a participant: users by username, teams by name.
+func (s *Server) participantJSON(p Participant) map[string]interface{} {
+	rv := map[string]interface{}{"type": p.Type}
+	if p.ID != "" {
+		rv["id"] = p.ID
+	}
+
+	switch p.Type {
+	case UserParticipant:
+		if u := s.findUser(p.ID); u != nil {
+			rv["username"] = u.Username
+			rv["name"] = u.Username
+		}
+	case TeamParticipant:
+		if t := s.findTeam(p.ID, "id"); t != nil {
+			rv["name"] = t.Name
+		}
+	case ScheduleParticipant:
+		if schedule := s.scheduleByID(p.ID); schedule != nil {
+			rv["name"] = schedule.Name
+		}
+	}
+
+	return rv
+}
+
+// forwardedUserJSON names a user of a forwarding rule.
+func (s *Server) forwardedUserJSON(id string) map[string]interface{} {
+	rv := map[string]interface{}{"id": id}
+	if u := s.findUser(id); u != nil {
+		rv["username"] = u.Username
+	}
+
+	return rv
+}
+
+func (s *Server) forwardingRuleJSON(rule *ForwardingRule) map[string]interface{} {
+	rv := map[string]interface{}{
+		"id":        rule.ID,
+		"alias":     rule.Alias,
+		"fromUser":  s.forwardedUserJSON(rule.FromUserID),
+		"toUser":    s.forwardedUserJSON(rule.ToUserID),
+		"startDate": rule.StartDate.UTC().Format(time.RFC3339),
+	}
+	if !rule.EndDate.IsZero() {
+		rv["endDate"] = rule.EndDate.UTC().Format(time.RFC3339)
+	}
+
+	return rv
+}
+
+func (s *Server) escalationJSON(escalation *Escalation) map[string]interface{} {
+	rv := map[string]interface{}{
+		"id":   escalation.ID,
+		"name": escalation.Name,
+	}
+
+	if escalation.OwnerTeamID != "" {
+		owner := map[string]interface{}{"id": escalation.OwnerTeamID}
+		if t := s.findTeam(escalation.OwnerTeamID, "id"); t != nil {
+			owner["name"] = t.Name
+		}
+		rv["ownerTeam"] = owner
+	}
+
+	rules := []interface{}{}
+	for _, rule := range escalation.Rules {
+		condition := rule.Condition
+		if condition == "" {
+			condition = "if-not-acked"
+		}
+		notifyType := rule.NotifyType
+		if notifyType == "" {
+			notifyType = "default"
+		}
+		rules = append(rules, map[string]interface{}{
+			"condition":  condition,
+			"notifyType": notifyType,
+			"recipient":  s.participantJSON(rule.Recipient),
+			"delay":      map[string]interface{}{"timeAmount": rule.Delay, "timeUnit": "minutes"},
+		})
+	}
+	rv["rules"] = rules
+
+	return rv
+}
+
+func (s *Server) scheduleJSON(schedule *Schedule) map[string]interface{} {
+	rv := map[string]interface{}{
+		"id":       schedule.ID,
+		"name":     schedule.Name,
+		"timezone": schedule.Timezone,
+		"enabled":  schedule.Enabled,
+	}
+
+	if schedule.OwnerTeamID != "" {
+		owner := map[string]interface{}{"id": schedule.OwnerTeamID}
+		if t := s.findTeam(schedule.OwnerTeamID, "id"); t != nil {
+			owner["name"] = t.Name
+		}
+		rv["ownerTeam"] = owner
+	}
+
+	rotations := []interface{}{}
+	for _, rotation := range schedule.Rotations {
+		rotations = append(rotations, s.rotationJSON(rotation))
+	}
+	rv["rotations"] = rotations
+
+	return rv
+}
+
+func (s *Server) rotationJSON(rotation Rotation) map[string]interface{} {
+	participants := []interface{}{}
+	for _, p := range rotation.Participants {
+		participants = append(participants, s.participantJSON(p))
+	}
+
+	return map[string]interface{}{
+		"id":           rotation.ID,
+		"name":         rotation.Name,
+		"type":         "weekly",
+		"length":       1,
+		"participants": participants,
+	}
+}
+
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	offset, end, next := s.page(r, len(s.users))
+	data := []interface{}{}
+	for _, u := range s.users[offset:end] {
+		data = append(data, userJSON(u))
+	}
+
+	paging := map[string]interface{}{}
+	if next != "" {
+		paging["next"] = next
+	}
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"data": data, "paging": paging, "totalCount": len(s.users)})
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(r.PathValue("user"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	writeData(w, r, userJSON(u))
+}
+
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		FullName string `json:"fullName"`
+		TimeZone string `json:"timeZone"`
+		Role     *struct {
+			Name string `json:"name"`
+		} `json:"role"`
+		Blocked *bool    `json:"blocked"`
+		Tags    []string `json:"tags"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(r.PathValue("user"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	if body.Role != nil && !s.roleExists(body.Role.Name) {
+		writeError(w, r, http.StatusUnprocessableEntity, "Role not found: "+body.Role.Name)
+		return
+	}
+
+	if body.FullName != "" {
+		u.FullName = body.FullName
+	}
+	if body.TimeZone != "" {
+		u.TimeZone = body.TimeZone
+	}
+	if body.Role != nil {
+		u.Role = body.Role.Name
+	}
+	if body.Blocked != nil {
+		u.Blocked = *body.Blocked
+	}
+	if body.Tags != nil {
+		u.Tags = body.Tags
+	}
+
+	writeResult(w, r, http.StatusOK, "Updated")
+}
+
+// deleteUser deletes a user, and their team memberships with them.
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(r.PathValue("user"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	for i, other := range s.users {
+		if other == u {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+			break
+		}
+	}
+	for _, t := range s.teams {
+		t.Members = removeMember(t.Members, u.ID)
+	}
+
+	writeResult(w, r, http.StatusOK, "Deleted")
+}
+
+func (s *Server) listUserTeams(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(r.PathValue("user"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	data := []interface{}{}
+	for _, t := range s.teams {
+		for _, m := range t.Members {
+			if m.UserID == u.ID {
+				data = append(data, s.teamJSON(t, false))
+				break
+			}
+		}
+	}
+
+	writeData(w, r, data)
+}
+
+// listUserSchedules lists the schedules with a rotation the user takes part in.
+func (s *Server) listUserSchedules(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(r.PathValue("user"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	data := []interface{}{}
+	for _, schedule := range s.schedules {
+		if inRotation(schedule, u.ID) {
+			data = append(data, map[string]interface{}{"id": schedule.ID, "name": schedule.Name, "enabled": schedule.Enabled})
+		}
+	}
+
+	writeData(w, r, data)
+}
+
+func inRotation(schedule *Schedule, userID string) bool {
+	for _, rotation := range schedule.Rotations {
+		for _, p := range rotation.Participants {
+			if p.Type == UserParticipant && p.ID == userID {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// listUserEscalations lists the escalations with a rule notifying the user.
+func (s *Server) listUserEscalations(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(r.PathValue("user"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	data := []interface{}{}
+	for _, escalation := range s.escalations {
+		for _, rule := range escalation.Rules {
+			if rule.Recipient.Type == UserParticipant && rule.Recipient.ID == u.ID {
+				data = append(data, s.escalationJSON(escalation))
+				break
+			}
+		}
+	}
+
+	writeData(w, r, data)
+}
+
+// listUserForwardingRules lists the rules forwarding the alerts of the user.
+func (s *Server) listUserForwardingRules(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(r.PathValue("user"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	data := []interface{}{}
+	for _, rule := range s.forwardingRules {
+		if rule.FromUserID == u.ID {
+			data = append(data, s.forwardingRuleJSON(rule))
+		}
+	}
+
+	writeData(w, r, data)
+}
+
+func (s *Server) listTeams(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := []interface{}{}
+	for _, t := range s.teams {
+		data = append(data, s.teamJSON(t, false))
+	}
+
+	writeData(w, r, data)
+}
+
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.findTeam(r.PathValue("team"), r.URL.Query().Get("identifierType"))
+	if t == nil {
+		writeError(w, r, http.StatusNotFound, "No team exists with identifier ["+r.PathValue("team")+"]")
+		return
+	}
+
+	writeData(w, r, s.teamJSON(t, true))
+}
+
+func (s *Server) addTeamMember(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		User struct {
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+		Role string `json:"role"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.findTeam(r.PathValue("team"), r.URL.Query().Get("teamIdentifierType"))
+	if t == nil {
+		writeError(w, r, http.StatusNotFound, "No team exists with identifier ["+r.PathValue("team")+"]")
+		return
+	}
+
+	identifier := body.User.ID
+	if identifier == "" {
+		identifier = body.User.Username
+	}
+	u := s.findUser(identifier)
+	if u == nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "User not found: "+identifier)
+		return
+	}
+
+	role := body.Role
+	if role == "" {
+		role = teamRoleUser
+	}
+	if role != teamRoleUser && role != teamRoleAdmin {
+		writeError(w, r, http.StatusUnprocessableEntity, "Invalid team role: "+role)
+		return
+	}
+
+	// Adding a member again changes their role.
+	t.Members = append(removeMember(t.Members, u.ID), Member{UserID: u.ID, Role: role})
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"result": "Added", "data": map[string]interface{}{"id": t.ID, "name": t.Name}})
+}
+
+func (s *Server) removeTeamMember(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.findTeam(r.PathValue("team"), r.URL.Query().Get("teamIdentifierType"))
+	if t == nil {
+		writeError(w, r, http.StatusNotFound, "No team exists with identifier ["+r.PathValue("team")+"]")
+		return
+	}
+
+	u := s.findUser(r.PathValue("member"))
+	if u == nil {
+		writeError(w, r, http.StatusNotFound, "User not found")
+		return
+	}
+
+	members := removeMember(t.Members, u.ID)
+	if len(members) == len(t.Members) {
+		writeError(w, r, http.StatusNotFound, "User is not a member of the team")
+		return
+	}
+	t.Members = members
+
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"result": "Removed", "data": map[string]interface{}{"id": t.ID, "name": t.Name}})
+}
+
+func removeMember(members []Member, userID string) []Member {
+	rv := make([]Member, 0, len(members))
+	for _, m := range members {
+		if m.UserID != userID {
+			rv = append(rv, m)
+		}
+	}
+
+	return rv
+}
+
+func (s *Server) listRoles(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := []interface{}{}
+	for _, role := range s.roles {
+		data = append(data, map[string]interface{}{"id": role.ID, "name": role.Name})
+	}
+
+	writeData(w, r, data)
+}
+
+func (s *Server) getRole(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	identifier := r.PathValue("role")
+	byName := r.URL.Query().Get("identifierType") == "name"
+	for _, role := range s.roles {
+		if (byName && role.Name == identifier) || (!byName && role.ID == identifier) {
+			writeData(w, r, map[string]interface{}{"id": role.ID, "name": role.Name})
+			return
+		}
+	}
+
+	writeError(w, r, http.StatusNotFound, "Role not found")
+}
+
+func (s *Server) listSchedules(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := []interface{}{}
+	for _, schedule := range s.schedules {
+		data = append(data, s.scheduleJSON(schedule))
+	}
+
+	writeData(w, r, data)
+}
+
+func (s *Server) getSchedule(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.findSchedule(r.PathValue("schedule"), r.URL.Query().Get("identifierType"))
+	if schedule == nil {
+		writeError(w, r, http.StatusNotFound, "No schedule exists with identifier ["+r.PathValue("schedule")+"]")
+		return
+	}
+
+	writeData(w, r, s.scheduleJSON(schedule))
+}
+
+func (s *Server) updateSchedule(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name      string `json:"name"`
+		Timezone  string `json:"timezone"`
+		Enabled   *bool  `json:"enabled"`
+		OwnerTeam *struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"ownerTeam"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.findSchedule(r.PathValue("schedule"), r.URL.Query().Get("identifierType"))
+	if schedule == nil {
+		writeError(w, r, http.StatusNotFound, "No schedule exists with identifier ["+r.PathValue("schedule")+"]")
+		return
+	}
+
+	var owner *Team
+	if body.OwnerTeam != nil {
+		if body.OwnerTeam.ID != "" {
+			owner = s.findTeam(body.OwnerTeam.ID, "id")
+		} else {
+			owner = s.findTeam(body.OwnerTeam.Name, "name")
+		}
+		if owner == nil {
+			writeError(w, r, http.StatusUnprocessableEntity, "Owner team not found")
+			return
+		}
+	}
+
+	if body.Name != "" {
+		schedule.Name = body.Name
+	}
+	if body.Timezone != "" {
+		schedule.Timezone = body.Timezone
+	}
+	if body.Enabled != nil {
+		schedule.Enabled = *body.Enabled
+	}
+	if owner != nil {
+		schedule.OwnerTeamID = owner.ID
+	}
+
+	writeData(w, r, map[string]interface{}{"id": schedule.ID, "name": schedule.Name, "enabled": schedule.Enabled})
+}
+
+func (s *Server) updateRotation(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name         string `json:"name"`
+		Participants []struct {
+			Type     string `json:"type"`
+			ID       string `json:"id"`
+			Username string `json:"username"`
+			Name     string `json:"name"`
+		} `json:"participants"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.findSchedule(r.PathValue("schedule"), r.URL.Query().Get("scheduleIdentifierType"))
+	if schedule == nil {
+		writeError(w, r, http.StatusNotFound, "No schedule exists with identifier ["+r.PathValue("schedule")+"]")
+		return
+	}
+
+	for i := range schedule.Rotations {
+		rotation := &schedule.Rotations[i]
+		if rotation.ID != r.PathValue("rotation") {
+			continue
+		}
+
+		if body.Participants != nil {
+			var participants []Participant
+			for _, p := range body.Participants {
+				participant, ok := s.findParticipant(p.Type, p.ID, p.Username, p.Name)
+				if !ok {
+					writeError(w, r, http.StatusUnprocessableEntity, "Participant not found")
+					return
+				}
+				participants = append(participants, participant)
+			}
+			rotation.Participants = participants
+		}
+		if body.Name != "" {
+			rotation.Name = body.Name
+		}
+
+		writeData(w, r, s.rotationJSON(*rotation))
+		return
+	}
+
+	writeError(w, r, http.StatusNotFound, "Rotation not found")
+}
+
+// onCall returns who is on call for a schedule at a point in time: the users of the overrides
+// active then, or the on-call participants of the schedule.
+func (s *Server) onCall(schedule *Schedule, at time.Time) []Participant {
+	var rv []Participant
+	for _, o := range s.overrides[schedule.ID] {
+		if !at.Before(o.StartDate) && at.Before(o.EndDate) {
+			rv = append(rv, Participant{Type: UserParticipant, ID: o.UserID})
+		}
+	}
+	if len(rv) > 0 {
+		return rv
+	}
+
+	return schedule.OnCall
+}
+
+func (s *Server) getOnCalls(w http.ResponseWriter, r *http.Request) {
+	at := time.Now()
+	if date := r.URL.Query().Get("date"); date != "" {
+		t, err := time.Parse(time.RFC3339, date)
+		if err != nil {
+			writeError(w, r, http.StatusUnprocessableEntity, "Invalid date: "+date)
+			return
+		}
+		at = t
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.findSchedule(r.PathValue("schedule"), r.URL.Query().Get("scheduleIdentifierType"))
+	if schedule == nil {
+		writeError(w, r, http.StatusNotFound, "No schedule exists with name ["+r.PathValue("schedule")+"]")
+		return
+	}
+
+	data := map[string]interface{}{
+		"_parent": map[string]interface{}{"id": schedule.ID, "name": schedule.Name, "enabled": schedule.Enabled},
+	}
+
+	participants := s.onCall(schedule, at)
+	if r.URL.Query().Get("flat") == "true" {
+		// Flat on-calls are the usernames of the users on call, team members included.
+		recipients := []string{}
+		for _, p := range participants {
+			switch p.Type {
+			case UserParticipant:
+				if u := s.findUser(p.ID); u != nil {
+					recipients = append(recipients, u.Username)
+				}
+			case TeamParticipant:
+				if t := s.findTeam(p.ID, "id"); t != nil {
+					for _, m := range t.Members {
+						if u := s.findUser(m.UserID); u != nil {
+							recipients = append(recipients, u.Username)
+						}
+					}
+				}
+			}
+		}
+		data["onCallRecipients"] = recipients
+	} else {
+		list := []interface{}{}
+		for _, p := range participants {
+			list = append(list, s.participantJSON(p))
+		}
+		data["onCallParticipants"] = list
+	}
+
+	writeData(w, r, data)
+}
+
+func (s *Server) overrideJSON(schedule *Schedule, o *Override) map[string]interface{} {
+	return map[string]interface{}{
+		"_parent":   map[string]interface{}{"id": schedule.ID, "name": schedule.Name, "enabled": schedule.Enabled},
+		"alias":     o.Alias,
+		"user":      s.participantJSON(Participant{Type: UserParticipant, ID: o.UserID}),
+		"startDate": o.StartDate.UTC().Format(time.RFC3339),
+		"endDate":   o.EndDate.UTC().Format(time.RFC3339),
+		"rotations": []interface{}{},
+	}
+}
+
+func (s *Server) listOverrides(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.findSchedule(r.PathValue("schedule"), r.URL.Query().Get("scheduleIdentifierType"))
+	if schedule == nil {
+		writeError(w, r, http.StatusNotFound, "No schedule exists with identifier ["+r.PathValue("schedule")+"]")
+		return
+	}
+
+	data := []interface{}{}
+	for _, o := range s.overrides[schedule.ID] {
+		data = append(data, s.overrideJSON(schedule, o))
+	}
+
+	writeData(w, r, data)
+}
+
+func (s *Server) createOverride(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Alias string `json:"alias"`
+		User  struct {
+			Type     string `json:"type"`
+			ID       string `json:"id"`
+			Username string `json:"username"`
+		} `json:"user"`
+		StartDate time.Time `json:"startDate"`
+		EndDate   time.Time `json:"endDate"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.findSchedule(r.PathValue("schedule"), r.URL.Query().Get("scheduleIdentifierType"))
+	if schedule == nil {
+		writeError(w, r, http.StatusNotFound, "No schedule exists with identifier ["+r.PathValue("schedule")+"]")
+		return
+	}
+
+	identifier := body.User.ID
+	if identifier == "" {
+		identifier = body.User.Username
+	}
+	u := s.findUser(identifier)
+	if body.User.Type != UserParticipant || u == nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Override user not found: "+identifier)
+		return
+	}
+	if !body.EndDate.After(body.StartDate) {
+		writeError(w, r, http.StatusUnprocessableEntity, "End date must be after start date")
+		return
+	}
+
+	alias := body.Alias
+	if alias == "" {
+		alias = fmt.Sprintf("override-%d", len(s.overrides[schedule.ID])+1)
+	}
+	for _, o := range s.overrides[schedule.ID] {
+		if o.Alias == alias {
+			writeError(w, r, http.StatusConflict, "Override already exists with alias ["+alias+"]")
+			return
+		}
+	}
+
+	s.overrides[schedule.ID] = append(s.overrides[schedule.ID], &Override{
+		Alias:     alias,
+		UserID:    u.ID,
+		StartDate: body.StartDate,
+		EndDate:   body.EndDate,
+	})
+
+	writeJSON(w, r, http.StatusCreated, map[string]interface{}{"result": "Created", "data": map[string]interface{}{"alias": alias}})
+}
+
+func (s *Server) listForwardingRules(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := []interface{}{}
+	for _, rule := range s.forwardingRules {
+		data = append(data, s.forwardingRuleJSON(rule))
+	}
+
+	writeData(w, r, data)
+}
+
+// updateForwardingRule replaces a forwarding rule.
+func (s *Server) updateForwardingRule(w http.ResponseWriter, r *http.Request) {
+	type forwardedUser struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	}
+	var body struct {
+		Alias     string        `json:"alias"`
+		FromUser  forwardedUser `json:"fromUser"`
+		ToUser    forwardedUser `json:"toUser"`
+		StartDate time.Time     `json:"startDate"`
+		EndDate   *time.Time    `json:"endDate"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule := s.findForwardingRule(r.PathValue("rule"))
+	if rule == nil {
+		writeError(w, r, http.StatusNotFound, "Forwarding rule not found")
+		return
+	}
+
+	from, ok := s.findParticipant(UserParticipant, body.FromUser.ID, body.FromUser.Username, "")
+	if !ok || s.findUser(from.ID) == nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "From user not found")
+		return
+	}
+	to, ok := s.findParticipant(UserParticipant, body.ToUser.ID, body.ToUser.Username, "")
+	if !ok || s.findUser(to.ID) == nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "To user not found")
+		return
+	}
+
+	rule.FromUserID = from.ID
+	rule.ToUserID = to.ID
+	rule.StartDate = body.StartDate
+	rule.EndDate = time.Time{}
+	if body.EndDate != nil {
+		rule.EndDate = *body.EndDate
+	}
+	if body.Alias != "" {
+		rule.Alias = body.Alias
+	}
+
+	writeData(w, r, map[string]interface{}{"id": rule.ID, "alias": rule.Alias})
+}
+
+func (s *Server) deleteForwardingRule(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule := s.findForwardingRule(r.PathValue("rule"))
+	if rule == nil {
+		writeError(w, r, http.StatusNotFound, "Forwarding rule not found")
+		return
+	}
+
+	for i, other := range s.forwardingRules {
+		if other == rule {
+			s.forwardingRules = append(s.forwardingRules[:i], s.forwardingRules[i+1:]...)
+			break
+		}
+	}
+
+	writeResult(w, r, http.StatusOK, "Deleted")
+}
+
+func (s *Server) listEscalations(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data := []interface{}{}
+	for _, escalation := range s.escalations {
+		data = append(data, s.escalationJSON(escalation))
+	}
+
+	writeData(w, r, data)
+}
+
+func (s *Server) updateEscalation(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Name      string `json:"name"`
+		OwnerTeam *struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"ownerTeam"`
+		Rules []struct {
+			Condition  string `json:"condition"`
+			NotifyType string `json:"notifyType"`
+			Recipient  struct {
+				Type     string `json:"type"`
+				ID       string `json:"id"`
+				Username string `json:"username"`
+				Name     string `json:"name"`
+			} `json:"recipient"`
+			Delay struct {
+				TimeAmount int `json:"timeAmount"`
+			} `json:"delay"`
+		} `json:"rules"`
+	}
+	if !decode(w, r, &body) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	escalation := s.findEscalation(r.PathValue("escalation"), r.URL.Query().Get("identifierType"))
+	if escalation == nil {
+		writeError(w, r, http.StatusNotFound, "No escalation exists with identifier ["+r.PathValue("escalation")+"]")
+		return
+	}
+
+	var owner *Team
+	if body.OwnerTeam != nil {
+		if body.OwnerTeam.ID != "" {
+			owner = s.findTeam(body.OwnerTeam.ID, "id")
+		} else {
+			owner = s.findTeam(body.OwnerTeam.Name, "name")
+		}
+		if owner == nil {
+			writeError(w, r, http.StatusUnprocessableEntity, "Owner team not found")
+			return
+		}
+	}
+
+	var rules []EscalationRule
+	for _, rule := range body.Rules {
+		recipient, ok := s.findParticipant(rule.Recipient.Type, rule.Recipient.ID, rule.Recipient.Username, rule.Recipient.Name)
+		if !ok {
+			writeError(w, r, http.StatusUnprocessableEntity, "Recipient not found")
+			return
+		}
+		rules = append(rules, EscalationRule{
+			Condition:  rule.Condition,
+			NotifyType: rule.NotifyType,
+			Recipient:  recipient,
+			Delay:      rule.Delay.TimeAmount,
+		})
+	}
+
+	if body.Name != "" {
+		escalation.Name = body.Name
+	}
+	if owner != nil {
+		escalation.OwnerTeamID = owner.ID
+	}
+	if body.Rules != nil {
+		escalation.Rules = rules
+	}
+
+	writeData(w, r, map[string]interface{}{"id": escalation.ID, "name": escalation.Name})
+}
@@ -0,0 +1,412 @@
+// Package opsgenietest provides a stateful fake of the Opsgenie REST API for tests.
+//
+// The fake serves the users, teams, team members, roles, schedules, rotations, on-calls,
+// overrides, forwarding rules and escalations endpoints the connector reads and changes, and keeps
+// the changes, so that a test can provision through the connector and check the result on the
+// fake. Lists are paged like the API pages them, and requests can be rate limited to exercise the
+// retries of the SDK.
+//
+// The other endpoints a sync reads, heartbeats and services, are served as empty lists so that a
+// full sync runs against the fake.
+package opsgenietest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ogclient "github.com/opsgenie/opsgenie-go-sdk-v2/client"
+)
+
+// APIKey is the API key the fake accepts.
+const APIKey = "opsgenietest-key"
+
+// Participant types of rotations, on-calls and escalation rules.
+const (
+	UserParticipant       = "user"
+	TeamParticipant       = "team"
+	ScheduleParticipant   = "schedule"
+	EscalationParticipant = "escalation"
+	NoneParticipant       = "none"
+)
+
+// User is an Opsgenie user. Role is the name of a default or custom role, User when empty.
+type User struct {
+	ID       string
+	Username string
+	FullName string
+	Role     string
+	Blocked  bool
+	Verified bool
+	TimeZone string
+	Tags     []string
+	Details  map[string][]string
+}
+
+// Member is the membership of a user in a team. Role is admin or user, user when empty.
+type Member struct {
+	UserID string
+	Role   string
+}
+
+// Team is an Opsgenie team with its members.
+type Team struct {
+	ID          string
+	Name        string
+	Description string
+	Members     []Member
+}
+
+// Role is a custom user role. The default roles exist in every account and aren't stored.
+type Role struct {
+	ID   string
+	Name string
+}
+
+// Participant is a rotation, on-call or escalation rule participant: a user, team, schedule or
+// escalation by ID, or none.
+type Participant struct {
+	Type string
+	ID   string
+}
+
+// Rotation is a schedule rotation.
+type Rotation struct {
+	ID           string
+	Name         string
+	Participants []Participant
+}
+
+// Schedule is an Opsgenie schedule. OnCall is who is on call when no override is active.
+type Schedule struct {
+	ID          string
+	Name        string
+	Timezone    string
+	Enabled     bool
+	OwnerTeamID string
+	Rotations   []Rotation
+	OnCall      []Participant
+}
+
+// Override puts a user on call for a schedule between two dates.
+type Override struct {
+	Alias     string
+	UserID    string
+	StartDate time.Time
+	EndDate   time.Time
+}
+
+// ForwardingRule forwards the alerts of a user to another user from StartDate, until EndDate
+// when it isn't zero.
+type ForwardingRule struct {
+	ID         string
+	Alias      string
+	FromUserID string
+	ToUserID   string
+	StartDate  time.Time
+	EndDate    time.Time
+}
+
+// EscalationRule notifies a recipient after a delay in minutes. Condition is if-not-acked and
+// NotifyType is default when empty.
+type EscalationRule struct {
+	Condition  string
+	NotifyType string
+	Recipient  Participant
+	Delay      int
+}
+
+// Escalation is an Opsgenie escalation with its rules.
+type Escalation struct {
+	ID          string
+	Name        string
+	OwnerTeamID string
+	Rules       []EscalationRule
+}
+
+// Server is a fake Opsgenie API. Its methods are safe to call while the connector sends requests.
+type Server struct {
+	srv *httptest.Server
+
+	mu sync.Mutex
+	// pageSize caps the number of items of a page, whatever limit the request asks for.
+	pageSize    int
+	rateLimited int
+	requestID   int
+	requests    []string
+
+	users           []*User
+	teams           []*Team
+	roles           []*Role
+	schedules       []*Schedule
+	overrides       map[string][]*Override
+	forwardingRules []*ForwardingRule
+	escalations     []*Escalation
+}
+
+// NewServer starts a fake Opsgenie API, closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	s := &Server{overrides: make(map[string][]*Override)}
+	s.srv = httptest.NewServer(s.handler())
+	t.Cleanup(s.srv.Close)
+
+	return s
+}
+
+// APIURL returns the API URL to configure the Opsgenie SDK or the connector with. The SDK sends
+// plain HTTP requests to URLs without "api" in them, so the URL is the host and port of the fake.
+func (s *Server) APIURL() string {
+	return strings.TrimPrefix(s.srv.URL, "http://")
+}
+
+// Config returns an Opsgenie SDK configuration for the fake. Rate limited requests are retried
+// without waiting.
+func (s *Server) Config() *ogclient.Config {
+	return &ogclient.Config{
+		ApiKey:         APIKey,
+		OpsGenieAPIURL: ogclient.ApiUrl(s.APIURL()),
+		RetryCount:     3,
+		Backoff: func(_, _ time.Duration, _ int, _ *http.Response) time.Duration {
+			return 0
+		},
+	}
+}
+
+// SetPageSize caps the number of items of a page of users or services, to page small lists.
+func (s *Server) SetPageSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pageSize = n
+}
+
+// RateLimit makes the next n requests fail with a 429, like the API does when the rate limit of
+// the account is reached.
+func (s *Server) RateLimit(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rateLimited = n
+}
+
+// Requests returns the method and path of every request served, rate limited ones included.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// AddUser adds a user.
+func (s *Server) AddUser(u User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = append(s.users, &u)
+}
+
+// AddTeam adds a team with its members.
+func (s *Server) AddTeam(t Team) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t.Members = append([]Member(nil), t.Members...)
+	s.teams = append(s.teams, &t)
+}
+
+// AddRole adds a custom role.
+func (s *Server) AddRole(r Role) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.roles = append(s.roles, &r)
+}
+
+// AddSchedule adds a schedule with its rotations.
+func (s *Server) AddSchedule(schedule Schedule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.schedules = append(s.schedules, copySchedule(&schedule))
+}
+
+// SetOnCall sets who is on call for a schedule when no override is active.
+func (s *Server) SetOnCall(scheduleID string, participants ...Participant) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if schedule := s.scheduleByID(scheduleID); schedule != nil {
+		schedule.OnCall = append([]Participant(nil), participants...)
+	}
+}
+
+// AddForwardingRule adds a forwarding rule.
+func (s *Server) AddForwardingRule(rule ForwardingRule) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forwardingRules = append(s.forwardingRules, &rule)
+}
+
+// AddEscalation adds an escalation with its rules.
+func (s *Server) AddEscalation(escalation Escalation) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	escalation.Rules = append([]EscalationRule(nil), escalation.Rules...)
+	s.escalations = append(s.escalations, &escalation)
+}
+
+// User returns a copy of a user.
+func (s *Server) User(id string) (User, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.findUser(id)
+	if u == nil {
+		return User{}, false
+	}
+
+	return *u, true
+}
+
+// Team returns a copy of a team.
+func (s *Server) Team(id string) (Team, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t := s.findTeam(id, "id")
+	if t == nil {
+		return Team{}, false
+	}
+
+	rv := *t
+	rv.Members = append([]Member(nil), t.Members...)
+	return rv, true
+}
+
+// Schedule returns a copy of a schedule.
+func (s *Server) Schedule(id string) (Schedule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule := s.scheduleByID(id)
+	if schedule == nil {
+		return Schedule{}, false
+	}
+
+	return *copySchedule(schedule), true
+}
+
+// Overrides returns the overrides of a schedule.
+func (s *Server) Overrides(scheduleID string) []Override {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rv []Override
+	for _, o := range s.overrides[scheduleID] {
+		rv = append(rv, *o)
+	}
+
+	return rv
+}
+
+// ForwardingRule returns a copy of a forwarding rule.
+func (s *Server) ForwardingRule(id string) (ForwardingRule, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rule := s.findForwardingRule(id)
+	if rule == nil {
+		return ForwardingRule{}, false
+	}
+
+	return *rule, true
+}
+
+// Escalation returns a copy of an escalation.
+func (s *Server) Escalation(id string) (Escalation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	escalation := s.findEscalation(id, "id")
+	if escalation == nil {
+		return Escalation{}, false
+	}
+
+	rv := *escalation
+	rv.Rules = append([]EscalationRule(nil), escalation.Rules...)
+	return rv, true
+}
+
+func copySchedule(schedule *Schedule) *Schedule {
+	rv := *schedule
+	rv.OnCall = append([]Participant(nil), schedule.OnCall...)
+	rv.Rotations = nil
+	for _, r := range schedule.Rotations {
+		r.Participants = append([]Participant(nil), r.Participants...)
+		rv.Rotations = append(rv.Rotations, r)
+	}
+
+	return &rv
+}
+
+// handler authenticates, logs and rate limits the requests before routing them.
+func (s *Server) handler() http.Handler {
+	mux := s.routes()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requestID++
+		requestID := fmt.Sprintf("request-%d", s.requestID)
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		limited := s.rateLimited > 0
+		if limited {
+			s.rateLimited--
+		}
+		s.mu.Unlock()
+
+		w.Header().Set("X-Request-Id", requestID)
+		r.Header.Set("X-Request-Id", requestID)
+		w.Header().Set("X-RateLimit-State", "OK")
+
+		switch {
+		case limited:
+			w.Header().Set("X-RateLimit-State", "THROTTLED")
+			writeError(w, r, http.StatusTooManyRequests, "You are making too many requests! To avoid errors, we recommend you limit requests.")
+		case r.Header.Get("Authorization") != "GenieKey "+APIKey:
+			writeError(w, r, http.StatusUnauthorized, "Could not authenticate")
+		default:
+			mux.ServeHTTP(w, r)
+		}
+	})
+}
+
+// writeJSON writes an Opsgenie response, with the request ID and the time it took.
+func writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, body map[string]interface{}) {
+	body["took"] = 0.001
+	body["requestId"] = r.Header.Get("X-Request-Id")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeData(w http.ResponseWriter, r *http.Request, data interface{}) {
+	writeJSON(w, r, http.StatusOK, map[string]interface{}{"data": data})
+}
+
+func writeResult(w http.ResponseWriter, r *http.Request, statusCode int, result string) {
+	writeJSON(w, r, statusCode, map[string]interface{}{"result": result})
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, statusCode int, message string) {
+	writeJSON(w, r, statusCode, map[string]interface{}{"message": message})
+}
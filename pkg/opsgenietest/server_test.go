@@ -0,0 +1,56 @@
+package opsgenietest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/opsgenie/opsgenie-go-sdk-v2/user"
+)
+
+func TestServer_PagesAndRateLimitsUsers(t *testing.T) {
+	srv := NewServer(t)
+	srv.SetPageSize(2)
+	for _, id := range []string{"user-1", "user-2", "user-3"} {
+		srv.AddUser(User{ID: id, Username: id + "@example.com"})
+	}
+
+	client, err := user.NewClient(srv.Config())
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	srv.RateLimit(1)
+	first, err := client.List(context.Background(), &user.ListRequest{Limit: 100})
+	if err != nil {
+		t.Fatalf("expected the rate limited request to be retried, got %v", err)
+	}
+	if len(first.Users) != 2 || first.Paging.Next == "" {
+		t.Fatalf("expected a full first page with a next link, got %d users and %q", len(first.Users), first.Paging.Next)
+	}
+
+	second, err := client.List(context.Background(), &user.ListRequest{Limit: 100, Offset: len(first.Users)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(second.Users) != 1 || second.Users[0].Id != "user-3" || second.Paging.Next != "" {
+		t.Errorf("expected user-3 alone on the last page, got %v and %q", second.Users, second.Paging.Next)
+	}
+
+	if got := len(srv.Requests()); got != 3 {
+		t.Errorf("expected 3 requests, the first one retried, got %v", srv.Requests())
+	}
+}
+
+func TestServer_RejectsUnknownAPIKey(t *testing.T) {
+	srv := NewServer(t)
+	config := srv.Config()
+	config.ApiKey = "wrong"
+
+	client, err := user.NewClient(config)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	if _, err := client.List(context.Background(), &user.ListRequest{}); err == nil {
+		t.Error("expected an unknown API key to be rejected")
+	}
+}